@@ -22,11 +22,21 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var longlist bool
+// longlist shows the root of each app, appsFilters select apps (and must all
+// match), and appsSort and appsFormat are how they are listed
+var (
+	longlist    bool
+	appsFilters []string
+	appsSort    string
+	appsFormat  string
+)
 
 func init() {
 	AppsCmd.Flags().SetInterspersed(false)
 	AppsCmd.Flags().BoolVarP(&longlist, "longlist", "l", false, "print app bases (longlist)")
+	AppsCmd.Flags().StringArrayVar(&appsFilters, "filter", []string{}, "only list apps with label.KEY=value, label.KEY or has:SECTION (can be repeated)")
+	AppsCmd.Flags().StringVar(&appsSort, "sort", "name", "sort by name, size or installed")
+	AppsCmd.Flags().StringVar(&appsFormat, "format", "", "table, json, csv, or template=<Go template> (names by default)")
 	ScifCmd.AddCommand(AppsCmd)
 }
 
@@ -37,7 +47,10 @@ var AppsCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 
 		// appname is optional, so likely args could be empty
-		err := client.Apps(longlist)
+		err := client.Apps(client.ListOptions{Long: longlist,
+			Filters: appsFilters,
+			Sort:    appsSort,
+			Format:  appsFormat})
 		if err != nil {
 			logger.Exitf("%v", err)
 		}
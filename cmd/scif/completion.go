@@ -0,0 +1,129 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sci-f/scif-go/cmd/scif/docs"
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/client"
+	"github.com/sci-f/scif-go/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	ScifCmd.AddCommand(CompletionCmd)
+}
+
+// CompletionCmd prints a completion script for bash, zsh or fish
+var CompletionCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactValidArgs(1),
+	ValidArgs:             []string{"bash", "zsh", "fish"},
+	Run: func(cmd *cobra.Command, args []string) {
+
+		var err error
+		switch args[0] {
+		case "bash":
+			err = ScifCmd.GenBashCompletion(os.Stdout)
+
+		// The zsh script of cobra has no dynamic completion (of app names), so
+		// zsh uses the bash script through bashcompinit
+		case "zsh":
+			fmt.Println("#compdef scif")
+			fmt.Println("autoload -U +X bashcompinit && bashcompinit")
+			err = ScifCmd.GenBashCompletion(os.Stdout)
+
+		case "fish":
+			err = ScifCmd.GenFishCompletion(os.Stdout, true)
+		}
+		if err != nil {
+			logger.Exitf("%v", err)
+		}
+	},
+
+	Use:     docs.CompletionUse,
+	Short:   docs.CompletionShort,
+	Long:    docs.CompletionLong,
+	Example: docs.CompletionExample,
+}
+
+// completeApp completes the name of an installed app as the first argument,
+// and leaves the arguments after it to the shell (files)
+func completeApp(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) != 0 {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	return client.CompleteAppNames(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRun completes the app, and then its parameters (from %appargs) as
+// a new word. cobra completes a word after a flag (or starting with "-")
+// itself, so the values of parameters aren't completed. An app without
+// parameters gets files.
+func completeRun(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return client.CompleteAppNames(), cobra.ShellCompDirectiveNoFileComp
+	}
+
+	schema, err := client.AppArgs(args[0])
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	if len(schema) == 0 || util.Contains("--", args) {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	given := make(map[string]bool)
+	for _, arg := range args[1:] {
+		given[strings.SplitN(arg, "=", 2)[0]] = true
+	}
+
+	var flags []string
+	for _, arg := range schema {
+		if !given["--"+arg.Name] {
+			flags = append(flags, "--"+arg.Name+"\t"+arg.Help)
+		}
+	}
+	return flags, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeApps completes app names for every argument, without repeats
+func completeApps(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+
+	var apps []string
+	for _, app := range client.CompleteAppNames() {
+		if !util.Contains(app, args) {
+			apps = append(apps, app)
+		}
+	}
+	return apps, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeExec completes the app, and then a command from the bin folder of
+// the app (or files, if none match)
+func completeExec(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		return client.CompleteAppNames(), cobra.ShellCompDirectiveNoFileComp
+	case 1:
+		return client.AppCommands(args[0], toComplete), cobra.ShellCompDirectiveDefault
+	}
+	return nil, cobra.ShellCompDirectiveDefault
+}
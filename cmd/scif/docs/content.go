@@ -49,7 +49,14 @@ const (
           app         app shell to, defaults to SCIF base if not set.
 
         optional arguments:
-          -h, --help  show this help message and exit`
+          -h, --help  show this help message and exit
+          --sandbox      run with the SCIF base read-only (Linux only)
+          --writable     a path to keep writable in the sandbox (repeatable)
+          --private-tmp  give the sandbox an empty /tmp
+          --no-network   give the sandbox no network
+
+        The prompt shows the active apps, and scif-activate <app> and
+        scif-deactivate switch apps in the shell (bash, zsh and sh).`
 	ShellExample string = `
 
         $ scif shell
@@ -78,6 +85,12 @@ const (
 	InstallUse   string = `install [-h] [recipe [recipe ...]]`
 	InstallShort string = `Install a recipe for a Scientific Filesystem`
 	InstallLong  string = `
+        Each line of %appfiles is a source (relative to where scif install
+        is run) and a destination, which is the app root if it's not given,
+        and in the app root if it's relative. An absolute destination is
+        written as it is, outside of the app. A destination that ends with
+        a slash is a folder to copy into.
+
         positional arguments:
           recipe      recipe file for the filesystem
 
@@ -91,18 +104,25 @@ const (
 	// inspect
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 
-	InspectUse   string = `inspect [-h] [attributes [attributes ...]]`
+	InspectUse   string = `inspect [-h] [attributes [attributes ...]] [app [app ...]]`
 	InspectShort string = `inspect attributes for a scif application`
 	InspectLong  string = `
         positional arguments:
-          attributes  attribute to inspect (runscript|r), (environment|e), (labels|l),
-                      or (all|a) (default)
+          app         one or more apps to inspect (or --all-apps)
 
         optional arguments:
-          -h, --help  show this help message and exit`
+          -h, --help  show this help message and exit
+          attributes  attribute to inspect (runscript|r), (environment|e), (labels|l)
+                      (default), (install|i), (files|f), (test|t) or (all|a)
+          -j, --json  print a JSON document (schema_version 1), with the sections,
+                      labels, SCIF_APP* paths, file counts and sizes, and the
+                      hash of the recipe of each app
+          --all-apps  inspect every installed app`
 	InspectExample string = `
 
-        $ scif inspect <app>`
+        $ scif inspect <app>
+        $ scif inspect --json <app> <app>
+        $ scif inspect --all --json --all-apps`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// run
@@ -115,11 +135,281 @@ const (
           cmd         app and optional arguments to target for the entry
 
         optional arguments:
-          -h, --help  show this help message and exit`
+          -h, --help  show this help message and exit
+          --memory    limit the memory of the app (e.g., 512M, 4G)
+          --cpus      limit the CPU quota of the app, in cores (e.g., 1.5)
+          --pids      limit the number of processes of the app
+          --walltime  kill the app after a wall time (e.g., 30m, 2h)
+          --nofile    limit the number of open files of the app
+          --timeout   stop the app (SIGTERM, then SIGKILL) after this long,
+                      and exit with 124 (e.g., 10m)
+          --sandbox      run with the SCIF base read-only (Linux only)
+          --writable     a path to keep writable in the sandbox (repeatable)
+          --private-tmp  give the sandbox an empty /tmp
+          --no-network   give the sandbox no network
+          --provenance   write a provenance record of the run (see scif runs)
+          --detach       run in the background, with the output to a log (see scif ps)
+
+        An app with an %appargs section takes its parameters as flags after
+        the app name (e.g., --threads 4), which are validated and exported
+        as SCIF_ARG_<NAME>. See scif help <app> for the parameters.`
 	RunExample string = `
 
         $ scif run <app>
-        $ scif run <app> [args]`
+        $ scif run <app> [args]
+        $ scif run --detach <app> [args]
+        $ scif run <app> --threads 4 --input reads.bam
+        $ scif run --memory 4G --walltime 2h <app> [args]
+        $ scif run --sandbox --writable /scif/data/<app> <app>`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// ps, logs, stop
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+	PsUse   string = `ps [-h] [-a]`
+	PsShort string = `List the apps run in the background with run --detach.`
+	PsLong  string = `
+        Detached runs (jobs) are kept in $SCIF_STATE/jobs (defaults to
+        $SCIF_BASE/.scif/jobs), with the pid, command, start time, exit
+        status and log of each run.
+
+        optional arguments:
+          -h, --help  show this help message and exit
+          -a, --all   also list jobs that have finished`
+	PsExample string = `
+
+        $ scif ps
+        $ scif ps --all`
+
+	LogsUse   string = `logs [-h] [-f] <id>`
+	LogsShort string = `Print the output of a detached run.`
+	LogsLong  string = `
+        positional arguments:
+          id            the job id (or the random part of it) from scif ps
+
+        optional arguments:
+          -h, --help    show this help message and exit
+          -f, --follow  keep printing the output until the job has finished`
+	LogsExample string = `
+
+        $ scif logs <id>
+        $ scif logs -f <id>`
+
+	StopUse   string = `stop [-h] [-t timeout] <id|app>`
+	StopShort string = `Stop a detached run, or a service.`
+	StopLong  string = `
+        The app (and the processes it started) are sent SIGTERM (or the
+        stop-signal of a service), and SIGKILL if they are still running
+        after the timeout.
+
+        positional arguments:
+          id             the job id (or the random part of it) from scif ps
+          app            an app with a %appservice section, to stop the service
+
+        optional arguments:
+          -h, --help     show this help message and exit
+          -t, --timeout  time to wait before SIGKILL (default 10s, or the
+                         stop-timeout of a service)`
+	StopExample string = `
+
+        $ scif stop <id>
+        $ scif stop --timeout 1m <id>
+        $ scif stop <app>`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// start, restart, status
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+	StartUse   string = `start [-h] <app>`
+	StartShort string = `Start an app as a service.`
+	StartLong  string = `
+        The app must have a %appservice section with a start command. The
+        service is run in the background by a supervisor, which restarts it
+        when it fails (with a growing wait), and scif waits for it to be
+        ready. The state and log are kept in $SCIF_STATE/services (defaults
+        to $SCIF_BASE/.scif/services).
+
+        positional arguments:
+          app         the app to start
+
+        optional arguments:
+          -h, --help  show this help message and exit`
+	StartExample string = `
+
+        $ scif start <app>
+        $ scif status <app>
+        $ scif stop <app>`
+
+	RestartUse   string = `restart [-h] <app>`
+	RestartShort string = `Restart an app run as a service.`
+	RestartLong  string = `
+        positional arguments:
+          app         the app to stop (if it's running) and start
+
+        optional arguments:
+          -h, --help  show this help message and exit`
+	RestartExample string = `
+
+        $ scif restart <app>`
+
+	StatusUse   string = `status [-h] [app]`
+	StatusShort string = `Show the status and health of services as json.`
+	StatusLong  string = `
+        A running service is checked with its %apphealth script (or its
+        ready-command or ready-port). The exit status is 1 if a service
+        isn't running and healthy.
+
+        positional arguments:
+          app         the service to show, defaults to all services
+
+        optional arguments:
+          -h, --help  show this help message and exit`
+	StatusExample string = `
+
+        $ scif status
+        $ scif status <app>`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// up
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+	UpUse   string = `up [-h] <app> [app ...]`
+	UpShort string = `Run apps and services together in the foreground.`
+	UpLong  string = `
+        Apps with a %appservice section are supervised as services (and
+        restarted as their policy says), and other apps are run once. The
+        first app is the primary app: when it exits, the others are stopped,
+        and scif exits with its status. Signals are forwarded to the apps.
+
+        This is meant as the command of a container. When scif is PID 1, it
+        also reaps orphaned processes (SCIF_INIT=no turns this off).
+
+        positional arguments:
+          app         the apps to run, the first is the primary app
+
+        optional arguments:
+          -h, --help  show this help message and exit`
+	UpExample string = `
+
+        $ scif up <app> <service> [<service> ...]
+        $ docker run <image> up <app> <service>`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// runs
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+	RunsUse   string = `runs [-h] [app] [id]`
+	RunsShort string = `List or show the provenance records of app runs.`
+	RunsLong  string = `
+        Runs are recorded with --provenance (or SCIF_PROVENANCE=yes) to
+        $SCIF_APPDATA_<app>/.scif/runs, with the recipe hash, command,
+        environment (secrets redacted), user, host, times, exit code and
+        resource usage of the run.
+
+        positional arguments:
+          app         list the runs of this app, defaults to all apps
+          id          show the record of this run as json
+
+        optional arguments:
+          -h, --help  show this help message and exit`
+	RunsExample string = `
+
+        $ scif runs
+        $ scif runs <app>
+        $ scif runs <app> <id>`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// query
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+	QueryUse   string = `query [-h] [--format table|json] [-c column] <expression>`
+	QueryShort string = `select apps with an expression over their metadata.`
+	QueryLong  string = `
+        The expression is evaluated against the attributes of each app in the
+        JSON document of scif inspect --json (e.g., sections, labels, paths,
+        commands, tests, files.size), and the app name as name. A name that
+        isn't there is null.
+
+          == != < <= > >=   compare strings, numbers, booleans and null
+          =~ !~             match a regular expression (any string of a
+                            list or object)
+          contains          a substring, an item of a list, or an object key
+          and or not        (&& || !), null, false, 0, "" and empty are false
+          len(value)        the length of a string, list or object
+
+        positional arguments:
+          expression  the expression, quoted for the shell
+
+        optional arguments:
+          -h, --help    show this help message and exit
+          --format      table (default), or json, the document of scif inspect
+          -c, --column  an expression for a column of the table (repeatable),
+                        installed, files.count and files.size by default`
+	QueryExample string = `
+
+        $ scif query 'not sections.apptest and len(tests) == 0'
+        $ scif query 'commands contains "python"'
+        $ scif query -c labels.LICENSE 'labels =~ "GPL"'
+        $ scif query --format json 'labels["org.label-schema.name"] == "align"'`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// du
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+	DuUse   string = `du [-h] [-n top] [--threshold] [--quota size] [--format table|json] [app ...]`
+	DuShort string = `Report the disk usage of apps, and their largest files.`
+	DuLong  string = `
+        The size of the root of each app (and the bin and lib folders in it),
+        its data folder, and the total, with the largest files. A file with
+        several hardlinks is counted once, and links aren't followed.
+
+        The data folder can have a quota, "quota 10G" in %appresources (or a
+        resources.quota label). With --threshold, only the apps with data
+        over their quota are reported (none is an empty report, in either
+        format), and scif exits with 1 if there are any.
+
+        positional arguments:
+          app           one or more apps, all of them by default
+
+        optional arguments:
+          -h, --help    show this help message and exit
+          -n, --top     the number of largest files for each app (5)
+          --threshold   only report apps with data over their quota
+          --quota       a quota for apps that don't set one (e.g., 10G)
+          --format      table (default), or json`
+	DuExample string = `
+
+        $ scif du
+        $ scif du -n 10 hello-world-echo
+        $ scif du --format json
+        $ scif du --threshold --quota 50G`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// graph
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+	GraphUse   string = `graph [-h] [--file recipe] [--format dot|mermaid] [app ...]`
+	GraphShort string = `Print how apps use each other, as Graphviz DOT or Mermaid.`
+	GraphLong  string = `
+        An app uses another when its runscript, install, environment, test,
+        entrypoint, service or health check refers to a variable of the other
+        app (e.g., $SCIF_APPRUN_align or $SCIF_APPBIN_hello_world). The steps
+        of a workflow also declare dependencies: an app needs the apps of the
+        steps its step needs (a dashed edge), and uses the apps of variables
+        in its arguments, inputs and outputs.
+
+        positional arguments:
+          app           only the apps, and those they are connected to
+
+        optional arguments:
+          -h, --help    show this help message and exit
+          -f, --file    graph the apps of a recipe instead of the installed base
+          --format      dot (default), or mermaid`
+	GraphExample string = `
+
+        $ scif graph | dot -Tsvg > apps.svg
+        $ scif graph --format mermaid
+        $ scif graph --file pipeline.scif align`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// test
@@ -132,11 +422,30 @@ const (
           cmd         app and optional arguments to target for the entry
 
         optional arguments:
-          -h, --help  show this help message and exit`
+          -h, --help  show this help message and exit
+          --memory    limit the memory of the app (e.g., 512M, 4G)
+          --cpus      limit the CPU quota of the app, in cores (e.g., 1.5)
+          --pids      limit the number of processes of the app
+          --walltime  kill the app after a wall time (e.g., 30m, 2h)
+          --nofile    limit the number of open files of the app
+          --timeout   stop the app (SIGTERM, then SIGKILL) after this long,
+                      and exit with 124 (e.g., 10m)
+          --provenance   write a provenance record of the run (see scif runs)
+          --all          test every installed app, at once, with a summary
+          -j, --jobs     the number of tests to run at once (number of CPUs)
+          --fail-fast    don't start more tests after one fails
+          --case         only run the named test cases with this name
+          --keep         keep the scratch directory ($SCIF_TESTDIR) of each test
+          --report       write a report, junit, tap or json, to a file with
+                         =path (e.g., junit=report.xml) or to stdout`
 	TestExample string = `
 
         $ scif test
-        $ scif test <app>`
+        $ scif test <app>
+        $ scif test --all --report junit=report.xml
+        $ scif test --all --jobs 4 --fail-fast
+        $ scif test --report tap <app>
+        $ scif test --case <case> <app>`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// help
@@ -145,6 +454,9 @@ const (
 	HelpUse   string = `help [-h] [cmd [cmd ...]]`
 	HelpShort string = `Print help for a Scientific Filesystem application, if defined.`
 	HelpLong  string = `
+        Prints the %apphelp of an app, and a table of its parameters if it
+        has an %appargs section.
+
         optional arguments:
           -h, --help  show this help message and exit`
 	HelpExample string = `
@@ -155,16 +467,25 @@ const (
 	// apps
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 
-	AppsUse   string = `apps [-h] [-l]`
+	AppsUse   string = `apps [-h] [-l] [--filter filter] [--sort order] [--format format]`
 	AppsShort string = `list Scientific Filesystem Applications installed`
 	AppsLong  string = `
         optional arguments:
           -h, --help  show this help message and exit
-          -l          show long listing, including paths.`
+          -l          show long listing, including paths.
+          --filter    only list apps with label.KEY=value (a glob), label.KEY,
+                      or has:SECTION (e.g., has:test), can be repeated
+          --sort      sort by name (default), size or installed
+          --format    table, json, csv, or template=<Go template> for each app,
+                      with .Name, .Root, .Installed, .Size, .Files, .Labels
+                      and .Sections`
 	AppsExample string = `
 
         $ scif apps
-        $ scif apps -l`
+        $ scif apps -l
+        $ scif apps --filter label.MAINTAINER=dinosaur --format json
+        $ scif apps --filter has:test --sort size --format table
+        $ scif apps --format 'template={{.Name}} {{.Labels.category}}'`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// dump
@@ -187,12 +508,102 @@ const (
 	ExecShort string = `execute a command to a Scientific Filesystem`
 	ExecLong  string = `
         positional arguments:
-          cmd         app and command to execute. Eg, exec appname echo $SCIF_APPNAME
+          cmd         app and command to execute. Eg, exec appname echo hello
+
+        The command is run as it is given. With --shell, it is a command string
+        for the app shell, so pipes, redirects and $VARIABLES of the app work.
+        The old [e], [out], [in], [pipe] and [append] tokens are deprecated,
+        and only replaced with SCIF_LEGACY_TOKENS=yes.
 
         optional arguments:
-          -h, --help  show this help message and exit`
+          -h, --help  show this help message and exit
+          --shell     run the command as a string in the app shell
+          --memory    limit the memory of the app (e.g., 512M, 4G)
+          --cpus      limit the CPU quota of the app, in cores (e.g., 1.5)
+          --pids      limit the number of processes of the app
+          --walltime  kill the app after a wall time (e.g., 30m, 2h)
+          --nofile    limit the number of open files of the app
+          --timeout   stop the app (SIGTERM, then SIGKILL) after this long,
+                      and exit with 124 (e.g., 10m)
+          --sandbox      run with the SCIF base read-only (Linux only)
+          --writable     a path to keep writable in the sandbox (repeatable)
+          --private-tmp  give the sandbox an empty /tmp
+          --no-network   give the sandbox no network
+          --provenance   write a provenance record of the run (see scif runs)`
 	ExecExample string = `
 
         $ scif exec <app> [cmd]
-        $ scif exec appname echo "Hello?"`
+        $ scif exec appname echo "Hello?"
+        $ scif exec --shell appname 'echo $SCIF_APPNAME | tr a-z A-Z > name.txt'`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// workflow
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+	WorkflowUse   string = `workflow`
+	WorkflowShort string = `Run workflows that chain Scientific Filesystem applications.`
+	WorkflowLong  string = `
+        A workflow is defined in a %workflow section of a recipe, or a separate
+        file with only %workflow sections. Each line is a directive for a step:
+
+          step <step> <app> [args...]   run an app with optional arguments
+          needs <step> <step>...        steps that must run before this one
+          inputs <step> <path>...       files the step reads
+          outputs <step> <path>...      files the step writes
+
+        Relative inputs and outputs are under $SCIF_APPDATA_<app> for the step.
+
+        commands:
+          run         run the steps of a workflow
+
+        optional arguments:
+          -h, --help  show this help message and exit`
+	WorkflowExample string = `
+
+        $ scif workflow run
+        $ scif workflow run <workflow>`
+
+	WorkflowRunUse   string = `run [-h] [--file file] [--from step] [--until step] [--force] [workflow]`
+	WorkflowRunShort string = `Run the steps of a workflow in dependency order.`
+	WorkflowRunLong  string = `
+        Steps whose declared outputs exist and are newer than their inputs are
+        skipped, and steps that need a failed step are blocked. A status table
+        is printed when the workflow is finished.
+
+        positional arguments:
+          workflow      workflow to run, optional if only one is defined
+
+        optional arguments:
+          -h, --help    show this help message and exit
+          -f, --file    load the workflow from a file instead of the base
+          --from        run from this step (and the steps that depend on it)
+          --until       run until this step (and the steps it depends on)
+          --force       run steps even if their outputs are up to date`
+	WorkflowRunExample string = `
+
+        $ scif workflow run pipeline
+        $ scif workflow run --from align pipeline
+        $ scif workflow run --file pipeline.scif --until index`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// completion
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+	CompletionUse   string = `completion [-h] <bash|zsh|fish>`
+	CompletionShort string = `Print a shell completion script for scif.`
+	CompletionLong  string = `
+        The script completes commands and flags, the names of installed apps
+        (from SCIF_BASE when you press tab), and for exec the commands in the
+        bin folder of the app.
+
+        positional arguments:
+          shell       one of bash, zsh or fish
+
+        optional arguments:
+          -h, --help  show this help message and exit`
+	CompletionExample string = `
+
+        $ source <(scif completion bash)
+        $ scif completion zsh > "${fpath[1]}/_scif"
+        $ scif completion fish > ~/.config/fish/completions/scif.fish`
 )
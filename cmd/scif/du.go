@@ -0,0 +1,77 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"os"
+
+	"github.com/sci-f/scif-go/cmd/scif/docs"
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// duTop is the number of largest files for each app, duThreshold only
+// reports apps over their data quota, and duQuota is the quota for apps
+// that don't have one
+var (
+	duTop       int
+	duThreshold bool
+	duQuota     string
+	duFormat    string
+)
+
+func init() {
+	DuCmd.Flags().SetInterspersed(false)
+	DuCmd.Flags().IntVarP(&duTop, "top", "n", 5, "the number of largest files to list for each app")
+	DuCmd.Flags().BoolVar(&duThreshold, "threshold", false, "only report apps with data over their quota, and exit 1 if there are any")
+	DuCmd.Flags().StringVar(&duQuota, "quota", "", "a quota for the data of apps that don't set one (e.g., 10G)")
+	DuCmd.Flags().StringVar(&duFormat, "format", client.DuTable, "table, or json")
+	ScifCmd.AddCommand(DuCmd)
+}
+
+// DuCmd will report the disk usage of apps
+var DuCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ArbitraryArgs,
+	ValidArgsFunction:     completeApps,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		logger.Debugf("Du called with args %v", args)
+
+		options := client.DuOptions{Top: duTop, Threshold: duThreshold, Format: duFormat}
+		if duQuota != "" {
+			var resources client.Resources
+			if err := resources.Set("quota", duQuota); err != nil {
+				logger.Exitf("%v", err)
+			}
+			options.Quota = resources.Quota
+		}
+
+		over, err := client.DiskUsage(args, options)
+		if err != nil {
+			logger.Exitf("%v", err)
+		}
+		if duThreshold && len(over) > 0 {
+			os.Exit(1)
+		}
+	},
+
+	Use:     docs.DuUse,
+	Short:   docs.DuShort,
+	Long:    docs.DuLong,
+	Example: docs.DuExample,
+}
@@ -22,8 +22,15 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// execShell runs the command as a string in the app shell
+var execShell bool
+
 func init() {
 	ExecuteCmd.Flags().SetInterspersed(false)
+	ExecuteCmd.Flags().BoolVar(&execShell, "shell", false, "run the command as a string in the app shell (pipes, redirects, $VARS)")
+	addResourceFlags(ExecuteCmd)
+	addProvenanceFlag(ExecuteCmd)
+	addSandboxFlags(ExecuteCmd)
 	ScifCmd.AddCommand(ExecuteCmd)
 }
 
@@ -31,6 +38,7 @@ func init() {
 var ExecuteCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 	Args:                  cobra.ArbitraryArgs,
+	ValidArgsFunction:     completeExec,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		logger.Debugf("Exec called with args %v", args)
@@ -50,14 +58,14 @@ var ExecuteCmd = &cobra.Command{
 		}
 
 		// The executable is now the first argument
-		executable := args[0]
-		args = args[1:]
+		spec := newRunSpec(appname, args[1:])
+		spec.Command = []string{args[0]}
+		spec.Shell = execShell
 
-		// appname string, cmd []string
-		err := client.Execute(appname, executable, args)
-		if err != nil {
-			logger.Exitf("%v", err)
-		}
+		ctx, cancel := client.InterruptContext()
+		defer cancel()
+
+		exitWithResult(client.RunApp(ctx, spec))
 	},
 	Use:     docs.ExecUse,
 	Short:   docs.ExecShort,
@@ -0,0 +1,53 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/sci-f/scif-go/cmd/scif/docs"
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// graphOptions are the recipe and format of the graph
+var graphOptions client.GraphOptions
+
+func init() {
+	GraphCmd.Flags().SetInterspersed(false)
+	GraphCmd.Flags().StringVarP(&graphOptions.File, "file", "f", "", "graph the apps of a recipe instead of the installed base")
+	GraphCmd.Flags().StringVar(&graphOptions.Format, "format", client.GraphDOT, "dot (Graphviz), or mermaid")
+	ScifCmd.AddCommand(GraphCmd)
+}
+
+// GraphCmd will print how apps use each other
+var GraphCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ArbitraryArgs,
+	ValidArgsFunction:     completeApps,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		logger.Debugf("Graph called with args %v", args)
+
+		if err := client.Graph(args, graphOptions); err != nil {
+			logger.Exitf("%v", err)
+		}
+	},
+
+	Use:     docs.GraphUse,
+	Short:   docs.GraphShort,
+	Long:    docs.GraphLong,
+	Example: docs.GraphExample,
+}
@@ -31,6 +31,7 @@ func init() {
 var HelpCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 	Args:                  cobra.ArbitraryArgs,
+	ValidArgsFunction:     completeApp,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		logger.Debugf("Help called with args %v", args)
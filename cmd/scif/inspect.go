@@ -27,6 +27,7 @@ var (
 	inspectEnv       bool
 	inspectLabels    bool
 	inspectAll       bool // default for inspect
+	inspectAllApps   bool
 	inspectInstall   bool
 	inspectFiles     bool
 	inspectTest      bool
@@ -41,7 +42,9 @@ func init() {
 	InspectCmd.Flags().BoolVarP(&inspectAll, "all", "a", false, "inspect all attributes for one or more scientific filesystem applications.")
 	InspectCmd.Flags().BoolVarP(&inspectFiles, "files", "f", false, "inspect files for one or more scientific filesystem applications.")
 	InspectCmd.Flags().BoolVarP(&inspectInstall, "install", "i", false, "inspect install commands for one or more scientific filesystem applications.")
+	InspectCmd.Flags().BoolVarP(&inspectTest, "test", "t", false, "inspect the tests (and test cases) for one or more scientific filesystem applications.")
 	InspectCmd.Flags().BoolVarP(&inspectJson, "json", "j", false, "Print json instead of raw output.")
+	InspectCmd.Flags().BoolVar(&inspectAllApps, "all-apps", false, "inspect every installed scientific filesystem application.")
 	ScifCmd.AddCommand(InspectCmd)
 }
 
@@ -49,6 +52,7 @@ func init() {
 var InspectCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 	Args:                  cobra.ArbitraryArgs,
+	ValidArgsFunction:     completeApps,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		logger.Debugf("Inspect called with args %v", args)
@@ -58,13 +62,17 @@ var InspectCmd = &cobra.Command{
 			inspectLabels = true
 		}
 
-		// User must select an app to inspect
-		if len(args) == 0 {
-			logger.Exitf("Please specify an app to inspect (scif apps to view installed).")
+		// User must select an app to inspect, or all of them with --all-apps
+		// (--all is all of the attributes)
+		if len(args) == 0 && !inspectAllApps {
+			logger.Exitf("Please specify an app to inspect (scif apps to view installed), or --all-apps.")
+		}
+		if len(args) > 0 && inspectAllApps {
+			logger.Exitf("Please specify apps to inspect, or --all-apps, not both.")
 		}
 
-		// Inspect the desired application
-		err := client.Inspect(args[0], inspectRunscript, inspectEnv, inspectLabels, inspectInstall, inspectFiles, inspectTest, inspectAll, inspectJson)
+		// Inspect the desired applications
+		err := client.Inspect(args, inspectRunscript, inspectEnv, inspectLabels, inspectInstall, inspectFiles, inspectTest, inspectAll, inspectJson)
 		if err != nil {
 			logger.Exitf("%v", err)
 		}
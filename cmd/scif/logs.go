@@ -0,0 +1,51 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/sci-f/scif-go/cmd/scif/docs"
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// logsFollow keeps printing the log until the job has finished
+var logsFollow bool
+
+func init() {
+	LogsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "keep printing the output until the job has finished")
+	ScifCmd.AddCommand(LogsCmd)
+}
+
+// LogsCmd will print the log of a detached run
+var LogsCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		logger.Debugf("Logs called with args %v", args)
+
+		err := client.Logs(args[0], logsFollow)
+		if err != nil {
+			logger.Exitf("%v", err)
+		}
+	},
+
+	Use:     docs.LogsUse,
+	Short:   docs.LogsShort,
+	Long:    docs.LogsLong,
+	Example: docs.LogsExample,
+}
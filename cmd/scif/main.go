@@ -24,6 +24,7 @@ import (
 
 	"github.com/sci-f/scif-go/cmd/scif/docs"
 	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/client"
 	"github.com/sci-f/scif-go/pkg/version" // version
 	"github.com/spf13/cobra"
 )
@@ -60,7 +61,7 @@ func init() {
 	ScifCmd.Flags().BoolVar(&nocolor, "nocolor", false, "print without color output (default False)")
 	ScifCmd.Flags().BoolVarP(&silent, "silent", "s", false, "only print errors")
 	ScifCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "suppress normal output")
-	ScifCmd.Flags().BoolVarP(&readonly, "readonly", "r", false, "use scif without writable")
+	ScifCmd.Flags().BoolVarP(&readonly, "readonly", "r", false, "use scif without writable (run, exec and shell use the sandbox)")
 
 	VersionCmd.Flags().SetInterspersed(false)
 	ScifCmd.AddCommand(VersionCmd)
@@ -126,6 +127,11 @@ func runSetup(cmd *cobra.Command, args []string) {
 
 // ENTRYPOINT ..................................................................
 func main() {
+
+	// As PID 1 (in a container), scif is the init and starts itself again
+	if client.IsInit() {
+		os.Exit(client.RunInit(os.Args))
+	}
 	ExecuteScif()
 }
 
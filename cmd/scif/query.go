@@ -0,0 +1,60 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/sci-f/scif-go/cmd/scif/docs"
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// queryFormat is how the apps are printed, and queryColumns are the columns
+// (expressions) of the table
+var (
+	queryFormat  string
+	queryColumns []string
+)
+
+func init() {
+	QueryCmd.Flags().SetInterspersed(false)
+	QueryCmd.Flags().StringVar(&queryFormat, "format", client.QueryTable, "table, or json (the document of scif inspect --json)")
+	QueryCmd.Flags().StringArrayVarP(&queryColumns, "column", "c", []string{}, "an expression for a column of the table (can be repeated)")
+	ScifCmd.AddCommand(QueryCmd)
+}
+
+// QueryCmd will select apps with an expression over their metadata
+var QueryCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		logger.Debugf("Query called with args %v", args)
+
+		// The expression can be given as one or more arguments
+		err := client.Query(strings.Join(args, " "), queryFormat, queryColumns)
+		if err != nil {
+			logger.Exitf("%v", err)
+		}
+	},
+
+	Use:     docs.QueryUse,
+	Short:   docs.QueryShort,
+	Long:    docs.QueryLong,
+	Example: docs.QueryExample,
+}
@@ -0,0 +1,48 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/sci-f/scif-go/cmd/scif/docs"
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	ScifCmd.AddCommand(RestartCmd)
+}
+
+// RestartCmd will stop (if running) and start a service
+var RestartCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	ValidArgsFunction:     completeApp,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		logger.Debugf("Restart called with args %v", args)
+
+		err := client.RestartService(args[0])
+		if err != nil {
+			logger.Exitf("%v", err)
+		}
+	},
+
+	Use:     docs.RestartUse,
+	Short:   docs.RestartShort,
+	Long:    docs.RestartLong,
+	Example: docs.RestartExample,
+}
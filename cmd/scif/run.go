@@ -16,14 +16,45 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/sci-f/scif-go/cmd/scif/docs"
 	"github.com/sci-f/scif-go/internal/pkg/logger"
 	"github.com/sci-f/scif-go/pkg/client"
 	"github.com/spf13/cobra"
 )
 
+// resourceFlags hold resource limits for commands that run an app
+var resourceFlags = map[string]*string{
+	"memory":   new(string),
+	"cpus":     new(string),
+	"pids":     new(string),
+	"walltime": new(string),
+	"nofile":   new(string),
+	"timeout":  new(string),
+}
+
+// sandbox options for commands that run an app
+var (
+	sandbox           bool
+	sandboxWritable   []string
+	sandboxPrivateTmp bool
+	sandboxNoNetwork  bool
+)
+
+// provenance asks for a run record of the app
+var provenance bool
+
+// detach runs the app in the background (see scif ps)
+var detach bool
+
 func init() {
 	RunCmd.Flags().SetInterspersed(false)
+	addResourceFlags(RunCmd)
+	addSandboxFlags(RunCmd)
+	addProvenanceFlag(RunCmd)
+	RunCmd.Flags().BoolVar(&detach, "detach", false, "run the app in the background, with its output to a log (see scif ps)")
 	ScifCmd.AddCommand(RunCmd)
 }
 
@@ -31,6 +62,7 @@ func init() {
 var RunCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 	Args:                  cobra.ArbitraryArgs,
+	ValidArgsFunction:     completeRun,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		logger.Debugf("Run called with args %v", args)
@@ -44,11 +76,21 @@ var RunCmd = &cobra.Command{
 		appname := args[0]
 		args = args[1:]
 
-		// appname string, cmd []string
-		err := client.Run(appname, args)
-		if err != nil {
-			logger.Exitf("%v", err)
+		// A detached run is supervised by another scif, and we're done
+		if detach {
+			job, err := client.DetachApp(newRunSpec(appname, args))
+			if err != nil {
+				logger.Exitf("%v", err)
+			}
+			fmt.Println(job.ID)
+			logger.Infof("Logging to %s (scif logs -f %s)", job.Log, job.ID)
+			return
 		}
+
+		ctx, cancel := client.InterruptContext()
+		defer cancel()
+
+		exitWithResult(client.RunApp(ctx, newRunSpec(appname, args)))
 	},
 
 	Use:     docs.RunUse,
@@ -56,3 +98,65 @@ var RunCmd = &cobra.Command{
 	Long:    docs.RunLong,
 	Example: docs.RunExample,
 }
+
+// addResourceFlags adds flags to override the resource limits of an app
+func addResourceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(resourceFlags["memory"], "memory", "", "limit the memory of the app (e.g., 512M, 4G)")
+	cmd.Flags().StringVar(resourceFlags["cpus"], "cpus", "", "limit the CPU quota of the app, in cores (e.g., 1.5)")
+	cmd.Flags().StringVar(resourceFlags["pids"], "pids", "", "limit the number of processes of the app")
+	cmd.Flags().StringVar(resourceFlags["walltime"], "walltime", "", "kill the app after a wall time (e.g., 30m, 2h)")
+	cmd.Flags().StringVar(resourceFlags["nofile"], "nofile", "", "limit the number of open files of the app")
+	cmd.Flags().StringVar(resourceFlags["timeout"], "timeout", "", "stop the app (SIGTERM, then SIGKILL) after this long, and exit 124 (e.g., 10m)")
+}
+
+// addSandboxFlags adds flags to run an app in a sandbox
+func addSandboxFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&sandbox, "sandbox", false, "run with the scif base read-only, except the app data (implied by --readonly)")
+	cmd.Flags().StringSliceVar(&sandboxWritable, "writable", []string{}, "a path to keep writable in the sandbox (can be repeated)")
+	cmd.Flags().BoolVar(&sandboxPrivateTmp, "private-tmp", false, "use an empty, private /tmp in the sandbox")
+	cmd.Flags().BoolVar(&sandboxNoNetwork, "no-network", false, "run without network in the sandbox")
+}
+
+// addProvenanceFlag adds a flag to write a provenance record of the run
+func addProvenanceFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&provenance, "provenance", false, "write a provenance record of the run (see scif runs)")
+}
+
+// newRunSpec returns a spec to run an app connected to the terminal, with
+// options from the command line
+func newRunSpec(appname string, args []string) client.RunSpec {
+
+	spec := client.RunSpec{App: appname,
+		Args:       args,
+		Stdin:      os.Stdin,
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
+		Provenance: provenance}
+
+	for key, value := range resourceFlags {
+		if *value != "" {
+			if err := spec.Resources.Set(key, *value); err != nil {
+				logger.Exitf("%v", err)
+			}
+		}
+	}
+
+	// Using scif read-only means using the sandbox
+	if sandbox || readonly {
+		spec.Sandbox = &client.Sandbox{Writable: sandboxWritable,
+			PrivateTmp: sandboxPrivateTmp,
+			NoNetwork:  sandboxNoNetwork}
+	}
+	return spec
+}
+
+// exitWithResult is shared by commands that run an app, and exits with the
+// status of the app process (or an error if it could not be run)
+func exitWithResult(result *client.RunResult, err error) {
+	if err != nil {
+		logger.Exitf("%v", err)
+	}
+	if result != nil {
+		os.Exit(result.Status())
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/sci-f/scif-go/cmd/scif/docs"
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RunsCmd.Flags().SetInterspersed(false)
+	ScifCmd.AddCommand(RunsCmd)
+}
+
+// RunsCmd will list (or show) provenance records of app runs
+var RunsCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.MaximumNArgs(2),
+	ValidArgsFunction:     completeApp,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		logger.Debugf("Runs called with args %v", args)
+
+		// Both the app and the record id are optional
+		appname, id := "", ""
+		if len(args) > 0 {
+			appname = args[0]
+		}
+		if len(args) > 1 {
+			id = args[1]
+		}
+
+		err := client.Runs(appname, id)
+		if err != nil {
+			logger.Exitf("%v", err)
+		}
+	},
+
+	Use:     docs.RunsUse,
+	Short:   docs.RunsShort,
+	Long:    docs.RunsLong,
+	Example: docs.RunsExample,
+}
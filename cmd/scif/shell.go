@@ -24,6 +24,7 @@ import (
 
 func init() {
 	ShellCmd.Flags().SetInterspersed(false)
+	addSandboxFlags(ShellCmd)
 	ScifCmd.AddCommand(ShellCmd)
 }
 
@@ -31,15 +32,21 @@ func init() {
 var ShellCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 	Args:                  cobra.ArbitraryArgs,
+	ValidArgsFunction:     completeApp,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		logger.Debugf("Shell called with args %v", args)
 
 		// appname is optional, so likely args could be empty
-		err := client.Shell(args)
-		if err != nil {
-			logger.Exitf("%v", err)
+		appname := ""
+		if len(args) > 0 {
+			appname = args[0]
 		}
+
+		ctx, cancel := client.InterruptContext()
+		defer cancel()
+
+		exitWithResult(client.ShellApp(ctx, newRunSpec(appname, nil)))
 	},
 
 	Use:     docs.ShellUse,
@@ -0,0 +1,59 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"os"
+
+	"github.com/sci-f/scif-go/cmd/scif/docs"
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	ScifCmd.AddCommand(StatusCmd)
+}
+
+// StatusCmd will print the status (and health) of services as json
+var StatusCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.MaximumNArgs(1),
+	ValidArgsFunction:     completeApp,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		logger.Debugf("Status called with args %v", args)
+
+		// The app is optional, all services are shown without it
+		appname := ""
+		if len(args) > 0 {
+			appname = args[0]
+		}
+
+		healthy, err := client.Status(appname)
+		if err != nil {
+			logger.Exitf("%v", err)
+		}
+		if !healthy {
+			os.Exit(1)
+		}
+	},
+
+	Use:     docs.StatusUse,
+	Short:   docs.StatusShort,
+	Long:    docs.StatusLong,
+	Example: docs.StatusExample,
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"time"
+
+	"github.com/sci-f/scif-go/cmd/scif/docs"
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// stopTimeout is the time to wait for a job before SIGKILL
+var stopTimeout time.Duration
+
+func init() {
+	StopCmd.Flags().DurationVarP(&stopTimeout, "timeout", "t", 10*time.Second, "time to wait before SIGKILL (default 10s, or the stop-timeout of a service)")
+	ScifCmd.AddCommand(StopCmd)
+}
+
+// StopCmd will stop a detached run, or an app run as a service
+var StopCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		logger.Debugf("Stop called with args %v", args)
+
+		// A service is stopped with its own timeout, unless one is given
+		var err error
+		if client.HasService(args[0]) {
+			timeout := time.Duration(0)
+			if cmd.Flags().Changed("timeout") {
+				timeout = stopTimeout
+			}
+			err = client.StopService(args[0], timeout)
+		} else {
+			err = client.Stop(args[0], stopTimeout)
+		}
+		if err != nil {
+			logger.Exitf("%v", err)
+		}
+	},
+
+	Use:     docs.StopUse,
+	Short:   docs.StopShort,
+	Long:    docs.StopLong,
+	Example: docs.StopExample,
+}
@@ -16,14 +16,39 @@
 package main
 
 import (
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
 	"github.com/sci-f/scif-go/cmd/scif/docs"
 	"github.com/sci-f/scif-go/internal/pkg/logger"
 	"github.com/sci-f/scif-go/pkg/client"
 	"github.com/spf13/cobra"
 )
 
+// testAll tests every installed app (testJobs at once), testCases selects
+// named test cases, testReport is the format (and path) of a report, and
+// testKeep keeps the scratch directory ($SCIF_TESTDIR) of each test
+var (
+	testAll      bool
+	testCases    []string
+	testReport   string
+	testJobs     int
+	testFailFast bool
+	testKeep     bool
+)
+
 func init() {
 	TestCmd.Flags().SetInterspersed(false)
+	TestCmd.Flags().BoolVar(&testAll, "all", false, "test every installed app")
+	TestCmd.Flags().StringSliceVar(&testCases, "case", []string{}, "only run the named test cases (can be repeated)")
+	TestCmd.Flags().StringVar(&testReport, "report", "", "write a report, junit|tap|json with an optional =path (stdout by default)")
+	TestCmd.Flags().IntVarP(&testJobs, "jobs", "j", runtime.NumCPU(), "the number of tests to run at once (with --all)")
+	TestCmd.Flags().BoolVar(&testFailFast, "fail-fast", false, "don't start more tests after one fails (with --all)")
+	TestCmd.Flags().BoolVar(&testKeep, "keep", false, "keep the scratch directory ($SCIF_TESTDIR) of each test")
+	addResourceFlags(TestCmd)
+	addProvenanceFlag(TestCmd)
 	ScifCmd.AddCommand(TestCmd)
 }
 
@@ -31,24 +56,11 @@ func init() {
 var TestCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 	Args:                  cobra.ArbitraryArgs,
+	ValidArgsFunction:     completeApp,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		logger.Debugf("Test called with args %v", args)
-
-		// If no args, exit with warning "You must supply an appname to test"
-		if len(args) == 0 {
-			logger.Exitf("You must supply an appname to test")
-		}
-
-		// Remove the first appname from args (pop)
-		appname := args[0]
-		args = args[1:]
-
-		// appname string, cmd []string
-		err := client.Test(appname, args)
-		if err != nil {
-			logger.Exitf("%v", err)
-		}
+		testApps(args)
 	},
 
 	Use:     docs.TestUse,
@@ -56,3 +68,64 @@ var TestCmd = &cobra.Command{
 	Long:    docs.TestLong,
 	Example: docs.TestExample,
 }
+
+// testApps tests an app (with its args), or all apps, and writes a report if
+// one is asked for. Testing all apps (or an app with test cases) ends with a
+// summary table, and it exits non-zero if a test failed.
+func testApps(args []string) {
+
+	var format, path string
+	if testReport != "" {
+		var err error
+		if format, path, err = client.ParseReport(testReport); err != nil {
+			logger.Exitf("%v", err)
+		}
+	}
+
+	var names []string
+	if testAll {
+		if len(args) > 0 {
+			logger.Exitf("--all tests every app, and doesn't take an app name")
+		}
+		names = client.AppNames()
+	} else if len(args) == 0 {
+		logger.Exitf("You must supply an appname to test")
+	} else {
+		names, args = args[:1], args[1:]
+	}
+
+	// A report on stdout isn't mixed with the output of the tests (or the
+	// summary)
+	spec := newRunSpec("", args)
+	var out io.Writer = os.Stdout
+	if format != "" && path == "" {
+		spec.Stdout, out = os.Stderr, os.Stderr
+	}
+
+	// Tests run at once have their output kept, and shown if they fail
+	options := client.TestOptions{Jobs: 1, FailFast: testFailFast, Cases: testCases, Keep: testKeep}
+	parallel := testAll && testJobs > 1 && len(names) > 1
+	if parallel {
+		options.Jobs = testJobs
+		spec.Stdin, spec.Stdout, spec.Stderr = nil, nil, nil
+	}
+
+	ctx, cancel := client.InterruptContext()
+	defer cancel()
+
+	report := client.RunTests(ctx, names, spec, options)
+	if len(report.Cases) == 0 {
+		logger.Exitf("No test cases named %s", strings.Join(testCases, ", "))
+	}
+	report.PrintFailures(out, parallel)
+	if testAll || len(report.Cases) > 1 {
+		report.PrintSummary(out)
+	}
+
+	if format != "" {
+		if err := report.WriteFile(format, path); err != nil {
+			logger.Exitf("%v", err)
+		}
+	}
+	os.Exit(report.ExitStatus())
+}
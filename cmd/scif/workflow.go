@@ -0,0 +1,76 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/sci-f/scif-go/cmd/scif/docs"
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+var workflowOptions client.WorkflowOptions
+
+func init() {
+	WorkflowRunCmd.Flags().StringVarP(&workflowOptions.File, "file", "f", "", "load the workflow from a file instead of the installed base")
+	WorkflowRunCmd.Flags().StringVar(&workflowOptions.From, "from", "", "run from this step (and the steps that depend on it)")
+	WorkflowRunCmd.Flags().StringVar(&workflowOptions.Until, "until", "", "run until this step (and the steps it depends on)")
+	WorkflowRunCmd.Flags().BoolVar(&workflowOptions.Force, "force", false, "run steps even if their outputs are up to date")
+
+	WorkflowCmd.Flags().SetInterspersed(false)
+	WorkflowCmd.AddCommand(WorkflowRunCmd)
+	ScifCmd.AddCommand(WorkflowCmd)
+}
+
+// WorkflowCmd is the command group for scif workflow <subcommand>
+var WorkflowCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+
+	Use:     docs.WorkflowUse,
+	Short:   docs.WorkflowShort,
+	Long:    docs.WorkflowLong,
+	Example: docs.WorkflowExample,
+}
+
+// WorkflowRunCmd is the command to run scif workflow run [name]
+var WorkflowRunCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		logger.Debugf("Workflow run called with args %v", args)
+
+		// The name is optional if only one workflow is defined
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		_, err := client.RunWorkflow(name, workflowOptions)
+		if err != nil {
+			logger.Exitf("%v", err)
+		}
+	},
+
+	Use:     docs.WorkflowRunUse,
+	Short:   docs.WorkflowRunShort,
+	Long:    docs.WorkflowRunLong,
+	Example: docs.WorkflowRunExample,
+}
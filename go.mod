@@ -8,5 +8,6 @@ require github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510
 
 require (
 	github.com/mitchellh/gox v1.0.1
-	golang.org/x/sys v0.0.0-20190215142949-d0b11bdaac8a
+	golang.org/x/sys v0.0.0-20201029080932-201ba4db2418
+	mvdan.cc/sh/v3 v3.2.4
 )
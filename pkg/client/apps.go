@@ -16,33 +16,14 @@
 package client
 
 import (
-	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/util"
 )
 
-// Apps instantiates the client and prints the apps installed.
-func Apps(longlist bool) (err error) {
-
-	// Running an app means we load from the filesystem first
-	cli := ScifClient{}.Load(Scif.Base)
-	apps := cli.apps()
-
-	// Print the apps for the user
-	for _, app := range apps {
-
-		if longlist {
-			lookup := cli.getAppenvLookup(app)
-			fmt.Printf("%s: %s\n", app, lookup["approot"])
-		} else {
-			fmt.Printf("%s\n", app)
-		}
-	}
-	return err
-}
-
 // apps eeturn a list of apps installed
 func (client ScifClient) apps() []string {
 
@@ -75,36 +56,103 @@ func (client ScifClient) activate(name string) {
 	client.updatePathsFunc("PATH", lookup["appbin"])
 	client.updatePathsFunc("LD_LIBRARY_PATH", lookup["applib"])
 
+	// Load environment variables from the app itself (environment.sh)
+	client.loadAppEnv(name)
+
+	// export the changes
+	client.exportEnv()
+
 	// Reset the Entrypoint
 	Scif.EntryPoint = nil
+	settings := Scif.config[name]
 
 	// Set the entrypoint, if the file exists. If the user provides arguments
-	// to run, these will be added by Run or Exec, etc.
+	// to run, these will be added by Run or Exec, etc. An %appentrypoint
+	// comes first, and can use the (now exported) app environment. It's
+	// split before variables are expanded, so a value with spaces is one
+	// argument.
+	if len(settings.entrypoint) > 0 {
+		Scif.EntryPoint = util.ParseEntrypoint(strings.Join(settings.entrypoint, " "))
 
-	// If it doesn't exist, /bin/bash is the default
-	if _, err := os.Stat(lookup["apprun"]); os.IsNotExist(err) {
+		// If it doesn't exist, /bin/bash is the default
+	} else if _, err := os.Stat(lookup["apprun"]); os.IsNotExist(err) {
 
 		logger.Debugf("No entrypoint runscript found, defaulting to %s", Scif.ShellCmd)
 		Scif.EntryPoint = append(Scif.EntryPoint, Scif.ShellCmd)
 
-		// Otherwise, set it to be the script
+		// Otherwise, set it to be the script (with its interpreter)
 	} else {
-		Scif.EntryPoint = append(Scif.EntryPoint, Scif.ShellCmd, lookup["apprun"])
+		Scif.EntryPoint = append(client.interpreter(name, "apprun"), lookup["apprun"])
 	}
 
 	logger.Debugf("EntryPoint is %v", Scif.EntryPoint)
 
-	// Load environment variables from the app itself (environment.sh)
-	client.loadAppEnv(name)
-
-	// Set the entryfolder to the app root if it's not defined by the user
+	// Set the entryfolder to the app workdir (or root) if it's not defined
+	// by the user
 	if Scif.EntryFolder == "" {
-		Scif.EntryFolder = lookup["approot"]
+		Scif.EntryFolder = client.workdir(name)
 	}
+}
 
-	// export the changes
-	client.exportEnv()
+// interpreter returns the command to run the script of a section (apprun or
+// apptest) of an app, from the section header, or the default shell. If the
+// script has a shebang, it's executed directly (and the command is empty).
+func (client ScifClient) interpreter(name string, section string) []string {
+
+	settings := Scif.config[name]
+	if interpreter := settings.interpreter[section]; interpreter != "" {
+		return util.ParseEntrypoint(interpreter)
+	}
+	if interpreter := shebang(settings.script(section)); interpreter != "" {
+		return shebangInterpreter(interpreter)
+	}
+	return []string{Scif.ShellCmd}
+}
+
+// effectiveInterpreter returns what runs the script of a section, and where
+// that comes from (--interpreter, shebang or shell), for inspect and preview.
+// Both are empty if the section isn't defined.
+func (client ScifClient) effectiveInterpreter(name string, section string) (string, string) {
+
+	settings := Scif.config[name]
+	if len(settings.script(section)) == 0 {
+		return "", ""
+	}
+	if interpreter := settings.interpreter[section]; interpreter != "" {
+		return interpreter, "--interpreter"
+	}
+	if interpreter := shebang(settings.script(section)); interpreter != "" {
+		return interpreter, "shebang"
+	}
+	return Scif.ShellCmd, "shell"
+}
+
+// runsInShell returns true if the script of a section is run by the shell,
+// meaning that shell lines (like the environment) can be added to it
+func (client ScifClient) runsInShell(name string, section string) bool {
+	_, source := client.effectiveInterpreter(name, section)
+	return source == "shell"
+}
+
+// workdir returns the working directory for an app from %appworkdir, which
+// can use the app environment, and is relative to the app root. Without
+// it, the app root is the working directory.
+func (client ScifClient) workdir(name string) string {
 
+	approot := client.getAppenvLookup(name)["approot"]
+	workdir := Scif.config[name].workdir
+	if len(workdir) == 0 {
+		return approot
+	}
+	if len(workdir) > 1 {
+		logger.Warningf("%%appworkdir %s should be a single path, using the first", name)
+	}
+
+	path := os.ExpandEnv(strings.TrimSpace(workdir[0]))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(approot, path)
+	}
+	return path
 }
 
 // deactivate will deactivate all apps
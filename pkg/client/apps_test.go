@@ -18,8 +18,11 @@ package client
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"testing"
+
+	"github.com/sci-f/scif-go/pkg/util"
 )
 
 // TestApps to test printing all folders for a scif recipe
@@ -136,6 +139,132 @@ func testNotActive(t *testing.T) {
 	}
 }
 
+// TestActivateEntryPoint tests the entrypoint, interpreter and workdir
+// declared for apps in a recipe
+func TestActivateEntryPoint(t *testing.T) {
+
+	// Create faux scif base
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	recipe := filepath.Join(dir, "entrypoint.scif")
+	lines := []string{"%apprun python-app --interpreter python3",
+		"print('hello')",
+		"%apptest python-app --interpreter \"python3 -u\"",
+		"print('test')",
+		"%appworkdir python-app",
+		"    $SCIF_APPDATA",
+		"%appentrypoint module-app",
+		"    python3 -m module --name $SCIF_APPNAME --greeting $SCIF_TEST_GREETING",
+		"%appworkdir module-app",
+		"    work"}
+	if err := util.WriteFile(lines, recipe); err != nil {
+		t.Errorf("Error writing recipe: %v", err)
+	}
+
+	cli := ScifClient{}.Load(recipe)
+	lookup := cli.getAppenvLookup("python-app")
+
+	if interpreter := cli.interpreter("python-app", "apptest"); !Equal(interpreter, []string{"python3", "-u"}) {
+		t.Errorf("Incorrect test interpreter %v", interpreter)
+	}
+
+	// The runscript isn't installed, so the shell is the entrypoint
+	cli.activate("python-app")
+	if !Equal(Scif.EntryPoint, []string{Scif.ShellCmd}) {
+		t.Errorf("Incorrect entrypoint %v", Scif.EntryPoint)
+	}
+	if Scif.EntryFolder != lookup["appdata"] {
+		t.Errorf("Incorrect entry folder %s, want %s", Scif.EntryFolder, lookup["appdata"])
+	}
+
+	// An entrypoint is a command, with the app environment, and a value with
+	// spaces is a single argument
+	os.Setenv("SCIF_TEST_GREETING", "hello world")
+	defer os.Unsetenv("SCIF_TEST_GREETING")
+	cli.activate("module-app")
+	expected := []string{"python3", "-m", "module", "--name", "module-app", "--greeting", "hello world"}
+	if !Equal(Scif.EntryPoint, expected) {
+		t.Errorf("Incorrect entrypoint %v, want %v", Scif.EntryPoint, expected)
+	}
+	root := cli.getAppenvLookup("module-app")["approot"]
+	if Scif.EntryFolder != filepath.Join(root, "work") {
+		t.Errorf("Incorrect entry folder %s", Scif.EntryFolder)
+	}
+	cli.deactivate()
+}
+
+// TestShebang tests that scripts with a shebang are run directly
+func TestShebang(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	recipe := filepath.Join(dir, "shebang.scif")
+	lines := []string{"%apprun python-app",
+		"    #!/usr/bin/env python3",
+		"print('hello')",
+		"%appenv python-app",
+		"    GREETING=hello",
+		"%apptest python-app",
+		"    echo $GREETING"}
+	if err := util.WriteFile(lines, recipe); err != nil {
+		t.Errorf("Error writing recipe: %v", err)
+	}
+
+	cli := ScifClient{}.Load(recipe)
+	settings := Scif.config["python-app"]
+
+	// The shebang is the first line (without the environment added)
+	if settings.runscript[0] != "#!/usr/bin/env python3" || len(settings.runscript) != 2 {
+		t.Errorf("Incorrect runscript %v", settings.runscript)
+	}
+	if interpreter := cli.interpreter("python-app", "apprun"); len(interpreter) != 0 {
+		t.Errorf("A script with a shebang should run directly, got %v", interpreter)
+	}
+	if interpreter, source := cli.effectiveInterpreter("python-app", "apprun"); interpreter != "/usr/bin/env python3" || source != "shebang" {
+		t.Errorf("Incorrect interpreter %s (%s)", interpreter, source)
+	}
+
+	// Without a shebang, the test still runs in the shell
+	if interpreter := cli.interpreter("python-app", "apptest"); !Equal(interpreter, []string{Scif.ShellCmd}) {
+		t.Errorf("Incorrect test interpreter %v", interpreter)
+	}
+}
+
+// TestParseSectionHeader tests the name and options of a section header
+func TestParseSectionHeader(t *testing.T) {
+
+	var headers = []struct {
+		header  string
+		name    string
+		options map[string]string
+	}{
+		{"myapp", "myapp", map[string]string{}},
+		{"myapp --interpreter python3", "myapp", map[string]string{"interpreter": "python3"}},
+		{"myapp --interpreter=Rscript", "myapp", map[string]string{"interpreter": "Rscript"}},
+		{"myapp --interpreter '/usr/bin/env python3'", "myapp", map[string]string{"interpreter": "/usr/bin/env python3"}},
+	}
+
+	for _, tt := range headers {
+		t.Run(tt.header, func(t *testing.T) {
+			name, options := parseSectionHeader(tt.header)
+			if name != tt.name {
+				t.Errorf("got name %s, want %s", name, tt.name)
+			}
+			if len(options) != len(tt.options) || options["interpreter"] != tt.options["interpreter"] {
+				t.Errorf("got options %v, want %v", options, tt.options)
+			}
+		})
+	}
+}
+
 // Helper Functions
 //..............................................................................
 
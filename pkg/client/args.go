@@ -0,0 +1,322 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/shlex"
+)
+
+// An app with a %appargs section declares the parameters of its runscript,
+// one per line, with a type and options (values with spaces are quoted):
+//
+//	%appargs align
+//	    input path required exists help="the reads to align"
+//	    threads int default=4 help="number of threads"
+//	    mode enum(fast,sensitive) default=fast
+//	    verbose bool help="print more"
+//	    output path positional default=out.bam
+//
+// scif run then takes the parameters as flags (--threads 8, --threads=8, or
+// --verbose for a bool) and validates them. Each value is exported to the app
+// as SCIF_ARG_<NAME> (e.g., SCIF_ARG_THREADS=8), and a positional parameter
+// is also added to the arguments of the runscript, in the order declared.
+// Paths are made absolute, and anything after "--" is passed as is.
+//
+// The types are string, int, float, path, bool and enum(<choice>,...), and
+// the options are default=<value>, required, positional, exists (for a
+// path) and help=<text>.
+
+// appArgPrefix is the prefix of the environment variables for parameters
+const appArgPrefix = "SCIF_ARG_"
+
+// Parameter types for %appargs
+const (
+	argString = "string"
+	argInt    = "int"
+	argFloat  = "float"
+	argPath   = "path"
+	argBool   = "bool"
+	argEnum   = "enum"
+)
+
+// argName is a valid parameter name (used for a flag and a variable)
+var argName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// AppArg is a parameter of an app, from its %appargs section
+type AppArg struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Choices    []string `json:"choices,omitempty"` // for an enum
+	Default    *string  `json:"default,omitempty"`
+	Required   bool     `json:"required,omitempty"`
+	Positional bool     `json:"positional,omitempty"` // also an argument of the runscript
+	Exists     bool     `json:"exists,omitempty"`     // a path must exist
+	Help       string   `json:"help,omitempty"`
+}
+
+// Variable returns the environment variable for the parameter
+func (arg AppArg) Variable() string {
+	return appArgPrefix + strings.ToUpper(strings.Replace(arg.Name, "-", "_", -1))
+}
+
+// Metavar describes the value of the parameter for help, e.g., <int>
+func (arg AppArg) Metavar() string {
+	switch arg.Type {
+	case argBool:
+		return ""
+	case argEnum:
+		return "<" + strings.Join(arg.Choices, "|") + ">"
+	}
+	return "<" + arg.Type + ">"
+}
+
+// AppArgs loads the base (quietly, for shell completion) and returns the
+// parameters of an app, or none if it has no %appargs section
+func AppArgs(name string) ([]AppArg, error) {
+
+	cli, err := loadQuietly()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := Scif.config[name]; !ok {
+		return nil, fmt.Errorf("%s is not an installed app", name)
+	}
+	return cli.getArgs(name)
+}
+
+// getArgs parses the %appargs section of an app from the loaded config
+func (client ScifClient) getArgs(name string) ([]AppArg, error) {
+
+	var args []AppArg
+	seen := make(map[string]bool)
+	for _, line := range Scif.config[name].args {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		arg, err := parseArgLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s %%appargs: %s", name, err)
+		}
+		if seen[arg.Name] {
+			return nil, fmt.Errorf("%s %%appargs: %s is declared twice", name, arg.Name)
+		}
+		seen[arg.Name] = true
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// parseArgLine parses a line of %appargs, e.g., threads int default=4
+func parseArgLine(line string) (AppArg, error) {
+
+	fields, err := shlex.Split(line)
+	if err != nil {
+		return AppArg{}, err
+	}
+	if len(fields) < 2 {
+		return AppArg{}, fmt.Errorf("%q needs a name and a type", strings.TrimSpace(line))
+	}
+
+	// The choices of an enum can have spaces, enum(fast, sensitive)
+	for strings.HasPrefix(fields[1], argEnum+"(") && !strings.HasSuffix(fields[1], ")") && len(fields) > 2 {
+		fields = append([]string{fields[0], fields[1] + fields[2]}, fields[3:]...)
+	}
+
+	arg := AppArg{Name: fields[0], Type: fields[1]}
+	if !argName.MatchString(arg.Name) {
+		return arg, fmt.Errorf("%s is not a valid name", arg.Name)
+	}
+
+	// An enum lists its choices, enum(fast,sensitive)
+	if strings.HasPrefix(arg.Type, argEnum+"(") && strings.HasSuffix(arg.Type, ")") {
+		choices := strings.TrimSuffix(strings.TrimPrefix(arg.Type, argEnum+"("), ")")
+		for _, choice := range strings.Split(choices, ",") {
+			if choice = strings.TrimSpace(choice); choice != "" {
+				arg.Choices = append(arg.Choices, choice)
+			}
+		}
+		arg.Type = argEnum
+		if len(arg.Choices) == 0 {
+			return arg, fmt.Errorf("%s: an enum needs choices, e.g., enum(a,b)", arg.Name)
+		}
+	}
+
+	switch arg.Type {
+	case argString, argInt, argFloat, argPath, argBool, argEnum:
+	default:
+		return arg, fmt.Errorf("%s: %s is not a type (string, int, float, path, bool or enum(...))", arg.Name, arg.Type)
+	}
+
+	for _, option := range fields[2:] {
+		key, value := option, ""
+		if equals := strings.Index(option, "="); equals >= 0 {
+			key, value = option[:equals], option[equals+1:]
+		}
+		switch key {
+		case "default":
+			arg.Default = &value
+		case "required":
+			arg.Required = true
+		case "positional":
+			arg.Positional = true
+		case "exists":
+			arg.Exists = true
+		case "help":
+			arg.Help = value
+		default:
+			return arg, fmt.Errorf("%s: %s is not an option", arg.Name, key)
+		}
+	}
+
+	// The default must be a valid value (a path doesn't need to exist yet)
+	if arg.Default != nil {
+		if _, err := arg.parse(*arg.Default, false); err != nil {
+			return arg, fmt.Errorf("%s: default %s", arg.Name, err)
+		}
+	}
+	return arg, nil
+}
+
+// parse validates a value for the parameter, and returns it as it is passed
+// to the app (a path is made absolute)
+func (arg AppArg) parse(value string, check bool) (string, error) {
+
+	switch arg.Type {
+	case argInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "", fmt.Errorf("%q is not an int", value)
+		}
+	case argFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", fmt.Errorf("%q is not a float", value)
+		}
+	case argBool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%q is not true or false", value)
+		}
+		value = strconv.FormatBool(parsed)
+	case argEnum:
+		for _, choice := range arg.Choices {
+			if value == choice {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("%q is not one of %s", value, strings.Join(arg.Choices, ", "))
+	case argPath:
+		if value == "" {
+			return "", fmt.Errorf("the path is empty")
+		}
+		path, err := filepath.Abs(value)
+		if err != nil {
+			return "", err
+		}
+		if check && arg.Exists {
+			if _, err := os.Stat(path); err != nil {
+				return "", fmt.Errorf("%s does not exist", value)
+			}
+		}
+		value = path
+	}
+	return value, nil
+}
+
+// parseAppArgs validates the arguments for an app with the parameters of its
+// %appargs section. It returns the arguments for the runscript, and the
+// variables to export. An app without parameters gets its arguments as is.
+func (client ScifClient) parseAppArgs(name string, args []string) ([]string, []string, error) {
+
+	schema, err := client.getArgs(name)
+	if err != nil || len(schema) == 0 {
+		return args, nil, err
+	}
+
+	lookup := make(map[string]AppArg)
+	for _, arg := range schema {
+		lookup[arg.Name] = arg
+	}
+
+	// Flags are --name value, --name=value, or --name for a bool
+	values := make(map[string]string)
+	var rest []string
+	for i := 0; i < len(args); i++ {
+
+		if args[i] == "--" {
+			rest = args[i+1:]
+			break
+		}
+		if !strings.HasPrefix(args[i], "--") {
+			return nil, nil, fmt.Errorf("%s: unexpected argument %q (see scif help %s)", name, args[i], name)
+		}
+
+		key, value, hasValue := strings.TrimPrefix(args[i], "--"), "", false
+		if equals := strings.Index(key, "="); equals >= 0 {
+			key, value, hasValue = key[:equals], key[equals+1:], true
+		}
+		arg, ok := lookup[key]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: unknown argument --%s (see scif help %s)", name, key, name)
+		}
+		if !hasValue {
+			if arg.Type == argBool {
+				value = "true"
+			} else if i+1 < len(args) {
+				i++
+				value = args[i]
+			} else {
+				return nil, nil, fmt.Errorf("%s: --%s needs a value", name, key)
+			}
+		}
+
+		parsed, err := arg.parse(value, true)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: --%s %s", name, key, err)
+		}
+		values[key] = parsed
+	}
+
+	// Defaults are used for the parameters that weren't given
+	var positional, env []string
+	for _, arg := range schema {
+
+		value, ok := values[arg.Name]
+		if !ok {
+			if arg.Required {
+				return nil, nil, fmt.Errorf("%s: --%s is required (see scif help %s)", name, arg.Name, name)
+			}
+			if arg.Default != nil {
+				value, _ = arg.parse(*arg.Default, false)
+			} else if arg.Type == argBool {
+				value = "false"
+			} else {
+				continue
+			}
+		}
+
+		env = append(env, arg.Variable()+"="+value)
+		if arg.Positional {
+			positional = append(positional, value)
+		}
+	}
+	return append(positional, rest...), env, nil
+}
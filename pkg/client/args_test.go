@@ -0,0 +1,98 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestParseArgLine tests parsing the lines of %appargs
+func TestParseArgLine(t *testing.T) {
+
+	arg, err := parseArgLine(`  mode enum(fast, sensitive) default=fast help="how to align"`)
+	if err != nil {
+		t.Errorf("Error parsing enum: %v", err)
+	}
+	if arg.Type != argEnum || !Equal(arg.Choices, []string{"fast", "sensitive"}) || *arg.Default != "fast" || arg.Help != "how to align" {
+		t.Errorf("Incorrect enum %+v", arg)
+	}
+	if arg.Variable() != "SCIF_ARG_MODE" || arg.Metavar() != "<fast|sensitive>" {
+		t.Errorf("Incorrect variable %s or metavar %s", arg.Variable(), arg.Metavar())
+	}
+
+	for _, line := range []string{"threads", "threads integer", "threads int default=four",
+		"threads int verbose", "mode enum() default=a", "2threads int"} {
+		if _, err := parseArgLine(line); err == nil {
+			t.Errorf("Expected an error for %q", line)
+		}
+	}
+}
+
+// TestParseAppArgs tests validating the arguments of an app
+func TestParseAppArgs(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	recipe := filepath.Join(dir, "args.scif")
+	ioutil.WriteFile(recipe, []byte(`%apprun align
+    echo "$@"
+%appargs align
+    input path required exists
+    threads int default=4
+    verbose bool
+    output path positional default=out.bam
+%apprun plain
+    echo "$@"
+`), 0644)
+	input := filepath.Join(dir, "reads.bam")
+	ioutil.WriteFile(input, []byte{}, 0644)
+
+	os.Setenv("SCIF_BASE", dir)
+	cli := ScifClient{}.Load(recipe)
+
+	args, env, err := cli.parseAppArgs("align", []string{"--input", input, "--threads=8", "--verbose", "--", "-x"})
+	if err != nil {
+		t.Errorf("Error parsing arguments: %v", err)
+	}
+	output, _ := filepath.Abs("out.bam")
+	if !Equal(args, []string{output, "-x"}) {
+		t.Errorf("Incorrect arguments %v", args)
+	}
+	expected := []string{"SCIF_ARG_INPUT=" + input, "SCIF_ARG_THREADS=8", "SCIF_ARG_VERBOSE=true", "SCIF_ARG_OUTPUT=" + output}
+	if !Equal(env, expected) {
+		t.Errorf("Incorrect environment %v, want %v", env, expected)
+	}
+
+	for _, bad := range [][]string{{}, {"--input", input, "--threads", "x"}, {"--input", filepath.Join(dir, "missing")},
+		{"--input", input, "--other", "1"}, {"--input", input, "stray"}, {"--input"}} {
+		if _, _, err := cli.parseAppArgs("align", bad); err == nil {
+			t.Errorf("Expected an error for %v", bad)
+		}
+	}
+
+	// An app without %appargs gets its arguments as is
+	args, env, err = cli.parseAppArgs("plain", []string{"--anything", "goes"})
+	if err != nil || !Equal(args, []string{"--anything", "goes"}) || len(env) != 0 {
+		t.Errorf("Incorrect arguments %v, %v for an app without parameters (%v)", args, env, err)
+	}
+}
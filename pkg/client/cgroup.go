@@ -0,0 +1,37 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+// cgroup is a cgroup v2 created for a single app run, see cgroup_linux.go
+type cgroup struct {
+	path string // the cgroup directory, e.g., /sys/fs/cgroup/<parent>/scif-<app>-<id>
+}
+
+// cgroupControllers returns the cgroup controllers needed for resources
+func (resources Resources) cgroupControllers() []string {
+
+	var controllers []string
+	if resources.Memory > 0 {
+		controllers = append(controllers, "memory")
+	}
+	if resources.CPUs > 0 {
+		controllers = append(controllers, "cpu")
+	}
+	if resources.Pids > 0 {
+		controllers = append(controllers, "pids")
+	}
+	return controllers
+}
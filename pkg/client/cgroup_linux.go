@@ -0,0 +1,218 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/util"
+)
+
+// cpuPeriod is the period (in microseconds) for the cgroup cpu.max quota
+const cpuPeriod = 100000
+
+// newCgroup creates a cgroup v2 for a run of an app, under the cgroup of the
+// current process, with limits for resources. It returns nil (and no error)
+// if no cgroup is needed for the resources, and an error if the cgroup of
+// the current process isn't a writable, delegated v2 sub-tree.
+func newCgroup(name string, resources Resources) (*cgroup, error) {
+
+	controllers := resources.cgroupControllers()
+	if len(controllers) == 0 {
+		return nil, nil
+	}
+
+	mount, err := cgroupMount()
+	if err != nil {
+		return nil, err
+	}
+	self, err := cgroupSelf()
+	if err != nil {
+		return nil, err
+	}
+	parent := filepath.Join(mount, self)
+
+	if !util.HasWriteAccess(parent) {
+		return nil, fmt.Errorf("cgroup %s is not writable", parent)
+	}
+
+	// The controllers must be delegated to us
+	available, err := ioutil.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return nil, err
+	}
+	for _, controller := range controllers {
+		if !util.Contains(controller, strings.Fields(string(available))) {
+			return nil, fmt.Errorf("cgroup controller %s is not available in %s", controller, parent)
+		}
+	}
+
+	// A cgroup with processes can't enable controllers for children, so
+	// if that fails we move scif to a leaf cgroup and try again.
+	if err := enableControllers(parent, controllers); err != nil {
+		leaf := filepath.Join(parent, "scif")
+		if err := os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+			return nil, err
+		}
+		if err := joinCgroup(leaf); err != nil {
+			return nil, err
+		}
+		if err := enableControllers(parent, controllers); err != nil {
+			return nil, err
+		}
+	}
+
+	id := fmt.Sprintf("scif-%s-%d-%d", name, os.Getpid(), time.Now().UnixNano())
+	cg := &cgroup{path: filepath.Join(parent, id)}
+	if err := os.Mkdir(cg.path, 0755); err != nil {
+		return nil, err
+	}
+
+	limits := make(map[string]string)
+	if resources.Memory > 0 {
+		limits["memory.max"] = strconv.FormatInt(resources.Memory, 10)
+	}
+	if resources.CPUs > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%d %d", int64(resources.CPUs*cpuPeriod), cpuPeriod)
+	}
+	if resources.Pids > 0 {
+		limits["pids.max"] = strconv.FormatInt(resources.Pids, 10)
+	}
+
+	for file, value := range limits {
+		if err := cg.write(file, value); err != nil {
+			cg.remove()
+			return nil, err
+		}
+	}
+
+	logger.Debugf("Created cgroup %s", cg.path)
+	return cg, nil
+}
+
+// cgroupMount finds where the cgroup v2 (unified) hierarchy is mounted
+func cgroupMount() (string, error) {
+
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// The fields after the separator (-) start with the filesystem type
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), " - ")
+		if len(fields) == 2 && strings.HasPrefix(fields[1], "cgroup2 ") {
+			return strings.Fields(fields[0])[4], nil
+		}
+	}
+	return "", fmt.Errorf("cgroup v2 is not mounted")
+}
+
+// cgroupSelf returns the cgroup v2 of the current process, relative to the
+// mount point
+func cgroupSelf() (string, error) {
+
+	for _, line := range util.ReadLines("/proc/self/cgroup") {
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::"), nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup v2 found for the current process")
+}
+
+// enableControllers enables controllers for the children of a cgroup
+func enableControllers(path string, controllers []string) error {
+	value := "+" + strings.Join(controllers, " +")
+	return ioutil.WriteFile(filepath.Join(path, "cgroup.subtree_control"), []byte(value), 0644)
+}
+
+// joinCgroup moves the current process to a cgroup
+func joinCgroup(path string) error {
+	return ioutil.WriteFile(filepath.Join(path, "cgroup.procs"), []byte("0"), 0644)
+}
+
+// write writes a value to a file of the cgroup
+func (cg *cgroup) write(file string, value string) error {
+	return ioutil.WriteFile(filepath.Join(cg.path, file), []byte(value), 0644)
+}
+
+// events returns the count for a key in an events file of the cgroup
+func (cg *cgroup) events(file string, key string) int64 {
+
+	content, err := ioutil.ReadFile(filepath.Join(cg.path, file))
+	if err != nil {
+		return 0
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == key {
+			count, _ := strconv.ParseInt(fields[1], 10, 64)
+			return count
+		}
+	}
+	return 0
+}
+
+// exceeded returns the limit that was exceeded by processes in the cgroup,
+// meaning memory if a process was killed by the OOM killer, or pids if a
+// fork failed because of the maximum. The rlimits aren't known here (and a
+// failed call under one looks like any other failure), so they never are.
+func (cg *cgroup) exceeded() string {
+
+	if cg.events("memory.events", "oom_kill") > 0 {
+		return resourceMemory
+	}
+	if cg.events("pids.events", "max") > 0 {
+		return resourcePids
+	}
+	return ""
+}
+
+// remove kills any processes left in the cgroup, and removes it
+func (cg *cgroup) remove() {
+
+	for i := 0; i < 50; i++ {
+
+		err := os.Remove(cg.path)
+		if err == nil || os.IsNotExist(err) {
+			return
+		}
+
+		// Processes left behind are killed (cgroup.kill is Linux 5.14+)
+		if err := cg.write("cgroup.kill", "1"); err != nil {
+			content, _ := ioutil.ReadFile(filepath.Join(cg.path, "cgroup.procs"))
+			for _, pid := range strings.Fields(string(content)) {
+				if value, err := strconv.Atoi(pid); err == nil {
+					syscall.Kill(value, syscall.SIGKILL)
+				}
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	logger.Warningf("Cannot remove cgroup %s", cg.path)
+}
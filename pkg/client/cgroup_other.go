@@ -0,0 +1,44 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !linux
+// +build !linux
+
+package client
+
+import (
+	"errors"
+)
+
+// errNoCgroups is returned on platforms without cgroups
+var errNoCgroups = errors.New("cgroups are only supported on Linux")
+
+// newCgroup is not supported on this platform
+func newCgroup(name string, resources Resources) (*cgroup, error) {
+	return nil, errNoCgroups
+}
+
+// joinCgroup is not supported on this platform
+func joinCgroup(path string) error {
+	return errNoCgroups
+}
+
+// exceeded is not supported on this platform
+func (cg *cgroup) exceeded() string {
+	return ""
+}
+
+// remove is not supported on this platform
+func (cg *cgroup) remove() {}
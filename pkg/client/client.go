@@ -13,6 +13,15 @@
 // You should have received a copy of the GNU Affero General Public License
 // along with this program.  If not, see <https://www.gnu.org/licenses/>.
 
+// Package client installs, loads and runs the apps of a scientific
+// filesystem (scif). Some of it starts the running executable again: the
+// settings for an app process, the builtin shell, and the supervisors of jobs
+// and services. The init of this package (see reexec.go) takes over such a
+// process, which is marked by one of the SCIF_* variables in its environment
+// (SCIF_EXEC_CONFIG, SCIF_INIT_CHILD, SCIF_SHELL_EXPORTS, SCIF_BUILTIN_SHELL,
+// SCIF_JOB and SCIF_SERVICE), so a program that imports the client must not
+// set these. The init of a container (see IsInit and RunInit) is only run by
+// the main of scif.
 package client
 
 import (
@@ -30,6 +39,10 @@ import (
 // setup.go:    Setup() that should be called to auto load a scif
 // install.go:  installation of base, apps, data folders
 // defaults.go: used below to load defaults for client
+// workflow.go: workflows that run several apps as steps
+// runs.go:     provenance records of app executions
+// jobs.go:     detached runs of apps
+// services.go: apps run as services
 type ScifClient struct {
 	Base     string // /scif is the overall base
 	Data     string // <Base>/data is the data base
@@ -41,24 +54,52 @@ type ScifClient struct {
 	defaultEntryPoint  []string // default entrypoint to an app (parsed to list)
 	defaultEntryFolder string   // default entryfolder
 
-	Environment map[string]string // key value pairs of current environment
-	allowAppend bool              // allow appending to path
-	appendPaths [3]string
-	scifApps    []string
-	config      map[string]AppSettings // a loaded configuration
+	Environment  map[string]string // key value pairs of current environment
+	allowAppend  bool              // allow appending to path
+	appendPaths  [3]string
+	hostPaths    map[string]string // appendPaths on the host, before activation
+	provenance   bool              // write a run record for each execution
+	legacyTokens bool              // replace [e], [pipe], etc. in commands
+	scifApps     []string
+	config       map[string]AppSettings // a loaded configuration
+	workflows    map[string][]string    // loaded %workflow sections, by name
 }
 
 // AppSettings includes ScifClient data objects (under apps), meaning
-// Env, Labels, Help, Runscript, Test, and Install.
-// Each has it's own Data structure under the config["apps"]
+// Env, Labels, Help, Runscript, Test, and Install, and how the app is run
+// (entrypoint, workdir, the interpreter from a section header, as a
+// service, and its parameters).
+// Each has it's own Data structure under the config["apps"], and is shown as
+// JSON by scif inspect (see InspectDocument).
 type AppSettings struct {
-	labels    []string `json:"labels"`
-	environ   []string `json:"environment"`
-	help      []string `json:"test"`
-	runscript []string `json:"runscript"`
-	test      []string `json:"test"`
-	install   []string `json:"install"`
-	files     []string `json:"files"`
+	labels    []string
+	environ   []string
+	help      []string
+	runscript []string
+	test      []string
+	install   []string
+	files     []string
+	testfiles []string
+	resources []string
+
+	entrypoint  []string
+	workdir     []string
+	interpreter map[string]string // by section (apprun, apptest)
+	service     []string
+	health      []string
+	args        []string
+	cases       []appTestCase // named tests, from %apptest <name> <case>
+}
+
+// sections returns the lines of each section, by the name in a recipe
+func (settings AppSettings) sections() map[string][]string {
+	return map[string][]string{
+		"apphelp": settings.help, "apprun": settings.runscript, "appentrypoint": settings.entrypoint,
+		"appworkdir": settings.workdir, "appservice": settings.service, "apphealth": settings.health,
+		"appargs": settings.args, "appinstall": settings.install, "applabels": settings.labels,
+		"appenv": settings.environ, "appfiles": settings.files, "apptest": settings.test,
+		"apptestfiles": settings.testfiles, "appresources": settings.resources,
+	}
 }
 
 // String handles printing
@@ -82,12 +123,17 @@ func NewScifClient() *ScifClient {
 	// Permissions
 	allowAppend := getBoolEnv("SCIF_ALLOW_APPEND_PATHS", getBoolDefault("ALLOW_APPEND_PATHS"))
 	scifAppendPaths := [3]string{"PYTHONPATH", "PATH", "LD_LIBRARY_PATH"}
+	hostPaths := getenvPaths(scifAppendPaths[:])
+
+	// Provenance records for runs
+	provenance := getBoolEnv("SCIF_PROVENANCE", getBoolDefault("PROVENANCE"))
 
 	// Entry points
 	shell := getenv("SCIF_SHELL", getStringDefault("SHELL"))
 	entrypoint := getenv("SCIF_ENTRYPOINT", getStringDefault("ENTRYPOINT"))
 	entryfolder := getenv("SCIF_ENTRYFOLDER", getStringDefault("ENTRYFOLDER"))
 	entrylist := util.ParseEntrypoint(entrypoint)
+	legacyTokens := getBoolEnv("SCIF_LEGACY_TOKENS", getBoolDefault("LEGACY_TOKENS"))
 
 	// Update Environment
 	os.Setenv("SCIF_DATA", data)
@@ -105,6 +151,9 @@ func NewScifClient() *ScifClient {
 		defaultEntryFolder: entryfolder,
 		allowAppend:        allowAppend,
 		appendPaths:        scifAppendPaths,
+		hostPaths:          hostPaths,
+		provenance:         provenance,
+		legacyTokens:       legacyTokens,
 		scifApps:           scifApps}
 
 	// Additional setup could be run here
@@ -0,0 +1,107 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+)
+
+// AppNames loads the base and returns the installed apps, sorted, for shell
+// completion.
+func AppNames() []string {
+
+	cli := ScifClient{}.Load(Scif.Base)
+	apps := cli.apps()
+	sort.Strings(apps)
+	return apps
+}
+
+// CompleteAppNames returns the installed apps, sorted, like AppNames, but
+// loads the base quietly: completion has none if the base can't be loaded.
+func CompleteAppNames() []string {
+
+	cli, err := loadQuietly()
+	if err != nil {
+		return nil
+	}
+	apps := cli.apps()
+	sort.Strings(apps)
+	return apps
+}
+
+// AppCommands returns the executables in the bin folder of an app, with the
+// given prefix, for completing scif exec. An app that isn't installed (or a
+// base that can't be loaded) has none.
+func AppCommands(name string, prefix string) []string {
+
+	cli, err := loadQuietly()
+	if err != nil {
+		return nil
+	}
+	if _, ok := Scif.config[name]; !ok {
+		return nil
+	}
+	return cli.appCommands(name, prefix)
+}
+
+// loadQuietly loads the base for shell completion, where a warning (or an
+// exit) would be printed in the middle of the command line. A missing base
+// is an error, and the log level is restored after.
+func loadQuietly() (*ScifClient, error) {
+
+	level := logger.GetLevel()
+	logger.SetLevel(-4)
+	defer logger.SetLevel(level)
+
+	client := ScifClient{}
+	loaded, err := client.load(Scif.Base)
+	if err == nil && !loaded {
+		err = fmt.Errorf("%s is not a recipe or filesystem", Scif.Base)
+	}
+	return &client, err
+}
+
+// appCommands returns the executables in the bin folder of an app (of the
+// loaded config), with the given prefix
+func (client ScifClient) appCommands(name string, prefix string) []string {
+
+	bin := client.getAppenvLookup(name)["appbin"]
+	files, err := ioutil.ReadDir(bin)
+	if err != nil {
+		return nil
+	}
+
+	var commands []string
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), prefix) {
+			continue
+		}
+
+		// Links are followed to see if the target is executable
+		info, err := os.Stat(filepath.Join(bin, file.Name()))
+		if err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			commands = append(commands, file.Name())
+		}
+	}
+	return commands
+}
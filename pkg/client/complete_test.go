@@ -0,0 +1,76 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestComplete tests completing app names, and the commands of an app
+func TestComplete(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Restore the client settings for other tests
+	base, apps, data := Scif.Base, Scif.Apps, Scif.Data
+	defer func() { Scif.Base, Scif.Apps, Scif.Data = base, apps, data }()
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+
+	if err := Install("../../hello-world.scif", []string{}, true); err != nil {
+		t.Errorf("Error installing temporary SCIF: %v", err)
+	}
+
+	installed := []string{"hello-custom", "hello-world-echo", "hello-world-env", "hello-world-script"}
+	if names := AppNames(); !Equal(names, installed) {
+		t.Errorf("Incorrect app names %v, want %v", names, installed)
+	}
+
+	commands := AppCommands("hello-world-script", "hello")
+	if !Equal(commands, []string{"hello-world.sh"}) {
+		t.Errorf("Incorrect app commands %v", commands)
+	}
+	if commands := AppCommands("hello-world-script", "x"); len(commands) != 0 {
+		t.Errorf("Expected no commands for prefix x, got %v", commands)
+	}
+	if commands := AppCommands("doesnt-exist", ""); len(commands) != 0 {
+		t.Errorf("Expected no commands for a missing app, got %v", commands)
+	}
+	if names := CompleteAppNames(); !Equal(names, installed) {
+		t.Errorf("Incorrect completed app names %v, want %v", names, installed)
+	}
+
+	// A base that can't be loaded has no completions (and doesn't exit)
+	Scif.Base = filepath.Join(dir, "missing")
+	if names := CompleteAppNames(); len(names) != 0 {
+		t.Errorf("Expected no app names for a missing base, got %v", names)
+	}
+	if commands := AppCommands("hello-world-script", ""); len(commands) != 0 {
+		t.Errorf("Expected no commands for a missing base, got %v", commands)
+	}
+	if _, err := AppArgs("hello-world-script"); err == nil {
+		t.Errorf("Expected an error for the arguments of a missing base")
+	}
+}
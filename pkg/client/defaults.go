@@ -76,6 +76,9 @@ func getBoolDefault(key string) bool {
 
 	defaults := map[string]bool{
 		"ALLOW_APPEND_PATHS": true,
+		"PROVENANCE":         false,
+		"LEGACY_TOKENS":      false,
+		"INIT":               true,
 	}
 
 	if value, ok := defaults[key]; ok {
@@ -103,3 +106,17 @@ func getenvNamespace(prefix string) []string {
 
 	return namespace
 }
+
+// getenvPaths returns the values of a list of path variables that are set in
+// the environment. The client keeps these so that activating an app more than
+// once (e.g., in a long running program) appends to the original values.
+func getenvPaths(keys []string) map[string]string {
+
+	paths := make(map[string]string)
+	for _, key := range keys {
+		if value, ok := os.LookupEnv(key); ok {
+			paths[key] = value
+		}
+	}
+	return paths
+}
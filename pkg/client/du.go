@@ -0,0 +1,307 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/sci-f/scif-go/pkg/util"
+)
+
+// scif du reports the disk usage of apps: the files in the root of each app
+// (with the bin and lib folders that are in it) and in its data folder, and
+// the largest of them. Sizes are those of the (regular) files, and a file
+// with several hardlinks is counted once, for the first link that is found,
+// across all of the apps that are reported. Links aren't followed.
+//
+// The data folder of an app can have a quota, in %appresources (quota 10G)
+// or a label (resources.quota), and with --threshold only the apps that
+// are over their quota are reported, as a failure.
+
+// Formats for disk usage
+const (
+	DuTable = "table"
+	DuJSON  = "json"
+)
+
+// DuOptions are how disk usage is reported
+type DuOptions struct {
+	Top       int    // the number of largest files for each app
+	Threshold bool   // only report apps with data over their quota
+	Quota     int64  // for apps that don't have a quota (0 is none)
+	Format    string // table (default) or json
+}
+
+// DuReport is the disk usage of apps, with the total for all of them
+type DuReport struct {
+	Apps  []AppDiskUsage `json:"apps"`
+	Total InspectUsage   `json:"total"`
+}
+
+// AppDiskUsage is the disk usage of an app. The root includes bin and lib.
+type AppDiskUsage struct {
+	Name      string       `json:"name"`
+	Root      InspectUsage `json:"root"`
+	Bin       InspectUsage `json:"bin"`
+	Lib       InspectUsage `json:"lib"`
+	Data      InspectUsage `json:"data"`
+	Total     InspectUsage `json:"total"`           // of the root and data
+	Quota     int64        `json:"quota,omitempty"` // for the data, in bytes
+	OverQuota bool         `json:"over_quota"`
+	Largest   []DuFile     `json:"largest"`
+}
+
+// DuFile is a file of an app, and its size in bytes
+type DuFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// fileID is a file on a device, which its hardlinks share
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// usageWalker counts files in folders, once for each file (and not each
+// of its links) across the folders that it walks
+type usageWalker struct {
+	seen map[fileID]bool
+}
+
+func newUsageWalker() *usageWalker {
+	return &usageWalker{seen: map[fileID]bool{}}
+}
+
+// walk calls visit for each regular file in a folder (and below) that wasn't
+// seen before. A missing folder is empty.
+func (walker *usageWalker) walk(root string, visit func(path string, size int64)) {
+
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Nlink > 1 {
+			id := fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}
+			if walker.seen[id] {
+				return nil
+			}
+			walker.seen[id] = true
+		}
+		visit(path, info.Size())
+		return nil
+	})
+}
+
+// add counts a file of some size
+func (usage *InspectUsage) add(size int64) {
+	usage.Count++
+	usage.Size += size
+}
+
+// diskUsage counts the regular files in a folder (and below), and their
+// size, with hardlinks counted once
+func diskUsage(path string) InspectUsage {
+
+	var usage InspectUsage
+	newUsageWalker().walk(path, func(path string, size int64) {
+		usage.add(size)
+	})
+	return usage
+}
+
+// DiskUsage prints the disk usage of apps (all of them if there are none),
+// and returns the names of those with data over their quota.
+func DiskUsage(names []string, options DuOptions) ([]string, error) {
+
+	if options.Format == "" {
+		options.Format = DuTable
+	}
+	if options.Format != DuTable && options.Format != DuJSON {
+		return nil, fmt.Errorf("%s is not a format (table or json)", options.Format)
+	}
+
+	cli := ScifClient{}.Load(Scif.Base)
+	if len(names) == 0 {
+		names = AppNames()
+	}
+	for _, name := range names {
+		if !util.Contains(name, cli.apps()) {
+			return nil, fmt.Errorf("%s is not an installed app", name)
+		}
+	}
+
+	// With a threshold, the apps over their quota are the report (empty if
+	// there are none) and the exit status, the same for each format
+	report, over := cli.diskUsageReport(names, options)
+	if options.Threshold {
+		if !report.hasQuota() {
+			return nil, fmt.Errorf("no app has a quota (set quota in %%appresources, or use --quota)")
+		}
+		report = report.overQuota()
+	}
+
+	if options.Format == DuJSON {
+		result, err := json.MarshalIndent(report, "", "\t")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println(string(result))
+		return over, nil
+	}
+	return over, report.writeTable(os.Stdout)
+}
+
+// diskUsageReport walks the folders of apps, and returns their disk usage
+// with the names of the apps over their quota
+func (client ScifClient) diskUsageReport(names []string, options DuOptions) (DuReport, []string) {
+
+	report := DuReport{Apps: []AppDiskUsage{}}
+	over := []string{}
+	walker := newUsageWalker()
+
+	for _, name := range names {
+
+		lookup := client.getAppenvLookup(name)
+		app := AppDiskUsage{Name: name, Quota: client.getResources(name).Quota}
+		if app.Quota == 0 {
+			app.Quota = options.Quota
+		}
+
+		var files []DuFile
+		walker.walk(lookup["approot"], func(path string, size int64) {
+			app.Root.add(size)
+			if isBelow(path, lookup["appbin"]) {
+				app.Bin.add(size)
+			} else if isBelow(path, lookup["applib"]) {
+				app.Lib.add(size)
+			}
+			files = append(files, DuFile{Path: path, Size: size})
+		})
+		walker.walk(lookup["appdata"], func(path string, size int64) {
+			app.Data.add(size)
+			files = append(files, DuFile{Path: path, Size: size})
+		})
+
+		app.Total = InspectUsage{Count: app.Root.Count + app.Data.Count, Size: app.Root.Size + app.Data.Size}
+		app.Largest = largestFiles(files, options.Top)
+		if app.Quota > 0 && app.Data.Size > app.Quota {
+			app.OverQuota = true
+			over = append(over, name)
+		}
+
+		report.Total.Count += app.Total.Count
+		report.Total.Size += app.Total.Size
+		report.Apps = append(report.Apps, app)
+	}
+	return report, over
+}
+
+// isBelow is true if a path is in a folder (or below)
+func isBelow(path string, folder string) bool {
+	return strings.HasPrefix(path, folder+string(filepath.Separator))
+}
+
+// largestFiles returns the top largest files (by path for the same size)
+func largestFiles(files []DuFile, top int) []DuFile {
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Size != files[j].Size {
+			return files[i].Size > files[j].Size
+		}
+		return files[i].Path < files[j].Path
+	})
+	if top < 0 {
+		top = 0
+	}
+	if len(files) > top {
+		files = files[:top]
+	}
+	return append([]DuFile{}, files...)
+}
+
+// hasQuota is true if any app of the report has a quota
+func (report DuReport) hasQuota() bool {
+	for _, app := range report.Apps {
+		if app.Quota > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// overQuota returns the report for the apps over their quota
+func (report DuReport) overQuota() DuReport {
+
+	over := DuReport{Apps: []AppDiskUsage{}}
+	for _, app := range report.Apps {
+		if app.OverQuota {
+			over.Apps = append(over.Apps, app)
+			over.Total.Count += app.Total.Count
+			over.Total.Size += app.Total.Size
+		}
+	}
+	return over
+}
+
+// writeTable writes the usage of each app and the total, and then the
+// largest files of each app
+func (report DuReport) writeTable(writer io.Writer) error {
+
+	table := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "APP\tROOT\tBIN\tLIB\tDATA\tTOTAL\tFILES\tQUOTA")
+	for _, app := range report.Apps {
+		quota := "-"
+		if app.Quota > 0 {
+			quota = humanBytes(app.Quota)
+		}
+		if app.OverQuota {
+			quota += " (over)"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n", app.Name,
+			humanBytes(app.Root.Size), humanBytes(app.Bin.Size), humanBytes(app.Lib.Size),
+			humanBytes(app.Data.Size), humanBytes(app.Total.Size), app.Total.Count, quota)
+	}
+	if len(report.Apps) > 1 {
+		fmt.Fprintf(table, "total\t\t\t\t\t%s\t%d\t\n", humanBytes(report.Total.Size), report.Total.Count)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	for _, app := range report.Apps {
+		if len(app.Largest) == 0 {
+			continue
+		}
+		fmt.Fprintf(writer, "\nLargest files of %s:\n", app.Name)
+		table = tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+		for _, file := range app.Largest {
+			fmt.Fprintf(table, "  %s\t%s\n", humanBytes(file.Size), file.Path)
+		}
+		if err := table.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDiskUsage tests the usage of apps, with hardlinks and a data quota
+func TestDiskUsage(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+	if err := Install("../../hello-world.scif", []string{}, true); err != nil {
+		t.Errorf("Error installing temporary SCIF: %v", err)
+	}
+
+	// A file in the data of one app, hardlinked to the data of another
+	data := filepath.Join(Scif.Data, "hello-world-echo")
+	if err := os.MkdirAll(data, 0755); err != nil {
+		t.Fatalf("Error creating data: %v", err)
+	}
+	big := filepath.Join(data, "big.bin")
+	if err := ioutil.WriteFile(big, make([]byte, 3000), 0644); err != nil {
+		t.Fatalf("Error writing data: %v", err)
+	}
+	if err := os.Link(big, filepath.Join(data, "big-copy.bin")); err != nil {
+		t.Fatalf("Error linking data: %v", err)
+	}
+	other := filepath.Join(Scif.Data, "hello-custom")
+	os.MkdirAll(other, 0755)
+	if err := os.Link(big, filepath.Join(other, "big.bin")); err != nil {
+		t.Fatalf("Error linking data: %v", err)
+	}
+
+	cli := ScifClient{}.Load(Scif.Base)
+	report, over := cli.diskUsageReport(AppNames(), DuOptions{Top: 2, Quota: 2048})
+	apps := map[string]AppDiskUsage{}
+	for _, app := range report.Apps {
+		apps[app.Name] = app
+	}
+
+	// The file is counted once, for the first app with a link
+	if usage := apps["hello-custom"].Data; usage.Count != 1 || usage.Size != 3000 {
+		t.Errorf("Expected the data of hello-custom to be one file of 3000 bytes, got %v", usage)
+	}
+	if usage := apps["hello-world-echo"].Data; usage.Count != 0 {
+		t.Errorf("Expected a hardlink to be counted once, got %v", usage)
+	}
+	if !Equal(over, []string{"hello-custom"}) || !apps["hello-custom"].OverQuota {
+		t.Errorf("Expected hello-custom over its quota, got %v", over)
+	}
+
+	// Files in bin are in the root too
+	script := apps["hello-world-script"]
+	if script.Bin.Count != 1 || script.Root.Count <= script.Bin.Count {
+		t.Errorf("Expected a file in bin, under the root, got %v and %v", script.Bin, script.Root)
+	}
+	if len(script.Largest) != 2 || script.Largest[0].Size < script.Largest[1].Size {
+		t.Errorf("Expected the two largest files, got %v", script.Largest)
+	}
+
+	var total int64
+	for _, app := range report.Apps {
+		total += app.Total.Size
+	}
+	if report.Total.Size != total {
+		t.Errorf("Expected a total of %d, got %d", total, report.Total.Size)
+	}
+
+	// Only the app over its quota is left
+	if names := report.overQuota().Apps; len(names) != 1 || names[0].Name != "hello-custom" {
+		t.Errorf("Expected only hello-custom over its quota, got %v", names)
+	}
+	var buffer bytes.Buffer
+	if err := report.overQuota().writeTable(&buffer); err != nil {
+		t.Errorf("Error writing the table: %v", err)
+	}
+	if !strings.Contains(buffer.String(), "2.0K (over)") {
+		t.Errorf("Expected the quota to be flagged, got %s", buffer.String())
+	}
+}
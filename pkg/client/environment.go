@@ -18,6 +18,7 @@ package client
 import (
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/sci-f/scif-go/internal/pkg/logger"
@@ -145,8 +146,8 @@ func (client ScifClient) appendPathsFunc(key string, value string) string {
 		return value
 	}
 
-	// If the variable is defined on the host
-	if envar, ok := os.LookupEnv(key); ok {
+	// If the variable is defined on the host (before any activation)
+	if envar, ok := Scif.hostPaths[key]; ok {
 
 		// And also in the list of appendPaths
 		contained := false
@@ -156,7 +157,8 @@ func (client ScifClient) appendPathsFunc(key string, value string) string {
 			}
 		}
 
-		if contained {
+		// Don't append again to a value that already has it
+		if contained && !strings.HasSuffix(value, ":"+envar) {
 			value = value + ":" + envar
 		}
 	}
@@ -189,6 +191,25 @@ func (client ScifClient) exportEnv() {
 	}
 }
 
+// appEnviron returns the environment that exportEnv exports, as a list of
+// key=value: the current environment, with Scif.Environment (and the paths
+// appended) over it. The builtin shell evaluates an environment.sh in it,
+// as a shell would after the app is activated.
+func (client ScifClient) appEnviron() []string {
+
+	environment := environMap(os.Environ())
+	for k, v := range Scif.Environment {
+		environment[k] = client.appendPathsFunc(k, v)
+	}
+
+	var env []string
+	for k, v := range environment {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
 // loadAppEnv updates the Scif.Environment so that envars from the environment.sh
 // are loaded for export when the application is activated.
 func (client ScifClient) loadAppEnv(name string) {
@@ -200,6 +221,19 @@ func (client ScifClient) loadAppEnv(name string) {
 		return
 	}
 
+	// Without a shell, the builtin shell evaluates the environment
+	if client.builtinShellSelected() {
+		environment, err := builtinEnvironment(lookup["appenv"], client.appEnviron())
+		if err != nil {
+			logger.Warningf("Cannot evaluate environment for %s: %s", name, err)
+		}
+		for key, value := range environment {
+			logger.Debugf("Updating %s environment %s=%s", name, key, value)
+			Scif.Environment[key] = value
+		}
+		return
+	}
+
 	lines := util.ReadLines(lookup["appenv"])
 	var parts []string
 
@@ -16,85 +16,517 @@
 package client
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/sci-f/scif-go/internal/pkg/logger"
 	"github.com/sci-f/scif-go/pkg/util"
+	"golang.org/x/sys/unix"
 )
 
-// Execute some commands to an executable. We first set the EntryPoint to be
-// the executable, and the additional arguments are added by client.execute
-func Execute(name string, executable string, cmd []string) (err error) {
+// RunSpec describes a single execution of an installed app, and is the
+// input to RunApp. Only App is required. Nil readers and writers are
+// connected to the null device, as with exec.Cmd.
+type RunSpec struct {
+	App     string        // name of the installed app
+	Command []string      // replaces the app entrypoint (e.g., for exec)
+	Args    []string      // added to the end of the entrypoint or Command
+	Shell   bool          // run the entrypoint (or Command) as a shell command string
+	Stdin   io.Reader     // standard input for the process
+	Stdout  io.Writer     // standard output for the process
+	Stderr  io.Writer     // standard error for the process
+	Env     []string      // extra KEY=VALUE pairs added to the app environment
+	Dir     string        // working directory, defaults to the entry folder
+	Timeout time.Duration // stop the process after this long (0 is the app timeout)
+
+	Resources  Resources // limits that override those of the app
+	Sandbox    *Sandbox  // run in a sandbox with a read-only base, if set
+	Provenance bool      // write a run record (also set by SCIF_PROVENANCE)
+
+	// Started is called with the pid and the full command once the process
+	// has started, if it's set
+	Started func(pid int, argv []string)
+}
+
+// RunResult is returned by RunApp when the process has finished.
+type RunResult struct {
+	ExitCode int             // exit code of the process, -1 if signaled
+	Signal   syscall.Signal  // signal that ended the process, 0 if none
+	Start    time.Time       // when the process was started
+	End      time.Time       // when the process finished
+	Rusage   *syscall.Rusage // resource usage reported by wait
+	Limit    string          // resource limit that ended the process, if any
+}
+
+// ExitTimeout is the exit status of a run that timed out (as for timeout(1))
+const ExitTimeout = 124
+
+// TimedOut determines if the process was stopped by its timeout
+func (result RunResult) TimedOut() bool {
+	return result.Limit == resourceTimeout
+}
+
+// Status returns an exit status suitable for a shell, meaning the exit code
+// of the process, or 128 + the signal number if it was killed by a signal.
+// A run that timed out is ExitTimeout.
+func (result RunResult) Status() int {
+	if result.TimedOut() {
+		return ExitTimeout
+	}
+	if result.Signal != 0 {
+		return 128 + int(result.Signal)
+	}
+	return result.ExitCode
+}
+
+// Duration returns the wall time of the process
+func (result RunResult) Duration() time.Duration {
+	return result.End.Sub(result.Start)
+}
+
+// RunApp loads the filesystem at Scif.Base, activates an app, and executes
+// its entrypoint (or spec.Command) with the stdio, environment and working
+// directory from the spec. Cancelling the context (or reaching the timeout)
+// kills the process tree, and the timeout (spec.Timeout, or that of the app)
+// stops it. The error is only non-nil if the process could
+// not be run, or was ended by the context; a non-zero exit is reported in
+// the result.
+func RunApp(ctx context.Context, spec RunSpec) (*RunResult, error) {
 
 	// Running an app means we load from the filesystem first
+	unlock := lockState()
+	defer unlock()
 	cli := ScifClient{}.Load(Scif.Base)
 
 	// Ensure that the app exists on the filesystem
-	if ok := util.Contains(name, cli.apps()); !ok {
-		logger.Warningf("%s is not an installed app.", name)
-		return err
+	if ok := util.Contains(spec.App, cli.apps()); !ok {
+		return nil, fmt.Errorf("%s is not an installed app", spec.App)
 	}
 
 	// Activate the app, meaning we set the active app environment
-	cli.activate(name)
+	cli.activate(spec.App)
 
-	// Full path and existence checked by client.execute
-	entrypoint := []string{executable}
-	Scif.EntryPoint = entrypoint
+	// A command replaces the entrypoint set by activate, otherwise the
+	// arguments are checked against the parameters of the app (see args.go)
+	if len(spec.Command) > 0 {
+		Scif.EntryPoint = append([]string{}, spec.Command...)
+	} else {
+		args, env, err := cli.parseAppArgs(spec.App, spec.Args)
+		if err != nil {
+			return nil, err
+		}
+		spec.Args, spec.Env = args, append(spec.Env, env...)
+	}
 
-	// Add additional args to the entrypoint
-	logger.Debugf("Running app %s", name)
+	logger.Debugf("Running app %s", spec.App)
+	return cli.execute(ctx, spec, unlock)
+}
 
-	return cli.execute(name, cmd)
+// stateLock is held while an app is loaded, activated and started, since
+// that changes the (global) client and our environment. It's released once
+// the process is running, so apps (like tests, or a service and its checks)
+// can run at once.
+var stateLock sync.Mutex
+
+// lockState locks the state for an app to be started, and returns the
+// function that unlocks it (which can be called more than once)
+func lockState() func() {
+	stateLock.Lock()
+	var once sync.Once
+	return func() { once.Do(stateLock.Unlock) }
 }
 
-// execute is the (private) function called by run, and client.Execute to
-// execute the current EntryPoint for a particular app. If extra commands
-// are provided, they are added. The environment is ready to go.
-func (client ScifClient) execute(name string, cmd []string) (err error) {
+// Execute some commands to an executable. We first set the EntryPoint to be
+// the executable, and the additional arguments are added by client.execute.
+// The process is connected to the terminal of the calling process.
+func Execute(name string, executable string, cmd []string) (*RunResult, error) {
 
-	// Ensure that the app exists on the filesystem
-	if ok := util.Contains(name, client.apps()); !ok {
-		logger.Exitf("%s does not exist.", name)
+	ctx, cancel := InterruptContext()
+	defer cancel()
+
+	return RunApp(ctx, RunSpec{App: name,
+		Command: []string{executable},
+		Args:    cmd,
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr})
+}
+
+// InterruptContext returns a context that is cancelled when the calling
+// process receives an interrupt or termination signal, so the app we are
+// running doesn't outlive us. Under the init (or scif up), the signal is
+// forwarded to the app (see execute), which can stop as it likes.
+func InterruptContext() (context.Context, context.CancelFunc) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case sig := <-signals:
+
+				// Under the init, the app is sent the signal too
+				if underInit {
+					logger.Debugf("Received %s, forwarded to the app", sig)
+					continue
+				}
+				logger.Debugf("Received %s, stopping app", sig)
+				cancel()
+			case <-ctx.Done():
+			}
+			return
+		}
+	}()
+	return ctx, cancel
+}
+
+// execute is the (private) function called by RunApp and Test to execute
+// the current EntryPoint for a particular app. If extra arguments are
+// provided in the spec they are added. The environment is ready to go. The
+// caller holds the stateLock, and unlock is called once the process has
+// started, as nothing after it uses the state.
+func (client ScifClient) execute(ctx context.Context, spec RunSpec, unlock func()) (*RunResult, error) {
+
+	// Ensure that the app exists on the filesystem (a shell may have none)
+	if ok := util.Contains(spec.App, client.apps()); !ok && spec.App != "" {
+		return nil, fmt.Errorf("%s does not exist", spec.App)
 	}
 
-	// if args are provided, add on to Scif.EntryPoint
-	if len(cmd) > 0 {
-		Scif.EntryPoint = append(Scif.EntryPoint, cmd...)
-		logger.Debugf("Args added to EntryPoint, %v", Scif.EntryPoint)
+	// if args are provided, add on to a copy of Scif.EntryPoint
+	entrypoint := append([]string{}, Scif.EntryPoint...)
+	if len(spec.Args) > 0 {
+		entrypoint = append(entrypoint, spec.Args...)
+		logger.Debugf("Args added to EntryPoint, %v", entrypoint)
 	}
 
-	// Add additional args to the entrypoint
-	logger.Debugf("Executing command %v for app %s", Scif.EntryPoint, name)
+	// A shell command string is run by the app shell, so pipes, redirects
+	// and variables are handled there (in the app environment). Arguments
+	// after it are quoted, so the shell passes them as they are.
+	if spec.Shell {
+		command := entrypoint[0]
+		for _, arg := range entrypoint[1:] {
+			command += " " + util.ShellQuote(arg)
+		}
+		entrypoint = []string{Scif.ShellCmd, "-c", command}
+
+		// The old [e], [pipe], etc. tokens are only replaced if asked for
+	} else if util.HasEntrypointTokens(entrypoint) {
+		if Scif.legacyTokens {
+			logger.Warningf("Tokens like [e] and [pipe] are deprecated, use exec --shell '<command>' instead.")
+			entrypoint = []string{Scif.ShellCmd, "-c", util.ReplaceEntrypointTokens(entrypoint)}
+		} else {
+			logger.Warningf("Tokens like [e] and [pipe] are passed as is, use exec --shell (or SCIF_LEGACY_TOKENS=yes).")
+		}
+	}
+
+	logger.Debugf("Executing command %v for app %s", entrypoint, spec.App)
 
 	// If EntryFolder still not set, just enter to base
 	if Scif.EntryFolder == "" {
 		Scif.EntryFolder = Scif.Base
 	}
 
-	// Change directory to the EntryFolder
-	if err := os.Chdir(Scif.EntryFolder); err != nil {
-		logger.Exitf("%s", err)
+	// The spec can ask for a different working directory
+	dir := Scif.EntryFolder
+	if spec.Dir != "" {
+		dir = spec.Dir
+	}
+
+	// Find the executable (the first in the entrypoint), a shell that isn't
+	// found is the builtin shell (scif itself)
+	executable, err := exec.LookPath(entrypoint[0])
+	if useBuiltinShell(entrypoint[0], err) {
+		executable, err = os.Executable()
+		spec.Env = append(spec.Env, builtinShellEnv+"=1")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Commands (and args) are the remaining of the entrypoint, as they are
+	commands := entrypoint[1:]
+
+	logger.Infof("Executing %s:%s %v", spec.App, executable, commands)
+
+	// Limits for the app can be overridden by the spec
+	resources := client.getResources(spec.App).Merge(spec.Resources)
+	if spec.Timeout > 0 {
+		resources.Timeout = spec.Timeout
+	}
+	if !resources.IsZero() {
+		logger.Debugf("Resource limits for %s: %s", spec.App, resources)
+	}
+
+	// The wall time is a limit we report, separate from the timeout
+	parent := ctx
+	if resources.WallTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, resources.WallTime)
+		defer cancel()
+	}
+
+	// The app leads its own process group, so we can kill everything it
+	// started. An interactive app is given the terminal (its group is the
+	// foreground group) to read it, and we take it back when it exits.
+	terminal := foregroundTerminal(spec.Stdin)
+
+	// Under the init (or scif up), the signals sent to us are for the app
+	var forwarded chan os.Signal
+	if underInit {
+		forwarded = make(chan os.Signal, len(initSignals))
+		signal.Notify(forwarded, initSignals...)
+		defer signal.Stop(forwarded)
+	}
+
+	process, cg, err := client.newProcess(spec, executable, commands, dir, resources, terminal, spec.Sandbox)
+	if err != nil {
+		return nil, err
+	}
+
+	// If namespaces aren't available, we run without the sandbox
+	result := &RunResult{Start: time.Now()}
+	err = process.Start()
+	if err != nil && spec.Sandbox != nil {
+		sandboxWarning(spec.App, err)
+		if cg != nil {
+			cg.remove()
+		}
+		process, cg, err = client.newProcess(spec, executable, commands, dir, resources, terminal, nil)
+		if err == nil {
+			result.Start = time.Now()
+			err = process.Start()
+		}
+	}
+	if cg != nil {
+		defer cg.remove()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A shell (without an app) has nowhere to keep a record
+	argv := append([]string{executable}, commands...)
+	var recorder *runRecorder
+	if (spec.Provenance || Scif.provenance) && spec.App != "" {
+		recorder = client.newRunRecorder(spec, argv, dir)
+	}
+	unlock()
+	if spec.Started != nil {
+		spec.Started(process.Process.Pid, argv)
+	}
+
+	// Kill the process (tree) if the context is done before it exits, or
+	// stop it after the timeout
+	var expired <-chan time.Time
+	if resources.Timeout > 0 {
+		timer := time.NewTimer(resources.Timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	var timedOut int32
+	done := make(chan struct{})
+	if forwarded != nil {
+		go forwardSignals(forwarded, process.Process.Pid, done)
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			logger.Debugf("Killing %s (pid %d): %s", spec.App, process.Process.Pid, ctx.Err())
+			killProcess(process.Process.Pid)
+		case <-expired:
+			atomic.StoreInt32(&timedOut, 1)
+			stopProcess(ctx, process.Process.Pid, done)
+		case <-done:
+		}
+	}()
+
+	err = process.Wait()
+	close(done)
+	result.End = time.Now()
+	if terminal >= 0 {
+		takeTerminal(terminal)
+	}
+
+	// Anything the app started that outlived it after a timeout is killed
+	// (and what left its group, with the cgroup when it's removed)
+	if atomic.LoadInt32(&timedOut) != 0 {
+		killProcess(process.Process.Pid)
 	}
 
-	// Find the executable (the first in the Scif.EntryPoint)
-	executable, err := exec.LookPath(Scif.EntryPoint[0])
+	// A non-zero exit isn't an error in running the app
+	if _, ok := err.(*exec.ExitError); ok {
+		err = nil
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	result.ExitCode = process.ProcessState.ExitCode()
+	if status, ok := process.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		result.Signal = status.Signal()
+	}
+	if rusage, ok := process.ProcessState.SysUsage().(*syscall.Rusage); ok {
+		result.Rusage = rusage
+	}
+
+	// Report if a limit was exceeded (and the process likely killed)
+	if cg != nil {
+		result.Limit = cg.exceeded()
+	}
+	if resources.WallTime > 0 && ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+		result.Limit = resourceWallTime
+	}
+	if atomic.LoadInt32(&timedOut) != 0 {
+		result.Limit = resourceTimeout
+	}
+	if result.TimedOut() {
+		logger.Errorf("%s timed out after %s", spec.App, resources.Timeout)
+	} else if result.Limit != "" {
+		logger.Errorf("%s was stopped by its %s", spec.App, resources.describe(result.Limit))
+	}
+
+	if recorder != nil {
+		recorder.write(result)
+	}
+	if result.Limit != "" {
+		return result, nil
+	}
+
+	// Let the caller know if the context ended the process
+	return result, ctx.Err()
+}
+
+// foregroundTerminal returns the descriptor of the terminal that is stdin,
+// if our process group is its foreground group (so we can give it to the
+// app), or -1
+func foregroundTerminal(stdin io.Reader) int {
+
+	if !util.IsTerminal(stdin) {
+		return -1
+	}
+	fd := int(stdin.(*os.File).Fd())
+	if group, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP); err != nil || group != syscall.Getpgrp() {
+		return -1
+	}
+	return fd
+}
+
+// takeTerminal makes our process group the foreground group of the terminal
+// again, after the app had it. A background group is stopped (SIGTTOU) for
+// this, unless the signal is ignored.
+func takeTerminal(fd int) {
+
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPGRP, syscall.Getpgrp()); err != nil {
+		logger.Warningf("Cannot take back the terminal: %s", err)
+	}
+}
+
+// killProcess kills the process group that a process leads
+func killProcess(pid int) {
+	if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		logger.Warningf("Cannot kill process %d: %s", pid, err)
 	}
+}
 
-	// Commands (and args) are the remaining of the EntryPoint
-	commands := Scif.EntryPoint[1:]
-	commands = util.ParseEntrypointList(commands)
+// stopProcess stops the process group of a process that timed out, with
+// SIGTERM, and SIGKILL if it's still running after the stop timeout, or the
+// context is done. Done is closed when it has exited.
+func stopProcess(ctx context.Context, pid int, done chan struct{}) {
 
-	logger.Infof("Executing %s:%s %v", name, executable, commands)
+	logger.Debugf("Stopping pid %d after its timeout", pid)
+	if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+		logger.Warningf("Cannot stop process %d: %s", pid, err)
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		killProcess(pid)
+	case <-time.After(defaultStopTimeout):
+		logger.Warningf("Process %d is still running %s after its timeout, killing it", pid, defaultStopTimeout)
+		killProcess(pid)
+	}
+}
 
-	// Execute the command
-	process := exec.Command(executable, commands...)
-	process.Stdin = os.Stdin
-	process.Stdout = os.Stdout
-	process.Stderr = os.Stderr
-	err = process.Run()
-	return err
+// newProcess creates the process to run a command for an app. If limits
+// or a sandbox must be set up before the app starts, the process starts
+// scif to do that first. The cgroup (if any) should be removed when the
+// process is done.
+func (client ScifClient) newProcess(spec RunSpec, executable string, args []string, dir string, resources Resources, terminal int, sandbox *Sandbox) (*exec.Cmd, *cgroup, error) {
+
+	// The environment was exported on activate, add extras from the spec
+	process := exec.Command(executable, args...)
+	process.Dir = dir
+	process.Env = append(os.Environ(), spec.Env...)
+	process.Stdin = spec.Stdin
+	process.Stdout = spec.Stdout
+	process.Stderr = spec.Stderr
+	process.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if terminal >= 0 {
+		process.SysProcAttr.Foreground = true
+		process.SysProcAttr.Ctty = terminal
+	}
+
+	config := execConfig{}
+	if resources.NoFile > 0 {
+		config.Rlimits = append(config.Rlimits, execRlimit{unix.RLIMIT_NOFILE, resources.NoFile})
+	}
+
+	// The sandbox is probed first, so the app isn't started in namespaces
+	// where it can't be set up
+	if sandbox != nil {
+		config.Sandbox = client.newSandboxConfig(spec.App, sandbox)
+		err := probeSandbox(sandbox, config.Sandbox)
+		if err == nil {
+			err = sandboxProcess(process, sandbox)
+		}
+		if err != nil {
+			sandboxWarning(spec.App, err)
+			config.Sandbox = nil
+		}
+	}
+
+	// Without a cgroup, memory is limited as the address space (which breaks
+	// some runtimes, like the JVM), and the CPU quota and pids are not
+	cg, err := newCgroup(spec.App, resources)
+	if err != nil {
+		if resources.CPUs > 0 {
+			logger.Warningf("Cannot limit cpus for %s without a cgroup: %s", spec.App, err)
+		}
+		if resources.Pids > 0 {
+			logger.Warningf("Cannot limit pids for %s without a cgroup: %s", spec.App, err)
+		}
+		if resources.Memory > 0 {
+			logger.Debugf("Limiting the address space of %s without a cgroup: %s", spec.App, err)
+		}
+	}
+	if cg != nil {
+		config.Cgroup = cg.path
+	} else if resources.Memory > 0 {
+		config.Rlimits = append(config.Rlimits, execRlimit{unix.RLIMIT_AS, uint64(resources.Memory)})
+	}
+
+	if len(config.Rlimits) == 0 && config.Cgroup == "" && config.Sandbox == nil {
+		return process, nil, nil
+	}
+	if err := wrapProcess(process, config); err != nil {
+		if cg != nil {
+			cg.remove()
+		}
+		return nil, nil, err
+	}
+	return process, cg, nil
 }
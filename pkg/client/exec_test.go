@@ -0,0 +1,161 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRunApp tests running apps with captured output after installing to a
+// temporary base
+func TestRunApp(t *testing.T) {
+
+	// Create faux scif base
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+
+	// This will clean up after
+	defer os.RemoveAll(dir)
+
+	// Set the base, apps, data, for testing
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+
+	// Install recipe to the temporary base
+	err = Install("../../hello-world.scif", []string{}, true)
+	if err != nil {
+		t.Errorf("Error installing temporary SCIF")
+	}
+
+	// Output of the runscript is captured
+	var stdout bytes.Buffer
+	result, err := RunApp(context.Background(), RunSpec{App: "hello-custom",
+		Args:   []string{"pepperoni"},
+		Stdout: &stdout})
+	if err != nil {
+		t.Errorf("Error running hello-custom: %v", err)
+	}
+	if result.ExitCode != 0 {
+		t.Errorf("hello-custom should exit 0, got %d", result.ExitCode)
+	}
+	if strings.TrimSpace(stdout.String()) != "Hello pepperoni" {
+		t.Errorf("Incorrect output, got %q", stdout.String())
+	}
+
+	// Extra environment is added for the process
+	stdout.Reset()
+	_, err = RunApp(context.Background(), RunSpec{App: "hello-custom",
+		Command: []string{"printenv", "PIZZA"},
+		Env:     []string{"PIZZA=pepperoni"},
+		Stdout:  &stdout})
+	if err != nil || strings.TrimSpace(stdout.String()) != "pepperoni" {
+		t.Errorf("Incorrect environment, got %q (%v)", stdout.String(), err)
+	}
+
+	// A shell command has pipes and the app environment, plain argv is exact
+	stdout.Reset()
+	_, err = RunApp(context.Background(), RunSpec{App: "hello-custom",
+		Command: []string{"echo $SCIF_APPNAME | tr a-z A-Z"},
+		Shell:   true,
+		Stdout:  &stdout})
+	if err != nil || strings.TrimSpace(stdout.String()) != "HELLO-CUSTOM" {
+		t.Errorf("Incorrect shell output, got %q (%v)", stdout.String(), err)
+	}
+	stdout.Reset()
+	_, err = RunApp(context.Background(), RunSpec{App: "hello-custom",
+		Command: []string{"echo", "$SCIF_APPNAME", "[pipe]"},
+		Stdout:  &stdout})
+	if err != nil || strings.TrimSpace(stdout.String()) != "$SCIF_APPNAME [pipe]" {
+		t.Errorf("Incorrect exact output, got %q (%v)", stdout.String(), err)
+	}
+
+	// Arguments after a shell command are passed as they are, even with the
+	// legacy tokens
+	stdout.Reset()
+	Scif.legacyTokens = true
+	_, err = RunApp(context.Background(), RunSpec{App: "hello-custom",
+		Command: []string{"printf '%s\\n'"},
+		Args:    []string{"two words", "$HOME;", "[pipe]"},
+		Shell:   true,
+		Stdout:  &stdout})
+	Scif.legacyTokens = false
+	if err != nil || stdout.String() != "two words\n$HOME;\n[pipe]\n" {
+		t.Errorf("Incorrect shell arguments, got %q (%v)", stdout.String(), err)
+	}
+
+	// A non-zero exit is reported in the result, not as an error
+	result, err = RunApp(context.Background(), RunSpec{App: "hello-custom",
+		Command: []string{"sh", "-c", "exit 3"}})
+	if err != nil || result.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %v (%v)", result, err)
+	}
+
+	// A timeout stops the process (tree), and the run timed out
+	result, err = RunApp(context.Background(), RunSpec{App: "hello-custom",
+		Command: []string{"sh", "-c", "sleep 10; echo done"},
+		Timeout: 100 * time.Millisecond})
+	if err != nil || !result.TimedOut() {
+		t.Errorf("Expected a timeout, got %+v (%v)", result, err)
+	}
+	if result.Status() != ExitTimeout || result.Duration() > 5*time.Second {
+		t.Errorf("Expected process to be stopped, got status %d after %s", result.Status(), result.Duration())
+	}
+
+	// The app leads its own process group (its pgid is its pid), and isn't
+	// given a terminal that isn't there
+	stdout.Reset()
+	_, err = RunApp(context.Background(), RunSpec{App: "hello-custom",
+		Command: []string{"sh", "-c", "echo $$; cut -d' ' -f5 /proc/$$/stat"},
+		Stdout:  &stdout})
+	if ids := strings.Fields(stdout.String()); err != nil || len(ids) != 2 || ids[0] != ids[1] {
+		t.Errorf("Expected the app to lead its process group, got %q (%v)", stdout.String(), err)
+	}
+	if fd := foregroundTerminal(&stdout); fd != -1 {
+		t.Errorf("Expected no terminal for a buffer, got %d", fd)
+	}
+
+	// Under the init too, and what it left running is killed after a timeout
+	underInit = true
+	stdout.Reset()
+	result, err = RunApp(context.Background(), RunSpec{App: "hello-custom",
+		Command: []string{"sh", "-c", "sleep 30 & echo $!; sleep 10"},
+		Stdout:  &stdout,
+		Timeout: 100 * time.Millisecond})
+	underInit = false
+	if err != nil || !result.TimedOut() || result.Duration() > 5*time.Second {
+		t.Errorf("Expected a timeout under the init, got %+v (%v)", result, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	stat, _ := ioutil.ReadFile(filepath.Join("/proc", strings.TrimSpace(stdout.String()), "stat"))
+	if fields := strings.Fields(string(stat)); len(fields) > 2 && fields[2] != "Z" {
+		t.Errorf("Expected the background process to be killed, got %s", stat)
+	}
+
+	// An app that isn't installed is an error
+	if _, err = RunApp(context.Background(), RunSpec{App: "hello-nobody"}); err == nil {
+		t.Errorf("Expected error running an app that isn't installed")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"strings"
 
 	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/util"
 )
 
 // PrintConfig will print the configuration
@@ -34,13 +35,39 @@ func (client ScifClient) PrintConfig() {
 // PrintAppConfig will print the configuration for a single app
 func (client ScifClient) printAppConfig(name string, settings AppSettings) {
 
-	printDefined("%apprun", name, settings.runscript)
+	printDefined("%apprun", settings.header("apprun", name), settings.runscript)
+	client.printInterpreter(name, "apprun")
+	printDefined("%appentrypoint", name, settings.entrypoint)
+	printDefined("%appworkdir", name, settings.workdir)
 	printDefined("%appinstall", name, settings.install)
 	printDefined("%appenv", name, settings.environ)
 	printDefined("%applabels", name, settings.labels)
 	printDefined("%appfiles", name, settings.files)
 	printDefined("%apphelp", name, settings.help)
-	printDefined("%apptest", name, settings.test)
+	printDefined("%apptest", settings.header("apptest", name), settings.test)
+	client.printInterpreter(name, "apptest")
+	printTestCases(name, settings)
+	printDefined("%apptestfiles", name, settings.testfiles)
+	printDefined("%appresources", name, settings.resources)
+	printDefined("%appservice", name, settings.service)
+	printDefined("%apphealth", name, settings.health)
+	printDefined("%appargs", name, settings.args)
+}
+
+// printInterpreter prints what runs the script of a section, if it's defined
+func (client ScifClient) printInterpreter(name string, section string) {
+	if interpreter, source := client.effectiveInterpreter(name, section); interpreter != "" {
+		fmt.Printf("# %s interpreter: %s (%s)\n", section, interpreter, source)
+	}
+}
+
+// header returns the name of an app for a section header, with the options
+// of the section (e.g., the interpreter for %apprun)
+func (settings AppSettings) header(section string, name string) string {
+	if interpreter := settings.interpreter[section]; interpreter != "" {
+		return name + " --interpreter " + util.ShellQuote(interpreter)
+	}
+	return name
 }
 
 // printIfDefined will print a section if it is non empty
@@ -50,6 +77,13 @@ func printDefined(prefix string, name string, settings []string) {
 	}
 }
 
+// printTestCases prints the named test cases of an app
+func printTestCases(name string, settings AppSettings) {
+	for _, test := range settings.cases {
+		printDefined("%apptest", test.header(name), test.script)
+	}
+}
+
 // printAppPreview shows the root, lib, bin, and data for a single app
 func (client ScifClient) printAppPreview(name string) {
 
@@ -76,13 +110,23 @@ func (client ScifClient) exportAppLines(name string) []string {
 	lines = append(lines, header)
 
 	// Add each list of lines from the section
-	lines = exportAppSection("%apprun", name, settings.runscript, lines)
+	lines = exportAppSection("%apprun", settings.header("apprun", name), settings.runscript, lines)
+	lines = exportAppSection("%appentrypoint", name, settings.entrypoint, lines)
+	lines = exportAppSection("%appworkdir", name, settings.workdir, lines)
 	lines = exportAppSection("%appinstall", name, settings.install, lines)
 	lines = exportAppSection("%appenv", name, settings.environ, lines)
 	lines = exportAppSection("%applabels", name, settings.labels, lines)
 	lines = exportAppSection("%appfiles", name, settings.files, lines)
 	lines = exportAppSection("%apphelp", name, settings.help, lines)
-	lines = exportAppSection("%apptest", name, settings.test, lines)
+	lines = exportAppSection("%apptest", settings.header("apptest", name), settings.test, lines)
+	for _, test := range settings.cases {
+		lines = exportAppSection("%apptest", test.header(name), test.script, lines)
+	}
+	lines = exportAppSection("%apptestfiles", name, settings.testfiles, lines)
+	lines = exportAppSection("%appresources", name, settings.resources, lines)
+	lines = exportAppSection("%appservice", name, settings.service, lines)
+	lines = exportAppSection("%apphealth", name, settings.health, lines)
+	lines = exportAppSection("%appargs", name, settings.args, lines)
 
 	return lines
 }
@@ -0,0 +1,352 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+)
+
+// scif graph shows how apps use each other, as Graphviz DOT or Mermaid. An
+// app uses another when a section of its recipe refers to one of the
+// variables of the other app (e.g., $SCIF_APPRUN_align or ${SCIF_APPBIN_bwa}),
+// with the dashes of the name as they are or as underscores. A workflow
+// declares dependencies: a step needs others, so its app needs their apps,
+// and it uses the apps of variables in its arguments, inputs and outputs.
+//
+//	digraph scif {
+//		"report" -> "align" [label="apprun"];
+//		"report" -> "index" [label="needs: pipeline", style=dashed];
+//	}
+//
+// An edge goes from an app to the app it uses (or needs).
+
+// Formats for the graph
+const (
+	GraphDOT     = "dot"
+	GraphMermaid = "mermaid"
+)
+
+// Kinds of edges of the graph
+const (
+	edgeUses  = "uses"  // through variables, in sections or workflow steps
+	edgeNeeds = "needs" // declared by a workflow
+)
+
+// GraphOptions are how the graph is made and printed
+type GraphOptions struct {
+	File   string // a recipe to graph instead of the installed apps
+	Format string // dot (default) or mermaid
+}
+
+// AppGraph is the apps (nodes), and how they use each other (edges)
+type AppGraph struct {
+	Nodes []string
+	Edges []GraphEdge
+}
+
+// GraphEdge is an app that uses or needs another, with the sections (or
+// workflows) where it does
+type GraphEdge struct {
+	From string
+	To   string
+	Kind string
+	Via  []string
+}
+
+// graphSections are the sections scanned for variables of other apps
+var graphSections = []string{"apprun", "appinstall", "appenv", "apptest",
+	"appentrypoint", "appservice", "apphealth"}
+
+// graphVariable is a variable of an app, e.g., SCIF_APPDATA_align
+var graphVariable = regexp.MustCompile(`SCIF_(APP[A-Z]+)_([A-Za-z0-9_.-]+)`)
+
+// Graph prints how apps use each other (all apps if there are none, or
+// the apps given and those they are connected to).
+func Graph(names []string, options GraphOptions) error {
+
+	if options.Format == "" {
+		options.Format = GraphDOT
+	}
+	if options.Format != GraphDOT && options.Format != GraphMermaid {
+		return fmt.Errorf("%s is not a format (dot or mermaid)", options.Format)
+	}
+
+	cli := ScifClient{}.Load(options.File)
+	apps := cli.apps()
+	for _, name := range names {
+		if _, ok := Scif.config[name]; !ok {
+			return fmt.Errorf("%s is not an app", name)
+		}
+	}
+
+	graph := newAppGraph(apps, Scif.config, Scif.workflows).connectedTo(names)
+	if options.Format == GraphMermaid {
+		return graph.writeMermaid(os.Stdout)
+	}
+	return graph.writeDOT(os.Stdout)
+}
+
+// newAppGraph finds the edges between apps, from the sections of their
+// settings and from the workflows
+func newAppGraph(apps []string, config map[string]AppSettings, workflows map[string][]string) AppGraph {
+
+	edges := map[[3]string]map[string]bool{}
+	addEdge := func(from string, to string, kind string, via string) {
+		if from == to {
+			return
+		}
+		key := [3]string{from, to, kind}
+		if edges[key] == nil {
+			edges[key] = map[string]bool{}
+		}
+		edges[key][via] = true
+	}
+
+	for _, name := range apps {
+		settings := config[name]
+		sections := settings.sections()
+
+		// The environment is added to the runscript and test when loaded
+		sections["apprun"] = withoutPrefix(settings.runscript, settings.environ)
+		sections["apptest"] = withoutPrefix(settings.test, settings.environ)
+
+		for _, section := range graphSections {
+			for _, other := range appReferences(sections[section], apps) {
+				addEdge(name, other, edgeUses, section)
+			}
+		}
+	}
+
+	// Workflows (and the apps of their steps) are read in order of their names
+	var names []string
+	for name := range workflows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	nodes := map[string]bool{}
+	for _, name := range apps {
+		nodes[name] = true
+	}
+	for _, name := range names {
+		workflow, err := parseWorkflow(name, workflows[name])
+		if err != nil {
+			logger.Warningf("%s", err)
+			continue
+		}
+		for _, step := range workflow.Steps {
+			nodes[step.App] = true
+			for _, need := range step.Needs {
+				if needed := workflow.getStep(need); needed != nil {
+					addEdge(step.App, needed.App, edgeNeeds, name)
+				}
+			}
+			lines := append(append(append([]string{}, step.Args...), step.Inputs...), step.Outputs...)
+			for _, other := range appReferences(lines, apps) {
+				addEdge(step.App, other, edgeUses, "workflow "+name)
+			}
+		}
+	}
+
+	graph := AppGraph{Nodes: []string{}, Edges: []GraphEdge{}}
+	for node := range nodes {
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	sort.Strings(graph.Nodes)
+
+	for key, via := range edges {
+		edge := GraphEdge{From: key[0], To: key[1], Kind: key[2]}
+		for name := range via {
+			edge.Via = append(edge.Via, name)
+		}
+		sort.Strings(edge.Via)
+		graph.Edges = append(graph.Edges, edge)
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		one, two := graph.Edges[i], graph.Edges[j]
+		if one.From != two.From {
+			return one.From < two.From
+		}
+		if one.To != two.To {
+			return one.To < two.To
+		}
+		return one.Kind > two.Kind
+	})
+	return graph
+}
+
+// appReferences returns the apps whose variables are in lines. The name in
+// a variable can have underscores for dashes (SCIF_APPRUN_hello_world).
+func appReferences(lines []string, apps []string) []string {
+
+	// Variables use the name with underscores for dashes, so hello-world and
+	// hello_world have the same one: the exact name wins over the other
+	exact := map[string]bool{}
+	for _, app := range apps {
+		exact[app] = true
+	}
+	underscored := map[string]string{}
+	for _, app := range apps {
+		name := strings.Replace(app, "-", "_", -1)
+		if _, ok := underscored[name]; !ok {
+			underscored[name] = app
+		}
+	}
+
+	found := map[string]bool{}
+	for _, line := range lines {
+		for _, match := range graphVariable.FindAllStringSubmatch(line, -1) {
+			if app, ok := matchApp(match[2], exact, underscored); ok {
+				found[app] = true
+			}
+		}
+	}
+
+	var references []string
+	for app := range found {
+		references = append(references, app)
+	}
+	sort.Strings(references)
+	return references
+}
+
+// matchApp finds the app of a variable name. A variable can be followed by
+// text (e.g., $SCIF_APPDATA_reads/x or $SCIF_APPDATA_reads_), so the
+// trailing . - and _ are dropped one at a time until an app is found.
+func matchApp(name string, exact map[string]bool, underscored map[string]string) (string, bool) {
+
+	for name != "" {
+		if exact[name] {
+			return name, true
+		}
+		if app, ok := underscored[name]; ok {
+			return app, true
+		}
+		if !strings.ContainsAny(name[len(name)-1:], ".-_") {
+			break
+		}
+		name = name[:len(name)-1]
+	}
+	return "", false
+}
+
+// withoutPrefix returns lines without the prefix, if they start with it
+func withoutPrefix(lines []string, prefix []string) []string {
+
+	if len(prefix) == 0 || len(lines) < len(prefix) {
+		return lines
+	}
+	for i := range prefix {
+		if lines[i] != prefix[i] {
+			return lines
+		}
+	}
+	return lines[len(prefix):]
+}
+
+// connectedTo returns the graph of the apps, and the edges to or from them.
+// Without apps, it's the whole graph.
+func (graph AppGraph) connectedTo(apps []string) AppGraph {
+
+	if len(apps) == 0 {
+		return graph
+	}
+	nodes := map[string]bool{}
+	for _, app := range apps {
+		nodes[app] = true
+	}
+
+	connected := AppGraph{Nodes: []string{}, Edges: []GraphEdge{}}
+	for _, edge := range graph.Edges {
+		if nodes[edge.From] || nodes[edge.To] {
+			connected.Edges = append(connected.Edges, edge)
+		}
+	}
+	for _, edge := range connected.Edges {
+		nodes[edge.From], nodes[edge.To] = true, true
+	}
+	for _, node := range graph.Nodes {
+		if nodes[node] {
+			connected.Nodes = append(connected.Nodes, node)
+		}
+	}
+	return connected
+}
+
+// label is the label of an edge, e.g., "apprun, appenv" or "needs: pipeline"
+func (edge GraphEdge) label() string {
+	if edge.Kind == edgeNeeds {
+		return "needs: " + strings.Join(edge.Via, ", ")
+	}
+	return strings.Join(edge.Via, ", ")
+}
+
+// writeDOT writes the graph for Graphviz (e.g., dot -Tsvg)
+func (graph AppGraph) writeDOT(writer io.Writer) error {
+
+	fmt.Fprintln(writer, "digraph scif {")
+	fmt.Fprintln(writer, "\trankdir=LR;")
+	fmt.Fprintln(writer, "\tnode [shape=box];")
+	for _, node := range graph.Nodes {
+		fmt.Fprintf(writer, "\t%s;\n", dotQuote(node))
+	}
+	for _, edge := range graph.Edges {
+		style := ""
+		if edge.Kind == edgeNeeds {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(writer, "\t%s -> %s [label=%s%s];\n", dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.label()), style)
+	}
+	_, err := fmt.Fprintln(writer, "}")
+	return err
+}
+
+// writeMermaid writes the graph as a Mermaid flowchart. Nodes have ids
+// (n0, n1...) since app names can have dashes, which Mermaid reads as links.
+func (graph AppGraph) writeMermaid(writer io.Writer) error {
+
+	ids := map[string]string{}
+	fmt.Fprintln(writer, "graph LR")
+	for i, node := range graph.Nodes {
+		ids[node] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(writer, "    %s[%s]\n", ids[node], mermaidQuote(node))
+	}
+	for _, edge := range graph.Edges {
+		link := "-->"
+		if edge.Kind == edgeNeeds {
+			link = "-.->"
+		}
+		fmt.Fprintf(writer, "    %s %s|%s| %s\n", ids[edge.From], link, mermaidQuote(edge.label()), ids[edge.To])
+	}
+	return nil
+}
+
+// dotQuote quotes a string for DOT
+func dotQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// mermaidQuote quotes a string for Mermaid, which has entities for quotes
+func mermaidQuote(value string) string {
+	return `"` + strings.Replace(value, `"`, "#quot;", -1) + `"`
+}
@@ -0,0 +1,124 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestAppGraph tests finding how apps use each other
+func TestAppGraph(t *testing.T) {
+
+	environ := []string{"INDEX=$SCIF_APPDATA_bwa_index/ref.fa"}
+	config := map[string]AppSettings{
+		"bwa-index": {runscript: []string{"bwa index \"$@\""}},
+		"bwa-align": {environ: environ,
+			runscript: append(append([]string{}, environ...), "exec $SCIF_APPBIN_bwa-index/bwa mem \"$@\"")},
+		"multiqc": {runscript: []string{"${SCIF_APPRUN_bwa_align} --version", "echo $SCIF_APPNAME_multiqc"},
+			install: []string{"cp $SCIF_APPROOT_bwa-index/x $SCIF_APPDATA_missing"}},
+	}
+	workflows := map[string][]string{"pipeline": {
+		"step index bwa-index ref.fa",
+		"step align bwa-align sample.fq",
+		"step report multiqc $SCIF_APPDATA_bwa-align",
+		"step lint samtools",
+		"needs align index",
+		"needs report align",
+	}}
+
+	graph := newAppGraph([]string{"bwa-index", "bwa-align", "multiqc"}, config, workflows)
+	if !Equal(graph.Nodes, []string{"bwa-align", "bwa-index", "multiqc", "samtools"}) {
+		t.Errorf("Incorrect nodes, got %v", graph.Nodes)
+	}
+
+	var edges []string
+	for _, edge := range graph.Edges {
+		edges = append(edges, edge.From+" "+edge.Kind+" "+edge.To+" ("+edge.label()+")")
+	}
+	expected := []string{
+		"bwa-align uses bwa-index (appenv, apprun)",
+		"bwa-align needs bwa-index (needs: pipeline)",
+		"multiqc uses bwa-align (apprun, workflow pipeline)",
+		"multiqc needs bwa-align (needs: pipeline)",
+		"multiqc uses bwa-index (appinstall)",
+	}
+	if !Equal(edges, expected) {
+		t.Errorf("Incorrect edges, got %v, want %v", edges, expected)
+	}
+
+	// Only the apps connected to bwa-index
+	connected := graph.connectedTo([]string{"bwa-index"})
+	if !Equal(connected.Nodes, []string{"bwa-align", "bwa-index", "multiqc"}) || len(connected.Edges) != 3 {
+		t.Errorf("Incorrect connected graph, got %v and %v", connected.Nodes, connected.Edges)
+	}
+
+	var dot bytes.Buffer
+	if err := graph.writeDOT(&dot); err != nil {
+		t.Errorf("Error writing DOT: %v", err)
+	}
+	if !strings.Contains(dot.String(), `"bwa-align" -> "bwa-index" [label="needs: pipeline", style=dashed];`) {
+		t.Errorf("Incorrect DOT, got %s", dot.String())
+	}
+
+	var mermaid bytes.Buffer
+	if err := graph.writeMermaid(&mermaid); err != nil {
+		t.Errorf("Error writing Mermaid: %v", err)
+	}
+	for _, line := range []string{`n0["bwa-align"]`, `n2 -->|"appinstall"| n1`, `n0 -.->|"needs: pipeline"| n1`} {
+		if !strings.Contains(mermaid.String(), line) {
+			t.Errorf("Expected %s in Mermaid, got %s", line, mermaid.String())
+		}
+	}
+}
+
+// TestAppReferences tests finding the variables of apps in lines
+func TestAppReferences(t *testing.T) {
+
+	apps := []string{"align", "hello-world", "hello"}
+	var tests = []struct {
+		line     string
+		expected []string
+	}{
+		{"$SCIF_APPRUN_align", []string{"align"}},
+		{"cat ${SCIF_APPDATA_hello_world}/x $SCIF_APPBIN_hello/y", []string{"hello", "hello-world"}},
+		{"$SCIF_APPDATA_hello-world.", []string{"hello-world"}},
+		{"$SCIF_APPDATA_aligner $SCIF_DATA $SCIF_APPNAME", nil},
+	}
+	for _, tt := range tests {
+		if references := appReferences([]string{tt.line}, apps); !Equal(references, tt.expected) {
+			t.Errorf("%s: got %v, want %v", tt.line, references, tt.expected)
+		}
+	}
+
+	// Names that have the same variable prefer the exact name
+	apps = []string{"a-b", "a_b", "x", "x-"}
+	tests = []struct {
+		line     string
+		expected []string
+	}{
+		{"$SCIF_APPDATA_a_b", []string{"a_b"}},
+		{"$SCIF_APPDATA_a-b/x", []string{"a-b"}},
+		{"$SCIF_APPDATA_x_/data", []string{"x-"}},
+		{"$SCIF_APPDATA_x.", []string{"x"}},
+	}
+	for _, tt := range tests {
+		if references := appReferences([]string{tt.line}, apps); !Equal(references, tt.expected) {
+			t.Errorf("%s: got %v, want %v", tt.line, references, tt.expected)
+		}
+	}
+}
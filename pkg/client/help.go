@@ -16,7 +16,10 @@
 package client
 
 import (
+	"fmt"
 	"os"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/sci-f/scif-go/internal/pkg/logger"
 	"github.com/sci-f/scif-go/pkg/util"
@@ -42,11 +45,49 @@ func Help(args []string) (err error) {
 		// Get settings, look for help script
 		lookup := cli.getAppenvLookup(name)
 
+		// The parameters are shown after the help (or instead of it)
+		args, err := cli.getArgs(name)
+		if err != nil {
+			return err
+		}
+
 		if _, err := os.Stat(lookup["apphelp"]); os.IsNotExist(err) {
-			logger.Infof("No help exists for %s", name)
+			if len(args) == 0 {
+				logger.Infof("No help exists for %s", name)
+			}
 		} else {
 			printDefined("%apphelp", name, Scif.config[name].help)
 		}
+		if len(args) > 0 {
+			printArgs(name, args)
+		}
 	}
 	return err
 }
+
+// printArgs prints a table of the parameters of an app, from %appargs
+func printArgs(name string, args []AppArg) {
+
+	fmt.Printf("\nUsage: scif run %s [--<arg> <value>...] [-- args...]\n\n", name)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "  ARGUMENT\tTYPE\tDEFAULT\tVARIABLE\tHELP")
+	for _, arg := range args {
+
+		flag := strings.TrimSpace("--" + arg.Name + " " + arg.Metavar())
+		kind := arg.Type
+		if arg.Positional {
+			kind += " (positional)"
+		}
+
+		value := "-"
+		if arg.Required {
+			value = "(required)"
+		} else if arg.Default != nil {
+			value = *arg.Default
+		} else if arg.Type == argBool {
+			value = "false"
+		}
+		fmt.Fprintf(writer, "  %s\t%s\t%s\t%s\t%s\n", flag, kind, value, arg.Variable(), arg.Help)
+	}
+	writer.Flush()
+}
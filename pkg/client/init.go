@@ -0,0 +1,129 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/util"
+)
+
+// When scif is the entrypoint of a container it runs as PID 1, which must
+// reap the processes orphaned in the container (or they are left zombies),
+// and has no default action for signals (so docker stop waits, and kills
+// it). For this, scif as PID 1 is a minimal init: it starts scif again with
+// the same arguments, forwards signals to it, and reaps all processes until
+// it exits (SCIF_INIT=no turns this off). The main of scif checks for this
+// (with IsInit) before anything else.
+//
+// The scif started by the init (or by scif up) forwards the signals it's
+// sent to the app, which leads its own process group (as it does otherwise),
+// so the app can stop as it likes, and what it started is killed with it
+// after a timeout.
+
+// initChildEnv marks scif started by the init (or scif up)
+const initChildEnv = "SCIF_INIT_CHILD"
+
+// underInit is true for scif started by the init (or scif up)
+var underInit bool
+
+// initSignals are forwarded by the init to the process group of scif
+var initSignals = []os.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP,
+	syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGWINCH}
+
+// IsInit returns true if scif should act as the init. It's checked by the
+// main of scif, not here, so a program that imports the client (and runs
+// as PID 1) isn't taken over.
+func IsInit() bool {
+	return os.Getpid() == 1 && getBoolEnv("SCIF_INIT", getBoolDefault("INIT"))
+}
+
+// RunInit runs scif (with the arguments) as the child of the init, and
+// returns its exit status once it exits
+func RunInit(args []string) int {
+
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scif: %s\n", err)
+		return 1
+	}
+
+	// Signals are handled before the child starts, so none are missed
+	signals := make(chan os.Signal, 32)
+	signal.Notify(signals, append(initSignals, syscall.SIGCHLD)...)
+
+	// With a terminal, the child must be the foreground group to read it
+	child := exec.Command(self, args[1:]...)
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+	child.Env = append(os.Environ(), initChildEnv+"=1")
+	child.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if util.IsTerminal(os.Stdin) {
+		child.SysProcAttr.Foreground = true
+		child.SysProcAttr.Ctty = int(os.Stdin.Fd())
+	}
+	if err := child.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "scif: %s\n", err)
+		return 1
+	}
+	pid := child.Process.Pid
+
+	for sig := range signals {
+		if sig != syscall.SIGCHLD {
+			syscall.Kill(-pid, sig.(syscall.Signal))
+			continue
+		}
+
+		// Reap all that have exited: the child, and orphans reparented to us
+		for {
+			var status syscall.WaitStatus
+			reaped, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+			if err != nil || reaped <= 0 {
+				break
+			}
+			if reaped == pid {
+				return waitStatus(status)
+			}
+		}
+	}
+	return 1
+}
+
+// forwardSignals sends the signals for scif under the init (or scif up) to
+// the process group of the app, until done is closed
+func forwardSignals(signals chan os.Signal, pid int, done chan struct{}) {
+	for {
+		select {
+		case sig := <-signals:
+			logger.Debugf("Forwarding %s to pid %d", sig, pid)
+			syscall.Kill(-pid, sig.(syscall.Signal))
+		case <-done:
+			return
+		}
+	}
+}
+
+// waitStatus returns the exit status for a shell from a wait status
+func waitStatus(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
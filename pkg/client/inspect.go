@@ -18,6 +18,8 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/sci-f/scif-go/internal/pkg/logger"
 	"github.com/sci-f/scif-go/pkg/util"
@@ -25,28 +27,35 @@ import (
 
 // Inspect one or more apps for a scientific filesystem. If None defined, inspect all.
 // The boolean for "all" trumps all other settings.
-func Inspect(name string, runscript bool, environ bool, labels bool, install bool, files bool, test bool, all bool, printJson bool) (err error) {
+func Inspect(names []string, runscript bool, environ bool, labels bool, install bool, files bool, test bool, all bool, printJson bool) (err error) {
 
 	// Running an app means we load from the filesystem first
 	cli := ScifClient{}.Load(Scif.Base)
+	if len(names) == 0 {
+		names = AppNames()
+	}
 
-	// Ensure that the app exists on the filesystem
-	if ok := util.Contains(name, cli.apps()); ok {
+	// The JSON document has all the apps
+	if printJson {
+		document := cli.inspectDocument(names, runscript, environ, labels, install, files, test, all)
+		result, err := json.MarshalIndent(document, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(result))
+		return nil
+	}
 
-		// inspect the app, with Json or Not
-		if printJson {
-			err := cli.inspect(name, runscript, environ, labels, install, files, test, all)
-			if err != nil {
+	for _, name := range names {
+
+		// Ensure that the app exists on the filesystem
+		if ok := util.Contains(name, cli.apps()); ok {
+			if err := cli.inspect(name, runscript, environ, labels, install, files, test, all); err != nil {
 				return err
 			}
 		} else {
-			cli.inspectJson(name, runscript, environ, labels, install, files, test, all)
-			if err != nil {
-				return err
-			}
+			logger.Warningf("%s is not an installed application.", name)
 		}
-	} else {
-		logger.Warningf("%s is not an installed application.", name)
 	}
 	return err
 }
@@ -67,7 +76,13 @@ func (client ScifClient) inspect(name string, runscript bool, environ bool, labe
 
 		if runscript {
 			printDefined("%apphelp", name, settings.help)
-			printDefined("%apprun", name, settings.runscript)
+			printDefined("%apprun", settings.header("apprun", name), settings.runscript)
+			client.printInterpreter(name, "apprun")
+			printDefined("%appentrypoint", name, settings.entrypoint)
+			printDefined("%appworkdir", name, settings.workdir)
+			printDefined("%appservice", name, settings.service)
+			printDefined("%apphealth", name, settings.health)
+			printDefined("%appargs", name, settings.args)
 			nothingPrinted = false
 		}
 		if install {
@@ -87,7 +102,10 @@ func (client ScifClient) inspect(name string, runscript bool, environ bool, labe
 			nothingPrinted = false
 		}
 		if test {
-			printDefined("%apptest", name, settings.test)
+			printDefined("%apptest", settings.header("apptest", name), settings.test)
+			client.printInterpreter(name, "apptest")
+			printTestCases(name, settings)
+			printDefined("%apptestfiles", name, settings.testfiles)
 			nothingPrinted = false
 		}
 	}
@@ -99,63 +117,123 @@ func (client ScifClient) inspect(name string, runscript bool, environ bool, labe
 	return err
 }
 
-// inspectJson more cleanly uses the Struct to print json to the screen. We
-// do this by copying the AppSettings, and then removing sections that aren't
-// wanted. We use the Json API specification for formatting https://jsonapi.org/
-func (client ScifClient) inspectJson(name string, runscript bool, environ bool, labels bool, install bool, files bool, test bool, all bool) (err error) {
-
-	// Put settings into a map so we can manipulate it
-	settings := make(map[string][]string)
-	settings["runscript"] = Scif.config[name].runscript
-	settings["install"] = Scif.config[name].install
-	settings["labels"] = Scif.config[name].labels
-	settings["environ"] = Scif.config[name].environ
-	settings["files"] = Scif.config[name].files
-	settings["test"] = Scif.config[name].test
-
-	// Edit settings (removing those not selected) based on user selection
-	if !all {
-
-		if !runscript {
-			delete(settings, "runscript")
-		}
-		if !install {
-			delete(settings, "install")
-		}
-		if !labels {
-			delete(settings, "labels")
-		}
-		if !environ {
-			delete(settings, "environ")
-		}
-		if !files {
-			delete(settings, "files")
-		}
-		if !test {
-			delete(settings, "test")
-		}
-	}
+// InspectSchemaVersion is the version of the JSON document of scif inspect.
+// It only changes when a field is removed, or its meaning changes.
+const InspectSchemaVersion = 1
+
+// InspectDocument is the JSON document of scif inspect --json. It follows
+// the JSON API specification (https://jsonapi.org/), with a resource for
+// each app, in the order they were asked for, and the version and base in
+// the meta. See docs/usage.md for an example.
+type InspectDocument struct {
+	Meta InspectMeta       `json:"meta"`
+	Data []InspectResource `json:"data"`
+}
 
-	// Attributes (the app settings) are stored here
-	type Attributes struct {
-		Data     map[string][]string `json:"attributes"`
-		dataType string              `json:"type"`
-	}
+// InspectMeta is about the InspectDocument as a whole
+type InspectMeta struct {
+	Version int    `json:"schema_version"`
+	Base    string `json:"base"` // the scif base
+}
 
-	// We want to mimic the json specification for web APIs
-	type JsonData struct {
-		Data Attributes `json:"data"`
-	}
+// InspectResource is an app in the InspectDocument
+type InspectResource struct {
+	Type       string            `json:"type"` // always "app"
+	ID         string            `json:"id"`   // the name of the app
+	Attributes InspectAttributes `json:"attributes"`
+}
+
+// InspectAttributes are what is known of an app. The sections are those that
+// are defined (and asked for), by name (e.g., apprun). Everything else is
+// always there, empty if the app isn't installed.
+type InspectAttributes struct {
+	Installed    bool                `json:"installed"`
+	Sections     map[string][]string `json:"sections"`
+	Interpreters map[string]string   `json:"interpreters"` // by section
+	Tests        []InspectTestCase   `json:"tests"`        // named test cases
+	Labels       map[string]string   `json:"labels"`
+	Paths        map[string]string   `json:"paths"`       // SCIF_APPROOT, SCIF_APPBIN, etc.
+	Commands     []string            `json:"commands"`    // the executables in SCIF_APPBIN
+	Files        InspectUsage        `json:"files"`       // in the app root
+	Data         InspectUsage        `json:"data"`        // in the app data folder
+	RecipeHash   string              `json:"recipe_hash"` // as in a run record
+}
+
+// InspectTestCase is a named test case of an app (see testcases.go)
+type InspectTestCase struct {
+	Name    string            `json:"name"`
+	Options map[string]string `json:"options"`
+	Script  []string          `json:"script"`
+}
+
+// InspectUsage is the number of (regular) files in a folder, and their size
+type InspectUsage struct {
+	Count int64 `json:"count"`
+	Size  int64 `json:"size"` // in bytes
+}
 
-	attributes := Attributes{Data: settings, dataType: "container"}
-	data := JsonData{Data: attributes}
+// inspectDocument returns the JSON document for apps, with the sections that
+// are asked for (or all of them)
+func (client ScifClient) inspectDocument(names []string, runscript bool, environ bool, labels bool, install bool, files bool, test bool, all bool) InspectDocument {
 
-	result, err := json.MarshalIndent(data, "", "\t")
-	if err != nil {
-		return err
+	// Sections are selected like for the text output
+	selected := map[string]bool{
+		"apphelp": runscript, "apprun": runscript, "appentrypoint": runscript, "appworkdir": runscript,
+		"appservice": runscript, "apphealth": runscript, "appargs": runscript,
+		"appinstall": install, "applabels": labels, "appenv": environ, "appfiles": files,
+		"apptest": test, "apptestfiles": test, "appresources": all,
 	}
 
-	// Show the result to the user
-	fmt.Println(string(result))
-	return err
+	document := InspectDocument{Meta: InspectMeta{Version: InspectSchemaVersion, Base: Scif.Base}, Data: []InspectResource{}}
+	for _, name := range names {
+
+		attributes := InspectAttributes{Sections: map[string][]string{},
+			Interpreters: map[string]string{},
+			Tests:        []InspectTestCase{},
+			Labels:       map[string]string{},
+			Paths:        map[string]string{},
+			Commands:     []string{}}
+
+		if util.Contains(name, client.apps()) {
+
+			settings := Scif.config[name]
+			for section, lines := range settings.sections() {
+				if len(lines) > 0 && (all || selected[section]) {
+					attributes.Sections[section] = lines
+				}
+			}
+			for _, section := range []string{"apprun", "apptest"} {
+				if interpreter, _ := client.effectiveInterpreter(name, section); interpreter != "" && (all || selected[section]) {
+					attributes.Interpreters[section] = interpreter
+				}
+			}
+			if all || test {
+				for _, test := range settings.cases {
+					attributes.Tests = append(attributes.Tests, InspectTestCase{Name: test.name, Options: test.options, Script: test.script})
+				}
+			}
+			for key, value := range parseKeyValues(settings.labels) {
+				attributes.Labels[key] = value
+			}
+
+			lookup := client.getAppenvLookup(name)
+			for _, key := range client.getAppenvKeys() {
+				if key != "appname" {
+					attributes.Paths["SCIF_"+strings.ToUpper(key)] = lookup[key]
+				}
+			}
+
+			// An app is installed if its recipe was, which is the last step
+			if _, err := os.Stat(lookup["apprecipe"]); err == nil {
+				attributes.Installed = true
+				attributes.RecipeHash = hashFile(lookup["apprecipe"])
+			}
+			attributes.Commands = append(attributes.Commands, client.appCommands(name, "")...)
+			attributes.Files = diskUsage(lookup["approot"])
+			attributes.Data = diskUsage(lookup["appdata"])
+		}
+
+		document.Data = append(document.Data, InspectResource{Type: "app", ID: name, Attributes: attributes})
+	}
+	return document
 }
@@ -0,0 +1,71 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestInspectDocument tests the JSON document of inspect
+func TestInspectDocument(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+	if err := Install("../../hello-world.scif", []string{}, true); err != nil {
+		t.Errorf("Error installing temporary SCIF: %v", err)
+	}
+
+	cli := ScifClient{}.Load(Scif.Base)
+	document := cli.inspectDocument([]string{"hello-world-env", "doesnt-exist"}, false, true, false, false, false, false, false)
+	if document.Meta.Version != InspectSchemaVersion || len(document.Data) != 2 {
+		t.Errorf("Incorrect document %+v", document)
+	}
+
+	app := document.Data[0]
+	if app.Type != "app" || app.ID != "hello-world-env" || !app.Attributes.Installed {
+		t.Errorf("Incorrect resource %+v", app)
+	}
+	attributes := app.Attributes
+	if _, ok := attributes.Sections["appenv"]; !ok || len(attributes.Sections) != 1 {
+		t.Errorf("Incorrect sections %v", attributes.Sections)
+	}
+	if attributes.Labels["MAINTAINER"] != "TESTAPOD" || attributes.Paths["SCIF_APPROOT"] != filepath.Join(dir, "apps", "hello-world-env") {
+		t.Errorf("Incorrect labels %v or paths %v", attributes.Labels, attributes.Paths)
+	}
+	if attributes.Files.Count == 0 || attributes.Files.Size == 0 || !strings.HasPrefix(attributes.RecipeHash, "sha256:") {
+		t.Errorf("Incorrect files %+v or hash %s", attributes.Files, attributes.RecipeHash)
+	}
+
+	// An app that isn't installed has the same (empty) attributes
+	missing, _ := json.Marshal(document.Data[1])
+	for _, key := range []string{`"installed":false`, `"sections":{}`, `"paths":{}`, `"tests":[]`, `"recipe_hash":""`} {
+		if !strings.Contains(string(missing), key) {
+			t.Errorf("Missing %s in %s", key, missing)
+		}
+	}
+}
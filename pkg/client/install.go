@@ -16,6 +16,7 @@
 package client
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -53,6 +54,7 @@ func Install(recipe string, apps []string, writable bool) (err error) {
 	// install Base folders
 	cli.installBase()
 	cli.installApps(apps)
+	cli.installWorkflows()
 
 	return err
 }
@@ -115,6 +117,7 @@ func (client ScifClient) installApps(apps []string) {
 		client.installCommands(app, lookup)
 		client.installRecipe(app, lookup)
 		client.installTest(app, lookup)
+		client.installTestFiles(app)
 
 		// After we install deactivate last app
 		client.deactivate()
@@ -126,6 +129,28 @@ func (client ScifClient) installApps(apps []string) {
 
 }
 
+// installWorkflows writes each %workflow section of the recipe to
+// <base>/workflows/<name>.scif, where it is found when loading the base
+func (client ScifClient) installWorkflows() {
+
+	if len(Scif.workflows) == 0 {
+		return
+	}
+
+	folder := filepath.Join(Scif.Base, "workflows")
+	if err := os.MkdirAll(folder, os.ModePerm); err != nil {
+		logger.Exitf("%s", err)
+	}
+
+	for name, members := range Scif.workflows {
+		logger.Infof("Installing workflow %s", name)
+		lines := exportAppSection("%workflow", name, members, []string{})
+		if err := util.WriteFile(lines, filepath.Join(folder, name+".scif")); err != nil {
+			logger.Exitf("%s", err)
+		}
+	}
+}
+
 // installApp initializes environment and installs folders for an app,
 // including folders for metadata, bin, and lib to it at the SCIF_BASE
 // Return appsettings so we only need to generate once
@@ -146,45 +171,70 @@ func (client ScifClient) installApp(name string) map[string]string {
 	return lookup
 }
 
-// installFiles will copy a list of files from a source to a destination.
+// installFiles copies the %appfiles of an app, each a source and an optional
+// destination (the app root by default, or relative to it)
 func (client ScifClient) installFiles(name string, lookup map[string]string) {
 
-	if len(lookup["appfiles"]) > 0 {
-
-		var pair []string
-
+	files := Scif.config[name].files
+	if len(files) > 0 {
 		logger.Debugf("+ appfiles %s", name)
-		for _, files := range lookup["appfiles"] {
+		if err := copyFiles(files, lookup["approot"], true); err != nil {
+			logger.Exitf("%s %%appfiles: %s", name, err)
+		}
+	}
+}
 
-			cmd := []string{}
+// copyFiles copies files (or folders) to a root folder, from lines with a
+// source and an optional destination. The destination is the root if it's
+// not given, and a relative one is in the root. An absolute destination is
+// kept if absolute is true (otherwise it's also in the root), and one that
+// ends with a slash is a folder to copy into.
+func copyFiles(files []string, root string, absolute bool) error {
 
-			// Split files into src and dest pairs
-			pair = strings.Split(string(files), " ")
+	for _, line := range files {
 
-			// Handle any files not existing
-			fi, err := os.Stat(pair[0])
-			if err != nil {
-				logger.Exitf("%s", err)
-			}
+		// Split files into src and dest pairs
+		pair := strings.Fields(line)
+		if len(pair) == 0 || strings.HasPrefix(pair[0], "#") {
+			continue
+		}
+		if len(pair) > 2 {
+			return fmt.Errorf("%q should be a source and a destination", strings.TrimSpace(line))
+		}
 
-			// If it's a directory, add -R for recursive
-			switch mode := fi.Mode(); {
-			case mode.IsDir():
-				cmd = append(cmd, "-R", pair[0])
-			case mode.IsRegular():
-				cmd = append(cmd, pair[0])
+		src, dest := pair[0], root
+		if len(pair) == 2 {
+			dest = pair[1]
+			if !absolute || !filepath.IsAbs(dest) {
+				dest = filepath.Join(root, dest)
 			}
+		}
 
-			// Add the destination
-			cmd = append(cmd, pair[1])
+		// Handle any files not existing (before anything is created)
+		fi, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
 
-			// Copy the source to destination, exit on fail
-			_, err = exec.Command("cp", cmd...).Output()
-			if err != nil {
-				logger.Exitf("%s", err)
-			}
+		// A destination folder (or the parent of a file) is created
+		parent := filepath.Dir(dest)
+		if len(pair) == 2 && strings.HasSuffix(pair[1], "/") {
+			parent = dest
+		}
+		if err := os.MkdirAll(parent, os.ModePerm); err != nil {
+			return err
+		}
+
+		// If it's a directory, add -R for recursive
+		cmd := []string{src, dest}
+		if fi.IsDir() {
+			cmd = append([]string{"-R"}, cmd...)
+		}
+		if output, err := exec.Command("cp", cmd...).CombinedOutput(); err != nil {
+			return fmt.Errorf("cp %s: %s", strings.Join(cmd, " "), strings.TrimSpace(string(output)))
 		}
 	}
+	return nil
 }
 
 // installLabels to a labels.json
@@ -241,8 +291,12 @@ func (client ScifClient) installCommands(name string, lookup map[string]string)
 
 		command := strings.Join(Scif.config[name].install, "\n")
 
-		// Issue lines to the system (not yet tested)
-		_, err = exec.Command("sh", "-c", command).Output()
+		// Issue lines to the system (sh, or the builtin shell)
+		process, err := shellCommand("sh", "-c", command)
+		if err != nil {
+			logger.Exitf("%s", err)
+		}
+		_, err = process.Output()
 		if err != nil {
 			logger.Exitf("%s", err)
 		}
@@ -319,4 +373,16 @@ func (client ScifClient) installTest(name string, lookup map[string]string) {
 		logger.Debugf("+ apptest %s", name)
 		util.MakeExecutable(lookup["apptest"])
 	}
+
+	// Named test cases are installed to scif/tests
+	for _, test := range Scif.config[name].cases {
+		path := client.testCasePath(name, test.name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			logger.Exitf("%s", err)
+		}
+		if client.installScript(test.script, path) {
+			logger.Debugf("+ apptest %s %s", name, test.name)
+			util.MakeExecutable(path)
+		}
+	}
 }
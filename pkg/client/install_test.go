@@ -0,0 +1,84 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestInstallFiles tests copying the %appfiles of an app on install
+func TestInstallFiles(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Restore the client settings for other tests
+	base, apps, data := Scif.Base, Scif.Apps, Scif.Data
+	defer func() { Scif.Base, Scif.Apps, Scif.Data = base, apps, data }()
+
+	input := filepath.Join(dir, "input.txt")
+	if err := ioutil.WriteFile(input, []byte("input\n"), 0644); err != nil {
+		t.Fatalf("Error writing input file: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "folder"), 0755); err != nil {
+		t.Fatalf("Error creating input folder: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "folder", "inside.txt"), []byte("inside\n"), 0644); err != nil {
+		t.Fatalf("Error writing input file: %v", err)
+	}
+
+	recipe := filepath.Join(dir, "files.scif")
+	err = ioutil.WriteFile(recipe, []byte("%appfiles data\n"+
+		"    "+input+"\n"+
+		"    "+input+" relative/renamed.txt\n"+
+		"    "+filepath.Join(dir, "folder")+" folders/\n"+
+		"    "+input+" "+filepath.Join(dir, "absolute.txt")+"\n"), 0644)
+	if err != nil {
+		t.Fatalf("Error writing recipe: %v", err)
+	}
+
+	Scif.Base = filepath.Join(dir, "scif")
+	Scif.Apps = filepath.Join(Scif.Base, "apps")
+	Scif.Data = filepath.Join(Scif.Base, "data")
+	if err := Install(recipe, []string{}, true); err != nil {
+		t.Fatalf("Error installing temporary SCIF: %v", err)
+	}
+
+	approot := filepath.Join(Scif.Apps, "data")
+	for _, path := range []string{filepath.Join(approot, "input.txt"),
+		filepath.Join(approot, "relative", "renamed.txt"),
+		filepath.Join(approot, "folders", "folder", "inside.txt"),
+		filepath.Join(dir, "absolute.txt")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to be copied: %v", path, err)
+		}
+	}
+
+	// A missing source is an error, and creates nothing for the destination
+	missing := filepath.Join(dir, "missing.txt") + " " + filepath.Join(dir, "never", "missing.txt")
+	if err := copyFiles([]string{missing}, approot, true); err == nil {
+		t.Errorf("Copying a missing file should fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "never")); !os.IsNotExist(err) {
+		t.Errorf("A missing file should not create its destination folder")
+	}
+}
@@ -0,0 +1,475 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/util"
+)
+
+// A detached run (a job) is run by a supervisor, which is scif started again
+// in its own session with the job file in the environment (see reexec.go).
+// The supervisor runs the app with its output to a log file, and keeps the
+// pid, command, and the exit status in the job file. Jobs are kept in the
+// state folder of the base (SCIF_STATE, or <base>/.scif):
+//
+//	<state>/jobs/<id>.json
+//	<state>/jobs/<id>.log
+
+// jobEnv holds the path of the job file for the supervisor
+const jobEnv = "SCIF_JOB"
+
+// Job statuses
+const (
+	JobStarting = "starting" // the supervisor hasn't started the app yet
+	JobRunning  = "running"  // the app is running
+	JobExited   = "exited"   // the app has exited (see the exit code)
+	JobFailed   = "failed"   // the app could not be run (see the error)
+	JobLost     = "lost"     // the supervisor is gone without a status
+)
+
+// Job is a detached run of an app. The command and options are those of the
+// RunSpec, which can't be kept as it is (e.g., the stdio).
+type Job struct {
+	ID         string        `json:"id"`
+	App        string        `json:"app"`
+	Command    []string      `json:"command,omitempty"`
+	Args       []string      `json:"args,omitempty"`
+	Shell      bool          `json:"shell,omitempty"`
+	Env        []string      `json:"env,omitempty"`
+	Dir        string        `json:"dir,omitempty"`
+	Timeout    time.Duration `json:"timeout,omitempty"`
+	Resources  Resources     `json:"resources"`
+	Sandbox    *Sandbox      `json:"sandbox,omitempty"`
+	Provenance bool          `json:"provenance,omitempty"`
+
+	Status     string    `json:"status"`
+	Argv       []string  `json:"argv,omitempty"` // full command, once started
+	Log        string    `json:"log,omitempty"`
+	PID        int       `json:"pid,omitempty"`
+	Supervisor int       `json:"supervisor_pid,omitempty"`
+	Submitted  time.Time `json:"submitted"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	ExitCode   int       `json:"exit_code"`
+	Signal     string    `json:"signal,omitempty"`
+	Limit      string    `json:"limit,omitempty"`
+	Error      string    `json:"error,omitempty"`
+
+	path string // of the job file
+}
+
+// stateFolder is where scif keeps state for the base (e.g., jobs)
+func stateFolder() string {
+	return getenv("SCIF_STATE", filepath.Join(Scif.Base, ".scif"))
+}
+
+// DetachApp starts a detached run of an app, and returns the job without
+// waiting for it. The stdio of the spec is not used: the output of the app
+// goes to the log of the job.
+func DetachApp(spec RunSpec) (*Job, error) {
+
+	job, err := newJob(spec, true)
+	if err != nil {
+		return nil, err
+	}
+
+	pid, err := startSupervisor(jobEnv+"="+job.path, job.Log)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("Started supervisor %d for job %s", pid, job.ID)
+	return job, nil
+}
+
+// newJob creates (and saves) a job to run an app, with a log if it's asked
+// for (scif up runs jobs with the output to its own)
+func newJob(spec RunSpec, log bool) (*Job, error) {
+
+	// Ensure that the app exists on the filesystem
+	cli := ScifClient{}.Load(Scif.Base)
+	if ok := util.Contains(spec.App, cli.apps()); !ok {
+		return nil, fmt.Errorf("%s is not an installed app", spec.App)
+	}
+
+	// The arguments are checked now, rather than when the supervisor runs it
+	if len(spec.Command) == 0 {
+		if _, _, err := cli.parseAppArgs(spec.App, spec.Args); err != nil {
+			return nil, err
+		}
+	}
+
+	folder := filepath.Join(stateFolder(), "jobs")
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	id := newRunID(now)
+	job := &Job{ID: id,
+		App:        spec.App,
+		Command:    spec.Command,
+		Args:       spec.Args,
+		Shell:      spec.Shell,
+		Env:        spec.Env,
+		Dir:        spec.Dir,
+		Timeout:    spec.Timeout,
+		Resources:  spec.Resources,
+		Sandbox:    spec.Sandbox,
+		Provenance: spec.Provenance,
+		Status:     JobStarting,
+		Submitted:  now,
+		path:       filepath.Join(folder, id+".json")}
+
+	if log {
+		job.Log = filepath.Join(folder, id+".log")
+	}
+	return job, job.write()
+}
+
+// startSupervisor starts scif again in the background, with the marker for
+// what it supervises in the environment and its output to a log. It has its
+// own session, so it outlives us (and our terminal), and uses our base and
+// log level (it doesn't parse the command line).
+func startSupervisor(marker string, log string) (int, error) {
+
+	logFile, err := os.OpenFile(log, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer logFile.Close()
+
+	self, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	supervisor := exec.Command(self)
+	supervisor.Env = append(os.Environ(), marker, logger.GetMessageLevel(),
+		"SCIF_BASE="+Scif.Base, "SCIF_APPS="+Scif.Apps, "SCIF_DATA="+Scif.Data)
+	supervisor.Stdout = logFile
+	supervisor.Stderr = logFile
+	supervisor.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := supervisor.Start(); err != nil {
+		return 0, err
+	}
+
+	// We don't wait for it, but reap it if it exits before we do (otherwise
+	// it's left a zombie that still seems to run)
+	go supervisor.Wait()
+	return supervisor.Process.Pid, nil
+}
+
+// superviseJob runs the app of a job (in the supervisor), keeping the status
+// in the job file. It returns the exit status for the supervisor.
+func superviseJob(path string) int {
+
+	job, err := readJob(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scif: %s\n", err)
+		return 1
+	}
+	job.Supervisor = os.Getpid()
+
+	spec := job.spec()
+	spec.Stdout = os.Stdout
+	spec.Stderr = os.Stderr
+	spec.Started = func(pid int, argv []string) {
+		job.PID, job.Argv, job.Start = pid, argv, time.Now()
+		job.Status = JobRunning
+		if err := job.write(); err != nil {
+			logger.Warningf("Cannot update job %s: %s", job.ID, err)
+		}
+	}
+
+	ctx, cancel := InterruptContext()
+	defer cancel()
+
+	result, err := RunApp(ctx, spec)
+	job.End = time.Now()
+	if result != nil {
+		job.Status = JobExited
+		job.ExitCode = result.ExitCode
+		job.Limit = result.Limit
+		if result.Signal != 0 {
+			job.Signal = result.Signal.String()
+		}
+	} else {
+		job.Status = JobFailed
+	}
+	if err != nil {
+		job.Error = err.Error()
+		logger.Errorf("%s", err)
+	}
+
+	if err := job.write(); err != nil {
+		fmt.Fprintf(os.Stderr, "scif: %s\n", err)
+		return 1
+	}
+	if result == nil {
+		return 1
+	}
+	return result.Status()
+}
+
+// spec returns the RunSpec to run the app of a job
+func (job Job) spec() RunSpec {
+	return RunSpec{App: job.App,
+		Command:    job.Command,
+		Args:       job.Args,
+		Shell:      job.Shell,
+		Env:        job.Env,
+		Dir:        job.Dir,
+		Timeout:    job.Timeout,
+		Resources:  job.Resources,
+		Sandbox:    job.Sandbox,
+		Provenance: job.Provenance}
+}
+
+// write saves a job to its file
+func (job Job) write() error {
+	return writeState(job.path, job)
+}
+
+// writeState saves state as json, replacing the file so that readers (e.g.,
+// scif ps while the supervisor writes) see all of it
+func writeState(path string, state interface{}) error {
+
+	content, err := json.MarshalIndent(state, "", "    ")
+	if err != nil {
+		return err
+	}
+	temporary := path + ".tmp"
+	if err := ioutil.WriteFile(temporary, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, path)
+}
+
+// readJob reads a job file. A job that should be running, but has lost its
+// supervisor (e.g., the container was restarted) is lost.
+func readJob(path string) (*Job, error) {
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{path: path}
+	if err := json.Unmarshal(content, job); err != nil {
+		return nil, err
+	}
+
+	if job.Status == JobRunning || job.Status == JobStarting {
+		if job.Supervisor != 0 && !processExists(job.Supervisor) {
+			job.Status = JobLost
+		}
+	}
+	return job, nil
+}
+
+// Running returns true if the app of a job is (or is about to be) running
+func (job Job) Running() bool {
+	return job.Status == JobRunning || job.Status == JobStarting
+}
+
+// processExists returns true if a process (or with a negative pid, a process
+// group) exists
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// ListJobs returns the jobs of the base, ordered by the time submitted
+func ListJobs() ([]*Job, error) {
+
+	files, err := filepath.Glob(filepath.Join(stateFolder(), "jobs", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*Job
+	for _, file := range files {
+		job, err := readJob(file)
+		if err != nil {
+			logger.Warningf("Skipping job %s: %s", file, err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Submitted.Before(jobs[j].Submitted)
+	})
+	return jobs, nil
+}
+
+// GetJob returns a job by id (or the random part of it)
+func GetJob(id string) (*Job, error) {
+
+	jobs, err := ListJobs()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.ID == id || strings.HasSuffix(job.ID, "-"+id) {
+			return job, nil
+		}
+	}
+	return nil, fmt.Errorf("no job with id %s", id)
+}
+
+// Ps prints the running jobs, or all jobs
+func Ps(all bool) error {
+
+	jobs, err := ListJobs()
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tAPP\tSTATUS\tPID\tSTARTED\tCOMMAND")
+	for _, job := range jobs {
+		if !all && !job.Running() {
+			continue
+		}
+
+		started := "-"
+		if !job.Start.IsZero() {
+			started = job.Start.Local().Format("2006-01-02 15:04:05")
+		}
+		command := job.Argv
+		if len(command) == 0 {
+			command = append(append([]string{}, job.Command...), job.Args...)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%s\t%s\n", job.ID, job.App,
+			job.describe(), job.PID, started, strings.Join(command, " "))
+	}
+	writer.Flush()
+	return nil
+}
+
+// describe returns the status of a job for a person, with how it exited
+func (job Job) describe() string {
+
+	switch {
+	case job.Status == JobRunning:
+		return fmt.Sprintf("running (%s)", time.Since(job.Start).Round(time.Second))
+	case job.Status == JobExited && job.Signal != "":
+		return fmt.Sprintf("exited (%s)", job.Signal)
+	case job.Status == JobExited:
+		return fmt.Sprintf("exited (%d)", job.ExitCode)
+	}
+	return job.Status
+}
+
+// Logs prints the log of a job, and keeps following it until the job has
+// finished if follow is true
+func Logs(id string, follow bool) error {
+
+	job, err := GetJob(id)
+	if err != nil {
+		return err
+	}
+	if job.Log == "" {
+		return fmt.Errorf("job %s has no log, its output went to scif up", job.ID)
+	}
+
+	file, err := os.Open(job.Log)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for {
+		if _, err := io.Copy(os.Stdout, file); err != nil {
+			return err
+		}
+		if !follow || !job.Running() {
+			return nil
+		}
+
+		time.Sleep(250 * time.Millisecond)
+		if job, err = readJob(job.path); err != nil {
+			return err
+		}
+	}
+}
+
+// Stop stops a job: the app (and what it started) is sent SIGTERM, and then
+// SIGKILL if it's still running after the timeout
+func Stop(id string, timeout time.Duration) error {
+
+	job, err := GetJob(id)
+	if err != nil {
+		return err
+	}
+	if job.Status != JobRunning {
+		return fmt.Errorf("job %s is not running (%s)", job.ID, job.describe())
+	}
+
+	// The app leads its own process group
+	group := -job.PID
+	logger.Infof("Stopping job %s (%s, pid %d)", job.ID, job.App, job.PID)
+	if err := syscall.Kill(group, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+		return err
+	}
+
+	if !waitForExit(group, timeout) {
+		logger.Warningf("Job %s is still running after %s, killing it", job.ID, timeout)
+		if err := syscall.Kill(group, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return err
+		}
+		waitForExit(group, 5*time.Second)
+	}
+
+	// Give the supervisor a moment to record how the app exited
+	deadline := time.Now().Add(2 * time.Second)
+	for job.Running() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		if job, err = readJob(job.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForExit waits for a process (group) to exit, and returns false if it
+// hasn't after the timeout
+func waitForExit(pid int, timeout time.Duration) bool {
+
+	deadline := time.Now().Add(timeout)
+	for processExists(pid) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDetachApp tests a detached run, which is supervised by the test binary
+// started again
+func TestDetachApp(t *testing.T) {
+
+	// Create faux scif base
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+
+	err = Install("../../hello-world.scif", []string{}, true)
+	if err != nil {
+		t.Errorf("Error installing temporary SCIF")
+	}
+
+	if _, err := DetachApp(RunSpec{App: "doesnotexist"}); err == nil {
+		t.Errorf("Detaching an app that isn't installed should fail")
+	}
+
+	job, err := DetachApp(RunSpec{App: "hello-custom", Args: []string{"pepperoni"}})
+	if err != nil {
+		t.Fatalf("Error detaching hello-custom: %v", err)
+	}
+
+	// Wait for the supervisor to record the exit
+	deadline := time.Now().Add(10 * time.Second)
+	for job.Running() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		if job, err = GetJob(job.ID); err != nil {
+			t.Fatalf("Error getting job: %v", err)
+		}
+	}
+	if job.Status != JobExited || job.ExitCode != 0 || job.PID == 0 {
+		t.Fatalf("Incorrect job status, got %+v", job)
+	}
+
+	content, err := ioutil.ReadFile(job.Log)
+	if err != nil || !strings.Contains(string(content), "Hello pepperoni") {
+		t.Errorf("Incorrect job log, got %q (%v)", content, err)
+	}
+
+	jobs, err := ListJobs()
+	if err != nil || len(jobs) != 1 {
+		t.Errorf("Expected one job, got %d (%v)", len(jobs), err)
+	}
+	if err := Stop(job.ID, time.Second); err == nil {
+		t.Errorf("Stopping a finished job should fail")
+	}
+}
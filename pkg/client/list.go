@@ -0,0 +1,334 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+)
+
+// scif apps lists the installed apps by name (with their root for a long
+// listing), or in a format for scripts: a table, JSON, CSV, or a Go
+// text/template for each app (e.g., template='{{.Name}} {{.Labels.MAINTAINER}}',
+// with the fields of AppListing). The apps can be selected with filters,
+// that must all match:
+//
+//	label.KEY=value   the label KEY has the value (or matches a glob, e.g., align*)
+//	label.KEY         the app has the label KEY
+//	has:SECTION       the app defines the section (e.g., has:test or has:apptest)
+//
+// and sorted by name, size (largest first) or installed (latest first).
+
+// Formats for listing apps
+const (
+	ListTable    = "table"
+	ListJSON     = "json"
+	ListCSV      = "csv"
+	ListTemplate = "template"
+)
+
+// Orders for listing apps
+const (
+	SortName      = "name"
+	SortSize      = "size"
+	SortInstalled = "installed"
+)
+
+// ListOptions are how apps are listed
+type ListOptions struct {
+	Long    bool     // show the root of each app (without a format)
+	Filters []string // filters that an app must match
+	Sort    string   // name (default), size or installed
+	Format  string   // table, json, csv or template=<template> (names by default)
+}
+
+// AppListing is an app, as it's listed
+type AppListing struct {
+	Name      string            `json:"name"`
+	Root      string            `json:"root"`
+	Installed time.Time         `json:"installed"` // when the recipe was installed (zero if not)
+	Size      int64             `json:"size"`      // of the files in the app root, in bytes (for a format, or sorted by size)
+	Files     int64             `json:"files"`
+	Labels    map[string]string `json:"labels"`
+	Sections  []string          `json:"sections"` // that are defined, e.g., apprun
+}
+
+// listFilter selects apps for a listing
+type listFilter func(app AppListing) bool
+
+// Apps instantiates the client and prints the apps installed.
+func Apps(options ListOptions) (err error) {
+
+	format, text, err := parseListFormat(options.Format)
+	if err != nil {
+		return err
+	}
+	var filters []listFilter
+	for _, value := range options.Filters {
+		filter, err := parseListFilter(value)
+		if err != nil {
+			return err
+		}
+		filters = append(filters, filter)
+	}
+
+	// Running an app means we load from the filesystem first
+	cli := ScifClient{}.Load(Scif.Base)
+
+	// Walking the app roots for their size is only done if it's shown (in
+	// a format) or the order is by size
+	usage := format != "" || options.Sort == SortSize
+
+	var listing []AppListing
+	for _, name := range AppNames() {
+		app := cli.listApp(name, usage)
+		if matchesAll(app, filters) {
+			listing = append(listing, app)
+		}
+	}
+	if err := sortListing(listing, options.Sort); err != nil {
+		return err
+	}
+	return writeListing(os.Stdout, listing, format, text, options.Long)
+}
+
+// listApp returns the listing of an installed app, with the size (and
+// files) of its root if usage is true
+func (client ScifClient) listApp(name string, usage bool) AppListing {
+
+	settings := Scif.config[name]
+	lookup := client.getAppenvLookup(name)
+	app := AppListing{Name: name,
+		Root:     lookup["approot"],
+		Labels:   parseKeyValues(settings.labels),
+		Sections: []string{}}
+
+	if usage {
+		files := diskUsage(lookup["approot"])
+		app.Size, app.Files = files.Size, files.Count
+	}
+
+	// The recipe is the last to be installed
+	if info, err := os.Stat(lookup["apprecipe"]); err == nil {
+		app.Installed = info.ModTime()
+	}
+
+	for section, lines := range settings.sections() {
+		if len(lines) > 0 || (section == "apptest" && len(settings.cases) > 0) {
+			app.Sections = append(app.Sections, section)
+		}
+	}
+	sort.Strings(app.Sections)
+	return app
+}
+
+// parseListFormat parses a format, and the template (for template=...)
+func parseListFormat(value string) (string, string, error) {
+
+	format, text := value, ""
+	if index := strings.Index(value, "="); index >= 0 {
+		format, text = value[:index], value[index+1:]
+	}
+	switch format {
+	case "", ListTable, ListJSON, ListCSV:
+		if text != "" {
+			return "", "", fmt.Errorf("the %s format doesn't take a template", format)
+		}
+		return format, "", nil
+	case ListTemplate:
+		if text == "" {
+			return "", "", fmt.Errorf("the template format needs a template, e.g., template='{{.Name}}'")
+		}
+		return format, text, nil
+	}
+	return "", "", fmt.Errorf("%s is not a format (table, json, csv or template=...)", format)
+}
+
+// parseListFilter parses a filter, label.KEY[=value] or has:SECTION
+func parseListFilter(value string) (listFilter, error) {
+
+	switch {
+	case strings.HasPrefix(value, "label."):
+		pair := strings.SplitN(strings.TrimPrefix(value, "label."), "=", 2)
+		key := pair[0]
+		if key == "" {
+			return nil, fmt.Errorf("%s: the filter needs a label, e.g., label.MAINTAINER=name", value)
+		}
+		if len(pair) == 1 {
+			return func(app AppListing) bool {
+				_, ok := app.Labels[key]
+				return ok
+			}, nil
+		}
+		pattern := pair[1]
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: %s", value, err)
+		}
+		return func(app AppListing) bool {
+			label, ok := app.Labels[key]
+			matched, _ := path.Match(pattern, label)
+			return ok && (label == pattern || matched)
+		}, nil
+
+	case strings.HasPrefix(value, "has:"):
+		section := strings.TrimPrefix(value, "has:")
+		if !strings.HasPrefix(section, "app") {
+			section = "app" + section
+		}
+		if _, ok := (AppSettings{}).sections()[section]; !ok {
+			return nil, fmt.Errorf("%s: %s is not a section", value, strings.TrimPrefix(value, "has:"))
+		}
+		return func(app AppListing) bool {
+			for _, defined := range app.Sections {
+				if defined == section {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	return nil, fmt.Errorf("%s is not a filter (label.KEY=value, label.KEY or has:SECTION)", value)
+}
+
+// matchesAll determines if an app matches all the filters
+func matchesAll(app AppListing, filters []listFilter) bool {
+	for _, filter := range filters {
+		if !filter(app) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortListing sorts apps (already by name) by size or install time
+func sortListing(listing []AppListing, by string) error {
+
+	switch by {
+	case "", SortName:
+	case SortSize:
+		sort.SliceStable(listing, func(i, j int) bool { return listing[i].Size > listing[j].Size })
+	case SortInstalled:
+		sort.SliceStable(listing, func(i, j int) bool { return listing[i].Installed.After(listing[j].Installed) })
+	default:
+		return fmt.Errorf("%s is not an order (name, size or installed)", by)
+	}
+	return nil
+}
+
+// writeListing writes the apps in a format, or their names (and roots, for
+// a long listing)
+func writeListing(writer io.Writer, listing []AppListing, format string, text string, long bool) error {
+
+	switch format {
+	case ListTable:
+		table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "NAME\tSIZE\tFILES\tINSTALLED\tLABELS")
+		for _, app := range listing {
+			fmt.Fprintf(table, "%s\t%s\t%d\t%s\t%s\n", app.Name, humanBytes(app.Size), app.Files,
+				formatInstalled(app.Installed, "2006-01-02 15:04"), joinLabels(app.Labels, ","))
+		}
+		return table.Flush()
+
+	case ListJSON:
+		if listing == nil {
+			listing = []AppListing{}
+		}
+		result, err := json.MarshalIndent(listing, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(writer, string(result))
+		return err
+
+	case ListCSV:
+		records := csv.NewWriter(writer)
+		records.Write([]string{"name", "root", "installed", "size", "files", "labels"})
+		for _, app := range listing {
+			records.Write([]string{app.Name, app.Root, formatInstalled(app.Installed, time.RFC3339),
+				strconv.FormatInt(app.Size, 10), strconv.FormatInt(app.Files, 10), joinLabels(app.Labels, ";")})
+		}
+		records.Flush()
+		return records.Error()
+
+	case ListTemplate:
+		each, err := template.New("apps").Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return err
+		}
+		for _, app := range listing {
+			if err := each.Execute(writer, app); err != nil {
+				return err
+			}
+			fmt.Fprintln(writer)
+		}
+		return nil
+	}
+
+	for _, app := range listing {
+		if long {
+			fmt.Fprintf(writer, "%s: %s\n", app.Name, app.Root)
+		} else {
+			fmt.Fprintf(writer, "%s\n", app.Name)
+		}
+	}
+	return nil
+}
+
+// formatInstalled formats an install time, or is empty if it's not known
+func formatInstalled(installed time.Time, layout string) string {
+	if installed.IsZero() {
+		return ""
+	}
+	return installed.Format(layout)
+}
+
+// joinLabels joins labels as KEY=value, sorted by key
+func joinLabels(labels map[string]string, separator string) string {
+
+	var pairs []string
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, separator)
+}
+
+// humanBytes shows a size with one decimal in the largest binary unit
+// (e.g., 1.5M)
+func humanBytes(size int64) string {
+
+	value, unit := float64(size), ""
+	for _, next := range byteUnits {
+		if value < 1024 {
+			break
+		}
+		value, unit = value/1024, next
+	}
+	if unit == "" {
+		return fmt.Sprintf("%dB", size)
+	}
+	return fmt.Sprintf("%.1f%s", value, unit)
+}
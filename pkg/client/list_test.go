@@ -0,0 +1,111 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestListApps tests filtering, sorting and formatting the apps
+func TestListApps(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+	if err := Install("../../hello-world.scif", []string{}, true); err != nil {
+		t.Errorf("Error installing temporary SCIF: %v", err)
+	}
+
+	cli := ScifClient{}.Load(Scif.Base)
+	var listing []AppListing
+	for _, name := range AppNames() {
+		listing = append(listing, cli.listApp(name, true))
+	}
+
+	// The size is only there if it's asked for
+	if app := cli.listApp("hello-world-script", false); app.Size != 0 || app.Files != 0 {
+		t.Errorf("Expected no size without usage, got %d (%d files)", app.Size, app.Files)
+	}
+	if app := cli.listApp("hello-world-script", true); app.Size == 0 || app.Files == 0 {
+		t.Errorf("Expected the size with usage, got %d (%d files)", app.Size, app.Files)
+	}
+
+	var filters = []struct {
+		filter   string
+		expected []string
+	}{
+		{"label.MAINTAINER=dinosaur", []string{"hello-world-echo"}},
+		{"label.MAINTAINER=*O*", []string{"hello-world-env"}},
+		{"label.WHOAMI", []string{"hello-world-echo"}},
+		{"has:test", []string{"hello-world-script"}},
+		{"has:apphelp", []string{"hello-world-env"}},
+	}
+	for _, tt := range filters {
+		filter, err := parseListFilter(tt.filter)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %v", tt.filter, err)
+		}
+		var names []string
+		for _, app := range listing {
+			if filter(app) {
+				names = append(names, app.Name)
+			}
+		}
+		if !Equal(names, tt.expected) {
+			t.Errorf("%s: got %v, want %v", tt.filter, names, tt.expected)
+		}
+	}
+	for _, bad := range []string{"label.", "has:nothing", "maintainer=me", "label.A=[b"} {
+		if _, err := parseListFilter(bad); err == nil {
+			t.Errorf("Expected an error for the filter %s", bad)
+		}
+	}
+
+	// The largest app is first
+	if err := sortListing(listing, SortSize); err != nil {
+		t.Errorf("Error sorting: %v", err)
+	}
+	for i := 1; i < len(listing); i++ {
+		if listing[i].Size > listing[i-1].Size {
+			t.Errorf("Incorrect order by size %s (%d) after %s (%d)", listing[i].Name, listing[i].Size, listing[i-1].Name, listing[i-1].Size)
+		}
+	}
+
+	var out bytes.Buffer
+	format, text, err := parseListFormat("template={{.Name}}:{{.Labels.MAINTAINER}}")
+	if err != nil {
+		t.Errorf("Error parsing the format: %v", err)
+	}
+	writeListing(&out, listing[:1], format, text, false)
+	if out.String() != listing[0].Name+":"+listing[0].Labels["MAINTAINER"]+"\n" {
+		t.Errorf("Incorrect template output %q", out.String())
+	}
+	for _, bad := range []string{"xml", "template", "json=x"} {
+		if _, _, err := parseListFormat(bad); err == nil {
+			t.Errorf("Expected an error for the format %s", bad)
+		}
+	}
+}
@@ -18,6 +18,7 @@ package client
 import (
 	//"encoding/json"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/sci-f/scif-go/internal/pkg/logger"
@@ -36,6 +37,7 @@ func Preview(recipe string, apps []string) {
 	cli := ScifClient{}.Load(recipe)
 	cli.previewBase()
 	cli.previewApps(apps)
+	cli.previewWorkflows()
 }
 
 // Preview Helper Functions
@@ -85,15 +87,28 @@ func (client ScifClient) previewApps(apps []string) {
 	}
 }
 
-// previewFiles will simply print commands that would be used for copying
-func (client ScifClient) previewFiles(name string, lookup map[string]string) {
+// previewWorkflows shows the workflows that would be installed to the base
+func (client ScifClient) previewWorkflows() {
 
-	if len(lookup["appfiles"]) > 0 {
+	for name, members := range Scif.workflows {
+		logger.Infof("\n+ workflow %s", name)
+		client.printScript(members, filepath.Join(Scif.Base, "workflows", name+".scif"))
+	}
+}
 
-		logger.Debugf("\n+ appfiles %s", name)
-		for _, files := range lookup["appfiles"] {
-			fmt.Printf("%s", string(files))
+// previewFiles will simply print the files that would be copied
+func (client ScifClient) previewFiles(name string, lookup map[string]string) {
 
+	if len(Scif.config[name].files) > 0 {
+		logger.Infof("\n+ appfiles %s", name)
+		for _, files := range Scif.config[name].files {
+			fmt.Println(strings.TrimSpace(files))
+		}
+	}
+	if len(Scif.config[name].testfiles) > 0 {
+		logger.Infof("\n+ apptestfiles %s", name)
+		for _, files := range Scif.config[name].testfiles {
+			fmt.Println(strings.TrimSpace(files))
 		}
 	}
 }
@@ -172,6 +187,7 @@ func (client ScifClient) previewRunscript(name string, lookup map[string]string)
 	if len(Scif.config[name].runscript) > 0 {
 		logger.Infof("\n+ apprun %s", name)
 		client.printScript(Scif.config[name].runscript, lookup["apprun"])
+		client.printInterpreter(name, "apprun")
 	}
 }
 
@@ -198,5 +214,10 @@ func (client ScifClient) previewTest(name string, lookup map[string]string) {
 	if len(Scif.config[name].test) > 0 {
 		logger.Infof("\n+ apptest %s", name)
 		client.printScript(Scif.config[name].test, lookup["apptest"])
+		client.printInterpreter(name, "apptest")
+	}
+	for _, test := range Scif.config[name].cases {
+		logger.Infof("\n+ apptest %s %s", name, test.name)
+		client.printScript(test.script, client.testCasePath(name, test.name))
 	}
 }
@@ -0,0 +1,674 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/sci-f/scif-go/pkg/util"
+)
+
+// scif query selects apps with an expression, evaluated against the
+// attributes of each app in the JSON document of scif inspect (see
+// InspectAttributes), with the name of the app as name. For example:
+//
+//	not sections.apptest and len(tests) == 0     apps without tests
+//	commands contains "python"                   apps with python on the PATH
+//	labels =~ "GPL"                              labels that mention GPL
+//	labels["org.label-schema.name"] == "align"   a label with dots
+//	files.size > 1000000 or name =~ "^hello"
+//
+// Values are those of the JSON (strings, numbers, booleans, lists, objects
+// and null), and a name that isn't there is null. The operators are:
+//
+//	== != < <= > >=   compare values (numbers, or strings for the order)
+//	=~ !~             match a regular expression, for a string, or any
+//	                  string in a list or object (at any depth)
+//	contains          a substring, an item of a list, or a key of an object
+//	and or not        (also && || !), with null, false, 0, "" and an empty
+//	                  list or object as false
+//	len(value)        the length of a string, list or object
+//
+// and parentheses group them.
+
+// Formats for the results of a query
+const (
+	QueryTable = "table"
+	QueryJSON  = "json"
+)
+
+// queryDefaultColumns are the columns of the table, after the name
+var queryDefaultColumns = []string{"installed", "files.count", "files.size"}
+
+// Query prints the apps that match an expression as a table (with a column
+// for each of the columns, which are also expressions) or as the JSON
+// document of scif inspect.
+func Query(expression string, format string, columns []string) error {
+
+	query, err := parseQuery(expression)
+	if err != nil {
+		return err
+	}
+	if format != QueryTable && format != QueryJSON {
+		return fmt.Errorf("%s is not a format (table or json)", format)
+	}
+	if len(columns) == 0 {
+		columns = queryDefaultColumns
+	}
+	var cells []queryNode
+	for _, column := range columns {
+		cell, err := parseQuery(column)
+		if err != nil {
+			return fmt.Errorf("column %s", err)
+		}
+		cells = append(cells, cell)
+	}
+
+	cli := ScifClient{}.Load(Scif.Base)
+	document := cli.inspectDocument(AppNames(), false, false, false, false, false, false, true)
+	matches, err := queryDocument(query, document)
+	if err != nil {
+		return err
+	}
+
+	if format == QueryJSON {
+		document.Data = matches
+		result, err := json.MarshalIndent(document, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(result))
+		return nil
+	}
+	return writeQueryTable(os.Stdout, matches, columns, cells)
+}
+
+// queryDocument returns the apps of an inspect document that match a query
+func queryDocument(query queryNode, document InspectDocument) ([]InspectResource, error) {
+
+	matches := []InspectResource{}
+	for _, app := range document.Data {
+		value, err := query.eval(queryValues(app))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", app.ID, err)
+		}
+		if truthy(value) {
+			matches = append(matches, app)
+		}
+	}
+	return matches, nil
+}
+
+// queryValues returns the attributes of an app as JSON values, with its name
+func queryValues(app InspectResource) map[string]interface{} {
+
+	values := map[string]interface{}{}
+	content, _ := json.Marshal(app.Attributes)
+	json.Unmarshal(content, &values)
+	values["name"] = app.ID
+	return values
+}
+
+// writeQueryTable writes a table of the apps, with the value of each column
+func writeQueryTable(writer io.Writer, apps []InspectResource, columns []string, cells []queryNode) error {
+
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "NAME\t%s\n", strings.ToUpper(strings.Join(columns, "\t")))
+	for _, app := range apps {
+		values := queryValues(app)
+		row := []string{app.ID}
+		for _, cell := range cells {
+			value, err := cell.eval(values)
+			if err != nil {
+				return fmt.Errorf("%s: %s", app.ID, err)
+			}
+			row = append(row, formatQueryValue(value))
+		}
+		fmt.Fprintln(table, strings.Join(row, "\t"))
+	}
+	return table.Flush()
+}
+
+// formatQueryValue shows a value in a cell of a table
+func formatQueryValue(value interface{}) string {
+
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case []interface{}:
+		var items []string
+		for _, item := range value {
+			items = append(items, formatQueryValue(item))
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		var pairs []string
+		for key, item := range value {
+			pairs = append(pairs, key+"="+formatQueryValue(item))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// Parsing
+// .............................................................................
+
+// queryToken is a token of an expression, an identifier, a string, a number
+// or an operator (the text)
+type queryToken struct {
+	kind  string // "ident", "string", "number", "op" or "end"
+	text  string
+	value interface{} // of a string or number
+	pos   int
+}
+
+// queryOperators are the operators and punctuation, the longest first
+var queryOperators = []string{"==", "!=", "=~", "!~", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ".", ","}
+
+// lexQuery splits an expression into tokens
+func lexQuery(expression string) ([]queryToken, error) {
+
+	var tokens []queryToken
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+
+		char := runes[i]
+		switch {
+		case unicode.IsSpace(char):
+			i++
+
+		case char == '"' || char == '\'':
+			start := i
+			var text strings.Builder
+			for i++; i < len(runes) && runes[i] != char; i++ {
+
+				// Only the quote and a backslash are escaped, others (as
+				// in a regular expression, e.g., \d) are kept
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == char || runes[i+1] == '\\') {
+					i++
+				}
+				text.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated string at %d", start+1)
+			}
+			i++
+			tokens = append(tokens, queryToken{kind: "string", text: string(runes[start:i]), value: text.String(), pos: start})
+
+		case unicode.IsDigit(char):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			number, err := strconv.ParseFloat(string(runes[start:i]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %s at %d", string(runes[start:i]), start+1)
+			}
+			tokens = append(tokens, queryToken{kind: "number", text: string(runes[start:i]), value: number, pos: start})
+
+		case unicode.IsLetter(char) || char == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '-') {
+				i++
+			}
+			tokens = append(tokens, queryToken{kind: "ident", text: string(runes[start:i]), pos: start})
+
+		default:
+			matched := false
+			for _, operator := range queryOperators {
+				if strings.HasPrefix(string(runes[i:]), operator) {
+					tokens = append(tokens, queryToken{kind: "op", text: operator, pos: i})
+					i += len([]rune(operator))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at %d", char, i+1)
+			}
+		}
+	}
+	return append(tokens, queryToken{kind: "end", pos: len(runes)}), nil
+}
+
+// queryParser parses tokens into an expression, by recursive descent
+type queryParser struct {
+	tokens []queryToken
+	next   int
+}
+
+// parseQuery parses an expression
+func parseQuery(expression string) (queryNode, error) {
+
+	tokens, err := lexQuery(expression)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %s", expression, err)
+	}
+	parser := &queryParser{tokens: tokens}
+	node, err := parser.or()
+	if err == nil && parser.peek().kind != "end" {
+		err = parser.unexpected()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%q: %s", expression, err)
+	}
+	return node, nil
+}
+
+// peek returns the next token, and take consumes it
+func (parser *queryParser) peek() queryToken {
+	return parser.tokens[parser.next]
+}
+
+func (parser *queryParser) take() queryToken {
+	token := parser.tokens[parser.next]
+	if token.kind != "end" {
+		parser.next++
+	}
+	return token
+}
+
+// is determines if the next token is one of the operators or keywords
+func (parser *queryParser) is(texts ...string) bool {
+	token := parser.peek()
+	if token.kind != "op" && token.kind != "ident" {
+		return false
+	}
+	for _, text := range texts {
+		if token.text == text {
+			return true
+		}
+	}
+	return false
+}
+
+// expect consumes the next token if it's the operator, or is an error
+func (parser *queryParser) expect(text string) error {
+	if !parser.is(text) || parser.peek().kind != "op" {
+		return fmt.Errorf("expected %s at %d", text, parser.peek().pos+1)
+	}
+	parser.take()
+	return nil
+}
+
+// unexpected is an error for the next token
+func (parser *queryParser) unexpected() error {
+	token := parser.peek()
+	if token.kind == "end" {
+		return fmt.Errorf("unexpected end")
+	}
+	return fmt.Errorf("unexpected %s at %d", token.text, token.pos+1)
+}
+
+// or is: and (or and)*
+func (parser *queryParser) or() (queryNode, error) {
+	left, err := parser.and()
+	for err == nil && parser.is("or", "||") {
+		parser.take()
+		var right queryNode
+		if right, err = parser.and(); err == nil {
+			left = queryLogic{or: true, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+// and is: not (and not)*
+func (parser *queryParser) and() (queryNode, error) {
+	left, err := parser.not()
+	for err == nil && parser.is("and", "&&") {
+		parser.take()
+		var right queryNode
+		if right, err = parser.not(); err == nil {
+			left = queryLogic{left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+// not is: not not | comparison
+func (parser *queryParser) not() (queryNode, error) {
+	if parser.is("not", "!") {
+		parser.take()
+		node, err := parser.not()
+		return queryNot{node: node}, err
+	}
+	return parser.comparison()
+}
+
+// comparison is: value (operator value)?
+func (parser *queryParser) comparison() (queryNode, error) {
+	left, err := parser.value()
+	if err != nil {
+		return nil, err
+	}
+	if parser.is("==", "!=", "=~", "!~", "<", "<=", ">", ">=", "contains") {
+		operator := parser.take().text
+		right, err := parser.value()
+		if err != nil {
+			return nil, err
+		}
+		return queryCompare{operator: operator, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+// value is: (or) | string | number | true | false | null | name(args) | path
+func (parser *queryParser) value() (queryNode, error) {
+
+	token := parser.peek()
+	switch {
+	case parser.is("("):
+		parser.take()
+		node, err := parser.or()
+		if err != nil {
+			return nil, err
+		}
+		return node, parser.expect(")")
+
+	case token.kind == "string" || token.kind == "number":
+		parser.take()
+		return queryLiteral{value: token.value}, nil
+
+	case token.kind != "ident" || util.Contains(token.text, []string{"and", "or", "not", "contains"}):
+		return nil, parser.unexpected()
+
+	case token.text == "true" || token.text == "false":
+		parser.take()
+		return queryLiteral{value: token.text == "true"}, nil
+
+	case token.text == "null":
+		parser.take()
+		return queryLiteral{}, nil
+	}
+
+	// A function call
+	parser.take()
+	if parser.is("(") {
+		parser.take()
+		call := queryCall{name: token.text}
+		for !parser.is(")") {
+			if len(call.args) > 0 {
+				if err := parser.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			arg, err := parser.or()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+		}
+		parser.take()
+		return call, call.check()
+	}
+
+	// A path, e.g., labels.MAINTAINER or labels["a.b"]
+	path := queryPath{names: []string{token.text}}
+	for parser.is(".", "[") {
+		if parser.take().text == "." {
+			name := parser.take()
+			if name.kind != "ident" {
+				return nil, fmt.Errorf("expected a name at %d", name.pos+1)
+			}
+			path.names = append(path.names, name.text)
+			continue
+		}
+		key := parser.take()
+		if key.kind != "string" {
+			return nil, fmt.Errorf("expected a string at %d", key.pos+1)
+		}
+		path.names = append(path.names, key.value.(string))
+		if err := parser.expect("]"); err != nil {
+			return nil, err
+		}
+	}
+	return path, nil
+}
+
+// Evaluation
+// .............................................................................
+
+// queryNode is a parsed expression, evaluated for the values of an app
+type queryNode interface {
+	eval(values map[string]interface{}) (interface{}, error)
+}
+
+type queryLiteral struct {
+	value interface{}
+}
+
+type queryPath struct {
+	names []string
+}
+
+type queryNot struct {
+	node queryNode
+}
+
+type queryLogic struct {
+	or          bool // otherwise, and
+	left, right queryNode
+}
+
+type queryCompare struct {
+	operator    string
+	left, right queryNode
+}
+
+type queryCall struct {
+	name string
+	args []queryNode
+}
+
+func (node queryLiteral) eval(values map[string]interface{}) (interface{}, error) {
+	return node.value, nil
+}
+
+// A name that isn't there is null
+func (node queryPath) eval(values map[string]interface{}) (interface{}, error) {
+	var value interface{} = values
+	for _, name := range node.names {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		value = object[name]
+	}
+	return value, nil
+}
+
+func (node queryNot) eval(values map[string]interface{}) (interface{}, error) {
+	value, err := node.node.eval(values)
+	return !truthy(value), err
+}
+
+func (node queryLogic) eval(values map[string]interface{}) (interface{}, error) {
+	left, err := node.left.eval(values)
+	if err != nil || truthy(left) == node.or {
+		return truthy(left), err
+	}
+	right, err := node.right.eval(values)
+	return truthy(right), err
+}
+
+func (node queryCompare) eval(values map[string]interface{}) (interface{}, error) {
+
+	left, err := node.left.eval(values)
+	if err != nil {
+		return nil, err
+	}
+	right, err := node.right.eval(values)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node.operator {
+	case "==":
+		return queryEqual(left, right), nil
+	case "!=":
+		return !queryEqual(left, right), nil
+	case "=~", "!~":
+		pattern, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a regular expression, not %s", node.operator, queryType(right))
+		}
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return queryMatch(left, expression) == (node.operator == "=~"), nil
+	case "contains":
+		switch left := left.(type) {
+		case nil:
+			return false, nil
+		case string:
+			substring, ok := right.(string)
+			return ok && strings.Contains(left, substring), nil
+		case []interface{}:
+			for _, item := range left {
+				if queryEqual(item, right) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			key, ok := right.(string)
+			_, found := left[key]
+			return ok && found, nil
+		}
+		return nil, fmt.Errorf("contains needs a string, list or object, not %s", queryType(left))
+	}
+
+	// The order of numbers, or strings
+	if a, ok := left.(float64); ok {
+		if b, ok := right.(float64); ok {
+			return map[string]bool{"<": a < b, "<=": a <= b, ">": a > b, ">=": a >= b}[node.operator], nil
+		}
+	}
+	if a, ok := left.(string); ok {
+		if b, ok := right.(string); ok {
+			return map[string]bool{"<": a < b, "<=": a <= b, ">": a > b, ">=": a >= b}[node.operator], nil
+		}
+	}
+	return nil, fmt.Errorf("cannot compare %s %s %s", queryType(left), node.operator, queryType(right))
+}
+
+// check makes sure the function exists, and has its arguments
+func (node queryCall) check() error {
+	if node.name != "len" {
+		return fmt.Errorf("%s is not a function (len)", node.name)
+	}
+	if len(node.args) != 1 {
+		return fmt.Errorf("len takes one argument")
+	}
+	return nil
+}
+
+func (node queryCall) eval(values map[string]interface{}) (interface{}, error) {
+	value, err := node.args[0].eval(values)
+	if err != nil {
+		return nil, err
+	}
+	switch value := value.(type) {
+	case nil:
+		return float64(0), nil
+	case string:
+		return float64(len(value)), nil
+	case []interface{}:
+		return float64(len(value)), nil
+	case map[string]interface{}:
+		return float64(len(value)), nil
+	}
+	return nil, fmt.Errorf("len needs a string, list or object, not %s", queryType(value))
+}
+
+// truthy determines if a value is true: not null, false, 0, "" or empty
+func truthy(value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return value
+	case float64:
+		return value != 0
+	case string:
+		return value != ""
+	case []interface{}:
+		return len(value) > 0
+	case map[string]interface{}:
+		return len(value) > 0
+	}
+	return true
+}
+
+// queryEqual compares two values
+func queryEqual(left interface{}, right interface{}) bool {
+	return reflect.DeepEqual(left, right)
+}
+
+// queryMatch determines if a string, or any string in a list or object
+// (at any depth), matches a regular expression
+func queryMatch(value interface{}, expression *regexp.Regexp) bool {
+	switch value := value.(type) {
+	case string:
+		return expression.MatchString(value)
+	case []interface{}:
+		for _, item := range value {
+			if queryMatch(item, expression) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range value {
+			if queryMatch(item, expression) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// queryType names the type of a value, for errors
+func queryType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "a list"
+	}
+	return "an object"
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"testing"
+)
+
+// TestQuery tests selecting apps of an inspect document with expressions
+func TestQuery(t *testing.T) {
+
+	document := InspectDocument{Data: []InspectResource{
+		{Type: "app", ID: "align", Attributes: InspectAttributes{Installed: true,
+			Sections: map[string][]string{"apprun": {"bwa mem"}, "apptest": {"bwa"}},
+			Labels:   map[string]string{"LICENSE": "GPL-3.0", "org.label-schema.name": "align"},
+			Commands: []string{"bwa", "python"},
+			Files:    InspectUsage{Count: 3, Size: 2048}}},
+		{Type: "app", ID: "plot", Attributes: InspectAttributes{Installed: true,
+			Sections: map[string][]string{"apprun": {"plot"}},
+			Labels:   map[string]string{"LICENSE": "MIT"},
+			Tests:    []InspectTestCase{{Name: "small"}},
+			Files:    InspectUsage{Count: 1, Size: 10}}},
+		{Type: "app", ID: "notes", Attributes: InspectAttributes{}},
+	}}
+
+	var queries = []struct {
+		expression string
+		expected   []string
+	}{
+		{`not sections.apptest and len(tests) == 0`, []string{"notes"}},
+		{`commands contains "python"`, []string{"align"}},
+		{`labels =~ "GPL"`, []string{"align"}},
+		{`labels["org.label-schema.name"] == 'align'`, []string{"align"}},
+		{`files.size > 100 || name =~ "^n"`, []string{"align", "notes"}},
+		{`!installed`, []string{"notes"}},
+		{`labels contains "LICENSE" and (labels.LICENSE != "MIT")`, []string{"align"}},
+		{`missing.value == null and name >= "notes"`, []string{"plot", "notes"}},
+		{`labels.LICENSE =~ '^GPL-\d\.0$'`, []string{"align"}},
+		{`name == 'pl\ot' or name == "it's" or labels.LICENSE == 'M\IT'`, []string{}},
+		{`name =~ "^\"?al\\w+$"`, []string{"align"}},
+	}
+	for _, tt := range queries {
+		query, err := parseQuery(tt.expression)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %v", tt.expression, err)
+		}
+		matches, err := queryDocument(query, document)
+		if err != nil {
+			t.Fatalf("Error evaluating %s: %v", tt.expression, err)
+		}
+		var names []string
+		for _, app := range matches {
+			names = append(names, app.ID)
+		}
+		if !Equal(names, tt.expected) {
+			t.Errorf("%s: got %v, want %v", tt.expression, names, tt.expected)
+		}
+	}
+
+	for _, bad := range []string{`name ==`, `(name == "a"`, `size(name)`, `"open`, `name == "a" name`, `labels.`, `name @ 1`} {
+		if _, err := parseQuery(bad); err == nil {
+			t.Errorf("Expected an error parsing %s", bad)
+		}
+	}
+	query, _ := parseQuery(`labels > 1`)
+	if _, err := queryDocument(query, document); err == nil {
+		t.Errorf("Expected an error comparing an object and a number")
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Some settings for an app process (limits, a cgroup) must be in place before
+// the app starts, and can't be set from outside without a race. For these,
+// scif starts itself with an execConfig in the environment, and the init
+// below applies the settings and then replaces itself with the app.
+
+// execConfigEnv holds the (json) execConfig for a process started by scif
+const execConfigEnv = "SCIF_EXEC_CONFIG"
+
+// execConfig describes what to do before executing the app
+type execConfig struct {
+	Path    string       `json:"path"`    // full path of the executable
+	Args    []string     `json:"args"`    // arguments, including the command
+	Rlimits []execRlimit `json:"rlimits"` // limits to set
+	Cgroup  string       `json:"cgroup"`  // cgroup directory to join
+
+	Sandbox *sandboxConfig `json:"sandbox"` // sandbox to set up, if any
+	Probe   bool           `json:"probe"`   // only set up the sandbox, and exit
+}
+
+// execRlimit is a limit to set with setrlimit
+type execRlimit struct {
+	Resource int    `json:"resource"`
+	Limit    uint64 `json:"limit"`
+}
+
+func init() {
+
+	// The builtin shell (shell_builtin.go), the supervisors of a detached job
+	// (jobs.go) and a service (services.go), and the shell functions to
+	// activate apps (shell_rc.go) are also scif started again, as is scif by
+	// the init (init.go). Settings for the process come first,
+	// so these are checked after. Each is marked by a variable in the
+	// environment, and a process without one is left alone.
+	value, ok := os.LookupEnv(execConfigEnv)
+	if !ok {
+		if _, ok := os.LookupEnv(initChildEnv); ok {
+			os.Unsetenv(initChildEnv)
+			underInit = true
+		}
+		if action, ok := os.LookupEnv(shellExportsEnv); ok {
+			os.Unsetenv(shellExportsEnv)
+			os.Exit(printShellExports(action, os.Args[1:]))
+		}
+		if _, ok := os.LookupEnv(builtinShellEnv); ok {
+			os.Exit(runBuiltinShell(os.Args[1:]))
+		}
+		if path, ok := os.LookupEnv(jobEnv); ok {
+			os.Unsetenv(jobEnv)
+			os.Exit(superviseJob(path))
+		}
+		if path, ok := os.LookupEnv(serviceEnv); ok {
+			os.Unsetenv(serviceEnv)
+			os.Exit(superviseService(path))
+		}
+		return
+	}
+	os.Unsetenv(execConfigEnv)
+
+	var config execConfig
+	err := json.Unmarshal([]byte(value), &config)
+
+	// A probe checks that the sandbox can be set up (see probeSandbox)
+	if err == nil && config.Probe && config.Sandbox != nil {
+		if err := config.Sandbox.setup(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if err == nil {
+		err = config.exec()
+	}
+
+	// If we get here, the app was not executed
+	fmt.Fprintf(os.Stderr, "scif: cannot execute %s: %s\n", config.Path, err)
+	os.Exit(127)
+}
+
+// exec applies the config to the current process, and executes the app
+func (config execConfig) exec() error {
+
+	if config.Cgroup != "" {
+		if err := joinCgroup(config.Cgroup); err != nil {
+			return err
+		}
+	}
+
+	if config.Sandbox != nil {
+		if err := config.Sandbox.setup(); err != nil {
+			return err
+		}
+	}
+
+	for _, rlimit := range config.Rlimits {
+
+		// We can lower (but not raise) the hard limit
+		var current unix.Rlimit
+		if err := unix.Getrlimit(rlimit.Resource, &current); err != nil {
+			return err
+		}
+		limit := rlimit.Limit
+		if limit > current.Max {
+			limit = current.Max
+		}
+
+		if err := unix.Setrlimit(rlimit.Resource, &unix.Rlimit{Cur: limit, Max: limit}); err != nil {
+			return fmt.Errorf("setrlimit: %s", err)
+		}
+	}
+
+	return syscall.Exec(config.Path, config.Args, os.Environ())
+}
+
+// wrapProcess changes a process (not yet started) to start scif with the
+// config, which will then execute the original command.
+func wrapProcess(process *exec.Cmd, config execConfig) error {
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	config.Path = process.Path
+	config.Args = process.Args
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	if process.Env == nil {
+		process.Env = os.Environ()
+	}
+	process.Env = append(process.Env, execConfigEnv+"="+string(value))
+	process.Path = self
+	process.Args = []string{process.Args[0]}
+	return nil
+}
@@ -0,0 +1,413 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The results of scif test can be written as a report for CI, in one of
+// these formats, to a file or to stdout (see ParseReport):
+//
+//	junit  JUnit XML, with a test suite for each app
+//	tap    the Test Anything Protocol (version 13)
+//	json   the TestReport below
+//
+// Each test is a case, with its duration, exit code, a failure message and
+// the output (which is also shown, unless the report is on stdout).
+
+// Report formats
+const (
+	ReportJUnit = "junit"
+	ReportTAP   = "tap"
+	ReportJSON  = "json"
+)
+
+// Test statuses
+const (
+	TestPassed  = "passed"
+	TestFailed  = "failed"
+	TestSkipped = "skipped" // the app has no tests
+	TestError   = "error"   // the test could not be run
+)
+
+// TestCase is the result of a test of an app
+type TestCase struct {
+	App      string    `json:"app"`
+	Name     string    `json:"name,omitempty"`
+	Status   string    `json:"status"`
+	ExitCode int       `json:"exit_code"`
+	Signal   string    `json:"signal,omitempty"`
+	TimedOut bool      `json:"timed_out,omitempty"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"` // in seconds
+	Message  string    `json:"message,omitempty"`
+	Diff     string    `json:"diff,omitempty"`    // of the output and what was expected
+	Dir      string    `json:"testdir,omitempty"` // the scratch directory, if it was kept
+	Stdout   string    `json:"stdout"`
+	Stderr   string    `json:"stderr"`
+
+	status int // the exit status, as RunResult.Status
+}
+
+// TestReport is the result of testing one or more apps
+type TestReport struct {
+	Start    time.Time  `json:"start"`
+	Duration float64    `json:"duration"` // in seconds
+	Tests    int        `json:"tests"`
+	Passed   int        `json:"passed"`
+	Failed   int        `json:"failed"`
+	Skipped  int        `json:"skipped"`
+	Errors   int        `json:"errors"`
+	Cases    []TestCase `json:"cases"`
+}
+
+// ParseReport parses the value of --report, a format with an optional
+// path (e.g., junit=report.xml). Without a path, the report is for stdout.
+func ParseReport(value string) (string, string, error) {
+
+	format, path := value, ""
+	if equals := strings.Index(value, "="); equals >= 0 {
+		format, path = value[:equals], value[equals+1:]
+	}
+	switch format {
+	case ReportJUnit, ReportTAP, ReportJSON:
+		return format, path, nil
+	}
+	return "", "", fmt.Errorf("%s is not a report format (junit, tap or json)", format)
+}
+
+// failureMessage describes why a test failed, or is empty if it passed
+func failureMessage(result *RunResult) string {
+	switch {
+	case result.TimedOut():
+		return "timed out"
+	case result.Limit != "":
+		return fmt.Sprintf("stopped by its %s limit", result.Limit)
+	case result.Signal != 0:
+		return fmt.Sprintf("killed by %s", result.Signal)
+	case result.ExitCode != 0:
+		return fmt.Sprintf("exit code %d", result.ExitCode)
+	}
+	return ""
+}
+
+// teeWriter writes to the buffer, and to the writer if there is one
+func teeWriter(writer io.Writer, buffer *bytes.Buffer) io.Writer {
+	if writer == nil {
+		return buffer
+	}
+	return io.MultiWriter(writer, buffer)
+}
+
+// add adds a case to the report, and counts it
+func (report *TestReport) add(test TestCase) {
+
+	report.Cases = append(report.Cases, test)
+	report.Tests++
+	switch test.Status {
+	case TestPassed:
+		report.Passed++
+	case TestFailed:
+		report.Failed++
+	case TestSkipped:
+		report.Skipped++
+	case TestError:
+		report.Errors++
+	}
+}
+
+// Ok returns true if no test failed (or could not be run)
+func (report *TestReport) Ok() bool {
+	return report.Failed == 0 && report.Errors == 0
+}
+
+// ExitStatus returns 0 if no test failed, or 1. A single test that failed
+// with a non-zero status exits with it, as the test would.
+func (report *TestReport) ExitStatus() int {
+	if report.Ok() {
+		return 0
+	}
+	if len(report.Cases) == 1 && report.Cases[0].status != 0 {
+		return report.Cases[0].status
+	}
+	return 1
+}
+
+// WriteFile writes the report in a format to a path, or to stdout if the
+// path is empty
+func (report *TestReport) WriteFile(format string, path string) error {
+
+	if path == "" {
+		return report.Write(format, os.Stdout)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(format, file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Write writes the report in a format (junit, tap or json)
+func (report *TestReport) Write(format string, writer io.Writer) error {
+
+	switch format {
+	case ReportJUnit:
+		return report.writeJUnit(writer)
+	case ReportTAP:
+		return report.writeTAP(writer)
+	case ReportJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return fmt.Errorf("%s is not a report format (junit, tap or json)", format)
+}
+
+// PrintSummary prints a table of the cases, with the status and duration of
+// each, and the totals
+func (report *TestReport) PrintSummary(writer io.Writer) {
+
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "APP\tSTATUS\tDURATION\tMESSAGE")
+	for _, test := range report.Cases {
+		fmt.Fprintf(table, "%s\t%s\t%.2fs\t%s\n", test.describe(), test.Status, test.Duration, test.Message)
+	}
+	table.Flush()
+
+	fmt.Fprintf(writer, "\n%d passed, %d failed, %d skipped, %d errors in %.2fs\n",
+		report.Passed, report.Failed, report.Skipped, report.Errors, report.Duration)
+}
+
+// PrintFailures prints why the cases that failed did, with a diff for an
+// output that isn't what was expected, and the output of the tests if it
+// was kept rather than shown
+func (report *TestReport) PrintFailures(writer io.Writer, output bool) {
+
+	for _, test := range report.Cases {
+		if test.Status != TestFailed && test.Status != TestError {
+			continue
+		}
+		fmt.Fprintf(writer, "--- %s %s: %s\n", strings.ToUpper(test.Status), test.describe(), test.Message)
+		if test.Diff != "" {
+			fmt.Fprintln(writer, test.Diff)
+		}
+		if output {
+			for _, text := range []string{test.Stdout, test.Stderr} {
+				if text = strings.TrimRight(text, "\n"); text != "" {
+					fmt.Fprintln(writer, text)
+				}
+			}
+		}
+		fmt.Fprintln(writer)
+	}
+}
+
+// describe names the case, its app (and the name of the case, if it has one)
+func (test TestCase) describe() string {
+	if test.Name != "" {
+		return test.App + " " + test.Name
+	}
+	return test.App
+}
+
+// JUnit XML, as read by Jenkins, GitLab and most CI services
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	Stdout    string        `xml:"system-out,omitempty"`
+	Stderr    string        `xml:"system-err,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes the report as JUnit XML, with a suite for each app
+func (report *TestReport) writeJUnit(writer io.Writer) error {
+
+	suites := junitSuites{Name: "scif",
+		Tests:    report.Tests,
+		Failures: report.Failed,
+		Errors:   report.Errors,
+		Skipped:  report.Skipped,
+		Time:     seconds(report.Duration)}
+
+	index := make(map[string]int)
+	for _, test := range report.Cases {
+
+		i, ok := index[test.App]
+		if !ok {
+			i = len(suites.Suites)
+			index[test.App] = i
+			suites.Suites = append(suites.Suites, junitSuite{Name: test.App, Timestamp: test.Start.Format("2006-01-02T15:04:05")})
+		}
+		suite := &suites.Suites[i]
+
+		name := test.Name
+		if name == "" {
+			name = test.App
+		}
+		testcase := junitCase{Name: name, Classname: test.App, Time: seconds(test.Duration), Stdout: test.Stdout, Stderr: test.Stderr}
+
+		suite.Tests++
+		switch test.Status {
+		case TestFailed:
+			suite.Failures++
+			testcase.Failure = &junitMessage{Message: test.Message, Type: "exit", Text: strings.TrimSpace(test.Message + "\n" + test.Diff)}
+			if test.TimedOut {
+				testcase.Failure.Type = "timeout"
+			}
+		case TestError:
+			suite.Errors++
+			testcase.Error = &junitMessage{Message: test.Message}
+		case TestSkipped:
+			suite.Skipped++
+			testcase.Skipped = &junitMessage{Message: test.Message}
+		}
+		suite.Cases = append(suite.Cases, testcase)
+	}
+
+	// The time of a suite is the sum of its cases
+	for i := range suites.Suites {
+		var total float64
+		for _, test := range report.Cases {
+			if test.App == suites.Suites[i].Name {
+				total += test.Duration
+			}
+		}
+		suites.Suites[i].Time = seconds(total)
+	}
+
+	if _, err := io.WriteString(writer, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(writer)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(writer, "\n")
+	return err
+}
+
+// writeTAP writes the report in TAP version 13, with the details of a case
+// that didn't pass in a YAML block
+func (report *TestReport) writeTAP(writer io.Writer) error {
+
+	var lines []string
+	lines = append(lines, "TAP version 13", fmt.Sprintf("1..%d", len(report.Cases)))
+
+	for i, test := range report.Cases {
+
+		description := test.describe()
+
+		switch test.Status {
+		case TestPassed:
+			lines = append(lines, fmt.Sprintf("ok %d - %s", i+1, description))
+			continue
+		case TestSkipped:
+			lines = append(lines, fmt.Sprintf("ok %d - %s # SKIP %s", i+1, description, test.Message))
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("not ok %d - %s", i+1, description),
+			"  ---",
+			"  status: "+test.Status,
+			"  message: "+yamlString(test.Message),
+			fmt.Sprintf("  exit_code: %d", test.ExitCode))
+		if test.Signal != "" {
+			lines = append(lines, "  signal: "+yamlString(test.Signal))
+		}
+		if test.TimedOut {
+			lines = append(lines, "  timed_out: true")
+		}
+		lines = append(lines, "  duration_ms: "+fmt.Sprintf("%.0f", test.Duration*1000))
+		lines = append(lines, yamlBlock("diff", test.Diff)...)
+		lines = append(lines, yamlBlock("stdout", test.Stdout)...)
+		lines = append(lines, yamlBlock("stderr", test.Stderr)...)
+		lines = append(lines, "  ...")
+	}
+
+	_, err := io.WriteString(writer, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// yamlString quotes a string for YAML (JSON strings are valid YAML)
+func yamlString(value string) string {
+	quoted, _ := json.Marshal(value)
+	return string(quoted)
+}
+
+// yamlBlock returns the lines of a literal block for a key, or none if the
+// value is empty
+func yamlBlock(key string, value string) []string {
+
+	value = strings.TrimRight(value, "\n")
+	if value == "" {
+		return nil
+	}
+	lines := []string{"  " + key + ": |"}
+	for _, line := range strings.Split(value, "\n") {
+		lines = append(lines, "    "+line)
+	}
+	return lines
+}
+
+// seconds formats a duration in seconds for JUnit
+func seconds(duration float64) string {
+	return fmt.Sprintf("%.3f", duration)
+}
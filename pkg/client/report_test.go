@@ -0,0 +1,115 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseReport tests parsing the format and path of a report
+func TestParseReport(t *testing.T) {
+
+	format, path, err := ParseReport("junit=out/report.xml")
+	if err != nil || format != ReportJUnit || path != "out/report.xml" {
+		t.Errorf("Incorrect report %s, %s (%v)", format, path, err)
+	}
+	format, path, err = ParseReport("tap")
+	if err != nil || format != ReportTAP || path != "" {
+		t.Errorf("Incorrect report %s, %s (%v)", format, path, err)
+	}
+	if _, _, err := ParseReport("xml=report.xml"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
+
+// TestTestApps tests testing apps, and writing the reports
+func TestRunTests(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+
+	if err := Install("../../hello-world.scif", []string{}, true); err != nil {
+		t.Errorf("Error installing temporary SCIF: %v", err)
+	}
+
+	// The test of hello-world-script exits with its argument
+	names := []string{"hello-world-script", "hello-world-echo", "doesnt-exist"}
+	report := RunTests(context.Background(), names, RunSpec{Args: []string{"2"}}, TestOptions{})
+
+	if report.Tests != 3 || report.Failed != 1 || report.Skipped != 1 || report.Errors != 1 || report.Ok() {
+		t.Errorf("Incorrect counts in the report %+v", report)
+	}
+	test := report.Cases[0]
+	if test.Status != TestFailed || test.ExitCode != 2 || test.Message != "exit code 2" || !strings.Contains(test.Stdout, "Running tests!") {
+		t.Errorf("Incorrect case %+v", test)
+	}
+
+	var junit bytes.Buffer
+	if err := report.Write(ReportJUnit, &junit); err != nil {
+		t.Errorf("Error writing JUnit: %v", err)
+	}
+	var suites junitSuites
+	if err := xml.Unmarshal(junit.Bytes(), &suites); err != nil {
+		t.Errorf("Error reading JUnit: %v", err)
+	}
+	if len(suites.Suites) != 3 || suites.Failures != 1 || suites.Suites[0].Cases[0].Failure == nil {
+		t.Errorf("Incorrect JUnit %+v", suites)
+	}
+
+	var tap bytes.Buffer
+	report.Write(ReportTAP, &tap)
+	for _, line := range []string{"1..3", "not ok 1 - hello-world-script", "ok 2 - hello-world-echo # SKIP", "not ok 3 - doesnt-exist"} {
+		if !strings.Contains(tap.String(), line) {
+			t.Errorf("Expected %q in TAP:\n%s", line, tap.String())
+		}
+	}
+
+	var decoded TestReport
+	var encoded bytes.Buffer
+	report.Write(ReportJSON, &encoded)
+	if err := json.Unmarshal(encoded.Bytes(), &decoded); err != nil || decoded.Failed != 1 {
+		t.Errorf("Incorrect JSON report %s (%v)", encoded.String(), err)
+	}
+
+	// Running them at once gives the same report, in the same order
+	parallel := RunTests(context.Background(), names, RunSpec{Args: []string{"2"}}, TestOptions{Jobs: 3})
+	for i, test := range parallel.Cases {
+		if test.App != names[i] || test.Status != report.Cases[i].Status {
+			t.Errorf("Incorrect case %d when run at once %+v", i, test)
+		}
+	}
+
+	// With fail fast, the tests after a failure aren't run
+	failFast := RunTests(context.Background(), names, RunSpec{Args: []string{"2"}}, TestOptions{FailFast: true})
+	if failFast.Skipped != 2 || failFast.Cases[2].Message != "not run (fail fast)" {
+		t.Errorf("Incorrect report with fail fast %+v", failFast)
+	}
+}
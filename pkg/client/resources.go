@@ -0,0 +1,260 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+)
+
+// Resources are optional limits for the processes of an app. They are read
+// from the %appresources section of an app (or labels starting with
+// "resources."), and can be overridden for a single run. A zero value means
+// no limit. For example:
+//
+//	%appresources fastqc
+//	    memory 4G
+//	    cpus 1.5
+//	    pids 64
+//	    walltime 2h
+//	    nofile 1024
+//	    timeout 30m
+//	    quota 10G
+//
+// Limits are enforced with a delegated cgroup v2 sub-tree (memory, cpu and
+// pids) if one is writable, and open files with setrlimit. Without a cgroup,
+// memory is limited as the address space (setrlimit), and the CPU quota and
+// pids can't be enforced (RLIMIT_NPROC counts all processes of the user,
+// not those of the app). The wall time kills the
+// app, while the timeout stops it (SIGTERM, and then SIGKILL), and the run
+// is reported as timed out (see RunResult.TimedOut). The quota is for the
+// data folder of the app, and is only checked by scif du --threshold.
+//
+// Only the limits of a cgroup (memory and pids), the wall time and the
+// timeout are reported as the limit that stopped an app. An rlimit (open
+// files, or memory without a cgroup) makes a call fail in the app, which
+// handles it (or not) like any error, so it isn't reported.
+type Resources struct {
+	Memory   int64         // bytes of memory
+	CPUs     float64       // CPU quota, in cores
+	Pids     int64         // maximum number of processes
+	WallTime time.Duration // wall time before the app is killed
+	NoFile   uint64        // maximum number of open files
+	Timeout  time.Duration // time before the app is stopped, as timed out
+	Quota    int64         // bytes in the data folder of the app (see du.go)
+}
+
+// Names of resource limits, as used in recipes, labels, flags and results
+const (
+	resourceMemory   = "memory"
+	resourceCPUs     = "cpus"
+	resourcePids     = "pids"
+	resourceWallTime = "walltime"
+	resourceNoFile   = "nofile"
+	resourceTimeout  = "timeout"
+	resourceQuota    = "quota"
+)
+
+// resourceLabelPrefix is the prefix for labels that set resources
+const resourceLabelPrefix = "resources."
+
+// Set parses the value for a named resource (e.g., memory 512M)
+func (resources *Resources) Set(key string, value string) (err error) {
+
+	value = strings.TrimSpace(value)
+
+	switch strings.ToLower(key) {
+	case resourceMemory:
+		resources.Memory, err = parseBytes(value)
+	case resourceCPUs:
+		resources.CPUs, err = strconv.ParseFloat(value, 64)
+	case resourcePids:
+		resources.Pids, err = strconv.ParseInt(value, 10, 64)
+	case resourceWallTime:
+		resources.WallTime, err = time.ParseDuration(value)
+	case resourceNoFile:
+		resources.NoFile, err = strconv.ParseUint(value, 10, 64)
+	case resourceTimeout:
+		resources.Timeout, err = time.ParseDuration(value)
+	case resourceQuota:
+		resources.Quota, err = parseBytes(value)
+	default:
+		return fmt.Errorf("%s is not a valid resource", key)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %s", key, value, err)
+	}
+	if resources.Memory < 0 || resources.CPUs < 0 || resources.Pids < 0 || resources.WallTime < 0 || resources.Timeout < 0 || resources.Quota < 0 {
+		return fmt.Errorf("invalid %s %q: must not be negative", key, value)
+	}
+	return nil
+}
+
+// Merge returns the resources, with the limits that are set in other
+// taking precedence.
+func (resources Resources) Merge(other Resources) Resources {
+
+	if other.Memory > 0 {
+		resources.Memory = other.Memory
+	}
+	if other.CPUs > 0 {
+		resources.CPUs = other.CPUs
+	}
+	if other.Pids > 0 {
+		resources.Pids = other.Pids
+	}
+	if other.WallTime > 0 {
+		resources.WallTime = other.WallTime
+	}
+	if other.NoFile > 0 {
+		resources.NoFile = other.NoFile
+	}
+	if other.Timeout > 0 {
+		resources.Timeout = other.Timeout
+	}
+	if other.Quota > 0 {
+		resources.Quota = other.Quota
+	}
+	return resources
+}
+
+// IsZero determines if no limits are set
+func (resources Resources) IsZero() bool {
+	return resources == Resources{}
+}
+
+// String shows the limits that are set, e.g., "memory=4G cpus=1.5"
+func (resources Resources) String() string {
+
+	var limits []string
+	if resources.Memory > 0 {
+		limits = append(limits, resourceMemory+"="+formatBytes(resources.Memory))
+	}
+	if resources.CPUs > 0 {
+		limits = append(limits, resourceCPUs+"="+strconv.FormatFloat(resources.CPUs, 'f', -1, 64))
+	}
+	if resources.Pids > 0 {
+		limits = append(limits, fmt.Sprintf("%s=%d", resourcePids, resources.Pids))
+	}
+	if resources.WallTime > 0 {
+		limits = append(limits, resourceWallTime+"="+resources.WallTime.String())
+	}
+	if resources.NoFile > 0 {
+		limits = append(limits, fmt.Sprintf("%s=%d", resourceNoFile, resources.NoFile))
+	}
+	if resources.Timeout > 0 {
+		limits = append(limits, resourceTimeout+"="+resources.Timeout.String())
+	}
+	if resources.Quota > 0 {
+		limits = append(limits, resourceQuota+"="+formatBytes(resources.Quota))
+	}
+	return strings.Join(limits, " ")
+}
+
+// describe shows a single limit, e.g., "memory limit (4G)"
+func (resources Resources) describe(name string) string {
+	for _, limit := range strings.Fields(resources.String()) {
+		if strings.HasPrefix(limit, name+"=") {
+			return fmt.Sprintf("%s limit (%s)", name, strings.TrimPrefix(limit, name+"="))
+		}
+	}
+	return name + " limit"
+}
+
+// getResources returns the resources for an app, from labels and then the
+// %appresources section. Invalid lines are skipped with a warning.
+func (client ScifClient) getResources(name string) Resources {
+
+	var resources Resources
+	settings := Scif.config[name]
+
+	for key, value := range parseKeyValues(settings.labels) {
+		if strings.HasPrefix(strings.ToLower(key), resourceLabelPrefix) {
+			key = key[len(resourceLabelPrefix):]
+			if err := resources.Set(key, value); err != nil {
+				logger.Warningf("%s label: %s", name, err)
+			}
+		}
+	}
+
+	for key, value := range parseKeyValues(settings.resources) {
+		if err := resources.Set(key, value); err != nil {
+			logger.Warningf("%s %%appresources: %s", name, err)
+		}
+	}
+	return resources
+}
+
+// parseKeyValues parses lines of "KEY value" or "KEY=value" pairs into a map.
+// Lines without a value are skipped.
+func parseKeyValues(lines []string) map[string]string {
+
+	pairs := make(map[string]string)
+	for _, line := range lines {
+
+		line = strings.TrimSpace(line)
+		line = strings.Replace(line, "=", " ", 1)
+		parts := strings.SplitN(line, " ", 2)
+
+		if len(parts) > 1 {
+			pairs[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return pairs
+}
+
+// byteUnits are the (binary) suffixes for sizes, e.g., 512M
+var byteUnits = []string{"K", "M", "G", "T"}
+
+// parseBytes parses a size with an optional binary suffix (512M, 2Gi, 1GB)
+func parseBytes(value string) (int64, error) {
+
+	number := strings.ToUpper(value)
+	number = strings.TrimSuffix(number, "B")
+	number = strings.TrimSuffix(number, "I")
+
+	multiplier := int64(1)
+	for i, unit := range byteUnits {
+		if strings.HasSuffix(number, unit) {
+			number = strings.TrimSuffix(number, unit)
+			multiplier = int64(1) << (10 * uint(i+1))
+			break
+		}
+	}
+
+	size, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil {
+		return 0, fmt.Errorf("not a size")
+	}
+	return int64(size * float64(multiplier)), nil
+}
+
+// formatBytes shows a size with the largest binary suffix that is exact
+func formatBytes(size int64) string {
+
+	for i := len(byteUnits) - 1; i >= 0; i-- {
+		multiplier := int64(1) << (10 * uint(i+1))
+		if size >= multiplier && size%multiplier == 0 {
+			return fmt.Sprintf("%d%s", size/multiplier, byteUnits[i])
+		}
+	}
+	return fmt.Sprintf("%d", size)
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// TestResourcesSet tests parsing resource limits from strings
+func TestResourcesSet(t *testing.T) {
+
+	var limits = []struct {
+		key      string
+		value    string
+		expected Resources
+	}{
+		{"memory", "512M", Resources{Memory: 512 << 20}},
+		{"memory", "2Gi", Resources{Memory: 2 << 30}},
+		{"MEMORY", "1.5GB", Resources{Memory: 3 << 29}},
+		{"memory", "4096", Resources{Memory: 4096}},
+		{"cpus", "1.5", Resources{CPUs: 1.5}},
+		{"pids", "64", Resources{Pids: 64}},
+		{"walltime", "2h", Resources{WallTime: 2 * time.Hour}},
+		{"nofile", "1024", Resources{NoFile: 1024}},
+		{"timeout", "10m", Resources{Timeout: 10 * time.Minute}},
+		{"quota", "10G", Resources{Quota: 10 << 30}},
+	}
+
+	for _, tt := range limits {
+		t.Run(tt.key+" "+tt.value, func(t *testing.T) {
+			var resources Resources
+			if err := resources.Set(tt.key, tt.value); err != nil {
+				t.Fatalf("Error setting %s: %v", tt.key, err)
+			}
+			if resources != tt.expected {
+				t.Errorf("got %+v, want %+v", resources, tt.expected)
+			}
+		})
+	}
+
+	// Invalid limits
+	var resources Resources
+	for _, pair := range [][2]string{{"memory", "lots"}, {"cpus", "-1"}, {"walltime", "1 day"}, {"disk", "1G"}} {
+		if err := resources.Set(pair[0], pair[1]); err == nil {
+			t.Errorf("Expected error setting %s to %s", pair[0], pair[1])
+		}
+	}
+}
+
+// TestResourcesMerge tests that set limits override others when merging
+func TestResourcesMerge(t *testing.T) {
+
+	app := Resources{Memory: 1 << 30, Pids: 10}
+	merged := app.Merge(Resources{Pids: 20, WallTime: time.Minute})
+
+	expected := Resources{Memory: 1 << 30, Pids: 20, WallTime: time.Minute}
+	if merged != expected {
+		t.Errorf("got %+v, want %+v", merged, expected)
+	}
+
+	if merged.String() != "memory=1G pids=20 walltime=1m0s" {
+		t.Errorf("Incorrect string for resources, got %q", merged.String())
+	}
+
+	if !(Resources{}).IsZero() || merged.IsZero() {
+		t.Errorf("Incorrect IsZero for resources")
+	}
+}
+
+// TestParseKeyValues tests parsing labels and resources sections
+func TestParseKeyValues(t *testing.T) {
+
+	pairs := parseKeyValues([]string{"    MAINTAINER Vanessa Sochat", "memory=4G", "EMPTY"})
+
+	if pairs["MAINTAINER"] != "Vanessa Sochat" || pairs["memory"] != "4G" {
+		t.Errorf("Incorrect pairs, got %v", pairs)
+	}
+	if _, ok := pairs["EMPTY"]; ok {
+		t.Errorf("A key without a value should be skipped, got %v", pairs)
+	}
+}
+
+// TestResourceRlimits tests that pids are never an rlimit (RLIMIT_NPROC is
+// for the user), and memory is only the address space without a cgroup
+func TestResourceRlimits(t *testing.T) {
+
+	resources := Resources{Memory: 1 << 30, Pids: 10, NoFile: 100}
+	process, cg, err := ScifClient{}.newProcess(RunSpec{App: "hello-custom"}, "/bin/true", nil, "", resources, -1, nil)
+	if err != nil {
+		t.Fatalf("Error creating process: %v", err)
+	}
+	if cg != nil {
+		defer cg.remove()
+	}
+
+	var config execConfig
+	for _, pair := range process.Env {
+		if strings.HasPrefix(pair, execConfigEnv+"=") {
+			json.Unmarshal([]byte(strings.TrimPrefix(pair, execConfigEnv+"=")), &config)
+		}
+	}
+
+	limits := map[int]uint64{}
+	for _, rlimit := range config.Rlimits {
+		limits[rlimit.Resource] = rlimit.Limit
+	}
+	if limits[unix.RLIMIT_NOFILE] != 100 {
+		t.Errorf("Expected a limit for open files, got %v", config.Rlimits)
+	}
+	if _, ok := limits[unix.RLIMIT_NPROC]; ok {
+		t.Errorf("Expected no RLIMIT_NPROC for pids, got %v", config.Rlimits)
+	}
+	if _, ok := limits[unix.RLIMIT_AS]; ok == (cg != nil) {
+		t.Errorf("Expected the address space to be limited only without a cgroup (%v), got %v", cg, config.Rlimits)
+	}
+}
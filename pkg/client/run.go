@@ -16,29 +16,20 @@
 package client
 
 import (
-	"github.com/sci-f/scif-go/internal/pkg/logger"
-	"github.com/sci-f/scif-go/pkg/util"
+	"os"
 )
 
 // Run an app for a scientific filesystem. If a user chooses
-// This option, we know we are loading a Filesystem first.
-func Run(name string, cmd []string) (err error) {
-
-	// Running an app means we load from the filesystem first
-	cli := ScifClient{}.Load(Scif.Base)
-
-	// Ensure that the app exists on the filesystem
-	if ok := util.Contains(name, cli.apps()); !ok {
-		logger.Warningf("%s is not an installed app.", name)
-		return err
-	}
-
-	// Activate the app, meaning we set the active app environment
-	cli.activate(name)
-
-	// Add additional args to the entrypoint
-	logger.Debugf("Running app %s", name)
-
-	return cli.execute(name, cmd)
-
+// This option, we know we are loading a Filesystem first. The app is
+// connected to the terminal of the calling process.
+func Run(name string, cmd []string) (*RunResult, error) {
+
+	ctx, cancel := InterruptContext()
+	defer cancel()
+
+	return RunApp(ctx, RunSpec{App: name,
+		Args:   cmd,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr})
 }
@@ -0,0 +1,339 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/util"
+	"github.com/sci-f/scif-go/pkg/version"
+)
+
+// A provenance record is written for each execution of an app when it is
+// requested by RunSpec.Provenance (--provenance) or SCIF_PROVENANCE, so that
+// results can be traced back to the app (recipe) and command that made them.
+// Records are saved with the app data:
+//
+//	$SCIF_APPDATA_<app>/.scif/runs/<timestamp>-<id>.json
+
+// RunRecord is the provenance record of a single app execution
+type RunRecord struct {
+	ID         string            `json:"id"`
+	App        string            `json:"app"`
+	RecipeHash string            `json:"recipe_hash,omitempty"`
+	Argv       []string          `json:"argv"`
+	Env        map[string]string `json:"environment"`
+	Dir        string            `json:"working_dir"`
+	User       string            `json:"user"`
+	Host       string            `json:"host"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	ExitCode   int               `json:"exit_code"`
+	Signal     string            `json:"signal,omitempty"`
+	Limit      string            `json:"limit,omitempty"`
+	Rusage     *RunUsage         `json:"rusage,omitempty"`
+	Version    string            `json:"scif_version"`
+}
+
+// RunUsage is the resource usage of an execution, from wait(2). Times are
+// in seconds, and the max resident set size is in kilobytes on Linux (but
+// bytes on macOS).
+type RunUsage struct {
+	UserTime        float64 `json:"user_time"`
+	SystemTime      float64 `json:"system_time"`
+	MaxRSS          int64   `json:"max_rss"`
+	MinorFaults     int64   `json:"minor_faults"`
+	MajorFaults     int64   `json:"major_faults"`
+	BlockInputs     int64   `json:"block_inputs"`
+	BlockOutputs    int64   `json:"block_outputs"`
+	VoluntarySwitch int64   `json:"voluntary_switches"`
+	ForcedSwitch    int64   `json:"involuntary_switches"`
+}
+
+// runsFolder is the folder for run records, under the app data
+const runsFolder = ".scif/runs"
+
+// redactedValue replaces the values of secrets in the recorded environment
+const redactedValue = "[redacted]"
+
+// secretPattern matches environment variables that likely hold secrets. AUTH
+// is a word of its own in the name (e.g., GIT_AUTH, but not AUTHOR).
+var secretPattern = regexp.MustCompile(`(?i)(SECRET|TOKEN|PASSW(OR)?D|PASSPHRASE|CREDENTIAL|PRIVATE|API_?KEY|ACCESS_?KEY|(^|_)AUTH(ORIZATION)?(_|$))`)
+
+// Runs prints the provenance records for an app (or all apps), or a single
+// record as json if an id is provided.
+func Runs(name string, id string) error {
+
+	// Records are read from the installed filesystem
+	cli := ScifClient{}.Load(Scif.Base)
+
+	if id != "" {
+		record, err := cli.getRun(name, id)
+		if err != nil {
+			return err
+		}
+		content, err := json.MarshalIndent(record, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(content))
+		return nil
+	}
+
+	records, err := cli.listRuns(name)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		logger.Infof("No runs recorded.")
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tAPP\tSTART\tDURATION\tEXIT\tCOMMAND")
+	for _, record := range records {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%d\t%s\n", record.ID, record.App,
+			record.Start.Local().Format("2006-01-02 15:04:05"),
+			record.End.Sub(record.Start).Round(time.Millisecond),
+			record.ExitCode, strings.Join(record.Argv, " "))
+	}
+	writer.Flush()
+	return nil
+}
+
+// ListRuns returns the provenance records for an installed app, or for all
+// apps if the name is empty, ordered by start time.
+func ListRuns(name string) ([]RunRecord, error) {
+	cli := ScifClient{}.Load(Scif.Base)
+	return cli.listRuns(name)
+}
+
+// listRuns reads the run records for an app, or all apps
+func (client ScifClient) listRuns(name string) ([]RunRecord, error) {
+
+	apps := client.apps()
+	if name != "" {
+		if !util.Contains(name, apps) {
+			return nil, fmt.Errorf("%s is not an installed app", name)
+		}
+		apps = []string{name}
+	}
+
+	var records []RunRecord
+	for _, app := range apps {
+		folder := filepath.Join(client.getAppenvLookup(app)["appdata"], runsFolder)
+		files, err := filepath.Glob(filepath.Join(folder, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			record, err := readRunRecord(file)
+			if err != nil {
+				logger.Warningf("Skipping run record %s: %s", file, err)
+				continue
+			}
+			records = append(records, record)
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Start.Before(records[j].Start)
+	})
+	return records, nil
+}
+
+// getRun returns one run record, by id (or the random part of it). If the
+// name is empty, the records of all apps are searched.
+func (client ScifClient) getRun(name string, id string) (RunRecord, error) {
+
+	records, err := client.listRuns(name)
+	if err != nil {
+		return RunRecord{}, err
+	}
+	for _, record := range records {
+		if record.ID == id || strings.HasSuffix(record.ID, "-"+id) {
+			return record, nil
+		}
+	}
+	return RunRecord{}, fmt.Errorf("no run with id %s", id)
+}
+
+// readRunRecord reads a run record from a json file
+func readRunRecord(path string) (RunRecord, error) {
+
+	var record RunRecord
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return record, err
+	}
+	err = json.Unmarshal(content, &record)
+	return record, err
+}
+
+// runRecorder writes the provenance record of an execution of an app. What
+// it needs of the app (its folders and recipe) and of our environment is
+// taken when the app is started, as the next app to be loaded can change
+// them while this one runs (see stateLock).
+type runRecorder struct {
+	app        string
+	argv       []string
+	env        []string
+	dir        string
+	folder     string
+	recipeHash string
+}
+
+// newRunRecorder returns the recorder for an app that is being started
+func (client ScifClient) newRunRecorder(spec RunSpec, argv []string, dir string) *runRecorder {
+
+	lookup := client.getAppenvLookup(spec.App)
+	return &runRecorder{app: spec.App,
+		argv:       argv,
+		env:        append(os.Environ(), spec.Env...),
+		dir:        dir,
+		folder:     filepath.Join(lookup["appdata"], runsFolder),
+		recipeHash: hashFile(lookup["apprecipe"])}
+}
+
+// write writes the record for the finished execution. Failing to write it
+// is a warning, as the app has already run.
+func (recorder *runRecorder) write(result *RunResult) {
+
+	record := newRunRecord(recorder.app, recorder.argv, recorder.env, recorder.dir, result)
+	record.RecipeHash = recorder.recipeHash
+	path := filepath.Join(recorder.folder, record.ID+".json")
+
+	content, err := json.MarshalIndent(record, "", "    ")
+	if err == nil {
+		err = os.MkdirAll(recorder.folder, 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(path, content, 0644)
+	}
+	if err != nil {
+		logger.Warningf("Cannot write run record for %s: %s", recorder.app, err)
+		return
+	}
+	logger.Debugf("Wrote run record %s", path)
+}
+
+// newRunRecord creates the record for an execution, with a new id
+func newRunRecord(app string, argv []string, env []string, dir string, result *RunResult) RunRecord {
+
+	record := RunRecord{ID: newRunID(result.Start),
+		App:      app,
+		Argv:     argv,
+		Env:      redactEnv(env),
+		Dir:      dir,
+		User:     currentUser(),
+		Start:    result.Start,
+		End:      result.End,
+		ExitCode: result.ExitCode,
+		Limit:    result.Limit,
+		Version:  version.Version}
+
+	record.Host, _ = os.Hostname()
+	if result.Signal != 0 {
+		record.Signal = result.Signal.String()
+	}
+	if result.Rusage != nil {
+		record.Rusage = newRunUsage(result.Rusage)
+	}
+	return record
+}
+
+// newRunID returns an id that sorts by the start time, and is unique
+func newRunID(start time.Time) string {
+
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		random = []byte(strconv.Itoa(os.Getpid()))
+	}
+	return fmt.Sprintf("%s-%s", start.UTC().Format("20060102T150405Z"), hex.EncodeToString(random))
+}
+
+// newRunUsage converts the rusage from wait(2)
+func newRunUsage(rusage *syscall.Rusage) *RunUsage {
+
+	seconds := func(tv syscall.Timeval) float64 {
+		return float64(tv.Sec) + float64(tv.Usec)/1e6
+	}
+
+	return &RunUsage{UserTime: seconds(rusage.Utime),
+		SystemTime:      seconds(rusage.Stime),
+		MaxRSS:          int64(rusage.Maxrss),
+		MinorFaults:     int64(rusage.Minflt),
+		MajorFaults:     int64(rusage.Majflt),
+		BlockInputs:     int64(rusage.Inblock),
+		BlockOutputs:    int64(rusage.Oublock),
+		VoluntarySwitch: int64(rusage.Nvcsw),
+		ForcedSwitch:    int64(rusage.Nivcsw)}
+}
+
+// redactEnv returns the environment (KEY=VALUE pairs) as a map, with the
+// values of likely secrets replaced. Later pairs override earlier ones, as
+// they do for a process.
+func redactEnv(env []string) map[string]string {
+
+	environment := make(map[string]string)
+	for _, pair := range env {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if secretPattern.MatchString(parts[0]) {
+			parts[1] = redactedValue
+		}
+		environment[parts[0]] = parts[1]
+	}
+	return environment
+}
+
+// currentUser returns the name of the user, or the uid if it's unknown
+func currentUser() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return strconv.Itoa(os.Getuid())
+}
+
+// hashFile returns the sha256 of a file, or an empty string if it can't be
+// read (e.g., an app without a recipe)
+func hashFile(path string) string {
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
@@ -0,0 +1,147 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRedactEnv tests that secrets are not kept in run records
+func TestRedactEnv(t *testing.T) {
+
+	env := redactEnv([]string{"PATH=/bin", "GITHUB_TOKEN=abc", "db_password=abc",
+		"AWS_SECRET_ACCESS_KEY=abc", "EMPTY=", "PATH=/usr/bin", "AUTH=abc",
+		"git_auth_header=abc", "HTTP_AUTHORIZATION=abc", "AUTHOR=me",
+		"OAUTH_CALLBACK_URL=http://localhost"})
+
+	expected := map[string]string{"PATH": "/usr/bin",
+		"GITHUB_TOKEN":          redactedValue,
+		"db_password":           redactedValue,
+		"AWS_SECRET_ACCESS_KEY": redactedValue,
+		"EMPTY":                 "",
+		"AUTH":                  redactedValue,
+		"git_auth_header":       redactedValue,
+		"HTTP_AUTHORIZATION":    redactedValue,
+		"AUTHOR":                "me",
+		"OAUTH_CALLBACK_URL":    "http://localhost"}
+
+	for key, value := range expected {
+		if env[key] != value {
+			t.Errorf("%s should be %q, got %q", key, value, env[key])
+		}
+	}
+}
+
+// TestRecordRun tests writing and reading a provenance record of a run
+func TestRecordRun(t *testing.T) {
+
+	// Create faux scif base
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+
+	err = Install("../../hello-world.scif", []string{}, true)
+	if err != nil {
+		t.Errorf("Error installing temporary SCIF")
+	}
+
+	_, err = RunApp(context.Background(), RunSpec{App: "hello-custom",
+		Command:    []string{"sh", "-c", "exit 2"},
+		Env:        []string{"MY_TOKEN=secret"},
+		Provenance: true})
+	if err != nil {
+		t.Errorf("Error running hello-custom: %v", err)
+	}
+
+	records, err := ListRuns("hello-custom")
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Expected one run record, got %d (%v)", len(records), err)
+	}
+
+	record := records[0]
+	if record.ExitCode != 2 || record.App != "hello-custom" {
+		t.Errorf("Incorrect record %v", record)
+	}
+	if !strings.HasSuffix(record.Argv[0], "sh") || record.Argv[len(record.Argv)-1] != "exit 2" {
+		t.Errorf("Incorrect argv %v", record.Argv)
+	}
+	if record.Env["MY_TOKEN"] != redactedValue {
+		t.Errorf("MY_TOKEN should be redacted, got %q", record.Env["MY_TOKEN"])
+	}
+	if !strings.HasPrefix(record.RecipeHash, "sha256:") {
+		t.Errorf("Expected a recipe hash, got %q", record.RecipeHash)
+	}
+
+	// A record can be found by the random part of the id
+	id := record.ID[strings.LastIndex(record.ID, "-")+1:]
+	if _, err := Scif.getRun("hello-custom", id); err != nil {
+		t.Errorf("Cannot get run %s: %v", id, err)
+	}
+}
+
+// TestRecordParallelTests tests the records of tests run at once, which are
+// each written with the (activated) environment of their own app (run it
+// with -race)
+func TestRecordParallelTests(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	names := []string{"one", "two", "three", "four"}
+	var recipe strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&recipe, "%%apptest %s\n    sleep 0.2\n", name)
+	}
+	path := filepath.Join(dir, "parallel.scif")
+	ioutil.WriteFile(path, []byte(recipe.String()), 0644)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+	if err := Install(path, []string{}, true); err != nil {
+		t.Errorf("Error installing temporary SCIF: %v", err)
+	}
+
+	report := RunTests(context.Background(), names, RunSpec{Provenance: true}, TestOptions{Jobs: len(names)})
+	if report.Passed != len(names) {
+		t.Errorf("Expected %d tests to pass, got %+v", len(names), report)
+	}
+	for _, name := range names {
+		records, err := ListRuns(name)
+		if err != nil || len(records) != 1 {
+			t.Errorf("Expected one run record for %s, got %d (%v)", name, len(records), err)
+			continue
+		}
+		if records[0].Env["SCIF_APPNAME"] != name || records[0].App != name {
+			t.Errorf("Incorrect record for %s: app %s, SCIF_APPNAME=%s", name, records[0].App, records[0].Env["SCIF_APPNAME"])
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+)
+
+// Sandbox runs an app with the scientific filesystem base read-only, using
+// (unprivileged) user and mount namespaces where the kernel allows. Inside
+// the sandbox only the data folder of the active app ($SCIF_APPDATA) and
+// the Writable paths can be written to under the base. If namespaces are
+// not available, or the mounts can't be done (e.g., they are blocked for
+// user namespaces), the app runs without the sandbox after a warning.
+type Sandbox struct {
+	Writable   []string // other paths to keep writable
+	PrivateTmp bool     // mount an empty (private) /tmp
+	NoNetwork  bool     // run without network, in a new network namespace
+}
+
+// sandboxConfig is the part of the execConfig that sets up the sandbox
+// in the new namespaces, before the app is executed
+type sandboxConfig struct {
+	Base       string   `json:"base"`     // read-only base (symlinks resolved)
+	Writable   []string `json:"writable"` // writable paths (symlinks resolved)
+	PrivateTmp bool     `json:"privateTmp"`
+}
+
+// newSandboxConfig returns the config to sandbox a run of an app, with
+// paths resolved as they appear in the mount table. Writable paths that
+// don't exist are skipped.
+func (client ScifClient) newSandboxConfig(name string, sandbox *Sandbox) *sandboxConfig {
+
+	base, err := filepath.EvalSymlinks(Scif.Base)
+	if err != nil {
+		base = Scif.Base
+	}
+	config := &sandboxConfig{Base: base, PrivateTmp: sandbox.PrivateTmp}
+
+	writable := append([]string{}, sandbox.Writable...)
+	if name != "" {
+		writable = append([]string{client.getAppenvLookup(name)["appdata"]}, writable...)
+	}
+
+	for _, path := range writable {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			logger.Warningf("Cannot make %s writable in the sandbox: %s", path, err)
+			continue
+		}
+		if resolved, err = filepath.Abs(resolved); err == nil {
+			config.Writable = append(config.Writable, resolved)
+		}
+	}
+	return config
+}
+
+// probeSandbox sets up a sandbox in a process of its own (scif started
+// again, in the same namespaces as the app would be), which exits once it's
+// done. The app can then be run without the sandbox if it can't be set up,
+// rather than fail to start after the namespaces were created.
+func probeSandbox(sandbox *Sandbox, config *sandboxConfig) error {
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(execConfig{Sandbox: config, Probe: true})
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	probe := exec.Command(self)
+	probe.Env = append(os.Environ(), execConfigEnv+"="+string(value))
+	probe.Stderr = &stderr
+	probe.SysProcAttr = &syscall.SysProcAttr{}
+	if err := sandboxProcess(probe, sandbox); err != nil {
+		return err
+	}
+	if err := probe.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%s", message)
+		}
+		return err
+	}
+	return nil
+}
+
+// sandboxWarning tells the user an app is running without the sandbox
+func sandboxWarning(name string, err error) {
+	if name == "" {
+		name = "shell"
+	}
+	logger.Warningf("Cannot sandbox %s (%s), running without namespaces.", name, err)
+}
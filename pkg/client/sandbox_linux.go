@@ -0,0 +1,229 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// capSysAdmin is CAP_SYS_ADMIN from linux/capability.h
+const capSysAdmin = 21
+
+// sandboxProcess sets a process (not yet started) to start in new mount
+// (and network) namespaces, and a user namespace if we aren't root.
+func sandboxProcess(process *exec.Cmd, sandbox *Sandbox) error {
+
+	attr := process.SysProcAttr
+	attr.Cloneflags = syscall.CLONE_NEWNS
+	if sandbox.NoNetwork {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+
+	// An unprivileged user is mapped to itself in a new user namespace. The
+	// shim keeps CAP_SYS_ADMIN (in the namespace only) to do the mounts, and
+	// drops it again before the app is executed
+	if os.Geteuid() != 0 {
+		attr.Cloneflags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Geteuid(), HostID: os.Geteuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getegid(), HostID: os.Getegid(), Size: 1}}
+		attr.AmbientCaps = []uintptr{capSysAdmin}
+	}
+	return nil
+}
+
+// setup is run in the new namespaces (by execConfig.exec) to make the base
+// read-only, except for the writable paths
+func (config sandboxConfig) setup() error {
+
+	// Changes to mounts must not propagate back to the host
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("mount private /: %s", err)
+	}
+
+	if config.PrivateTmp {
+		if err := mountPrivateTmp(append([]string{config.Base}, config.Writable...)); err != nil {
+			return err
+		}
+	}
+
+	// The base is a mount of its own, so it can be made read-only
+	if err := unix.Mount(config.Base, config.Base, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind mount %s: %s", config.Base, err)
+	}
+	if err := remountUnder(config.Base, true); err != nil {
+		return err
+	}
+
+	for _, path := range config.Writable {
+		if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind mount %s: %s", path, err)
+		}
+		if err := remountUnder(path, false); err != nil {
+			return err
+		}
+	}
+
+	// The app must not inherit the capability to undo the mounts
+	return unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0)
+}
+
+// mountPrivateTmp mounts an empty /tmp. Paths to keep that are under /tmp
+// (e.g., a base in /tmp/scif) are opened before, and bind mounted back to
+// the same place in the new /tmp.
+func mountPrivateTmp(keep []string) error {
+
+	fds := make(map[string]int)
+	for _, path := range keep {
+		if strings.HasPrefix(path, "/tmp/") {
+			fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+			if err != nil {
+				return fmt.Errorf("open %s: %s", path, err)
+			}
+			defer unix.Close(fd)
+			fds[path] = fd
+		}
+	}
+
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mount /tmp: %s", err)
+	}
+
+	for path, fd := range fds {
+
+		// The mount point is a folder, or an empty file
+		source := fmt.Sprintf("/proc/self/fd/%d", fd)
+		info, err := os.Stat(source)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			err = os.MkdirAll(path, 0755)
+		} else if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			err = ioutil.WriteFile(path, []byte{}, 0644)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := unix.Mount(source, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind mount %s: %s", path, err)
+		}
+	}
+	return nil
+}
+
+// mountFlags are the per-mount options that must be kept on a remount
+var mountFlags = map[string]uintptr{
+	"nosuid":      unix.MS_NOSUID,
+	"nodev":       unix.MS_NODEV,
+	"noexec":      unix.MS_NOEXEC,
+	"noatime":     unix.MS_NOATIME,
+	"nodiratime":  unix.MS_NODIRATIME,
+	"relatime":    unix.MS_RELATIME,
+	"strictatime": unix.MS_STRICTATIME,
+}
+
+// remount is a mount point, and the flags to remount it with
+type remount struct {
+	target string
+	flags  uintptr
+}
+
+// remountUnder remounts all mounts at or under a path as read-only (or
+// read-write), keeping their other options
+func remountUnder(path string, readonly bool) error {
+
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	mounts, err := remountsUnder(file, path, readonly)
+	if err != nil {
+		return err
+	}
+	for _, mount := range mounts {
+		if err := unix.Mount("", mount.target, "", mount.flags, ""); err != nil {
+			return fmt.Errorf("remount %s: %s", mount.target, err)
+		}
+	}
+	return nil
+}
+
+// remountsUnder reads a mount table (as /proc/self/mountinfo) for the mounts
+// at or under a path, and the flags to remount them
+func remountsUnder(mountinfo io.Reader, path string, readonly bool) ([]remount, error) {
+
+	var mounts []remount
+	scanner := bufio.NewScanner(mountinfo)
+	for scanner.Scan() {
+
+		// The mount point is the 5th field, and options the 6th
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		target := unescapeMountPath(fields[4])
+		if target != path && !strings.HasPrefix(target, strings.TrimSuffix(path, "/")+"/") {
+			continue
+		}
+
+		flags := uintptr(unix.MS_REMOUNT | unix.MS_BIND)
+		for _, option := range strings.Split(fields[5], ",") {
+			flags |= mountFlags[option]
+		}
+		if readonly {
+			flags |= unix.MS_RDONLY
+		}
+		mounts = append(mounts, remount{target: target, flags: flags})
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPath decodes octal escapes (e.g., \040 for space) in a path
+// from the mount table
+func unescapeMountPath(path string) string {
+
+	if !strings.Contains(path, "\\") {
+		return path
+	}
+
+	var unescaped strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if value, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				unescaped.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		unescaped.WriteByte(path[i])
+	}
+	return unescaped.String()
+}
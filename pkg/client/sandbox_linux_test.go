@@ -0,0 +1,125 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// TestUnescapeMountPath tests decoding paths from the mount table
+func TestUnescapeMountPath(t *testing.T) {
+
+	var paths = []struct {
+		path     string
+		expected string
+	}{
+		{"/scif/apps", "/scif/apps"},
+		{`/my\040base`, "/my base"},
+		{`/tab\011and\134slash`, "/tab\tand\\slash"},
+		{`/not\0escaped`, `/not\0escaped`},
+		{`/end\04`, `/end\04`},
+	}
+	for _, tt := range paths {
+		if path := unescapeMountPath(tt.path); path != tt.expected {
+			t.Errorf("%s: got %q, want %q", tt.path, path, tt.expected)
+		}
+	}
+}
+
+// TestRemountsUnder tests finding the mounts under a path, and their flags
+func TestRemountsUnder(t *testing.T) {
+
+	mountinfo := strings.Join([]string{
+		"22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw",
+		"40 22 8:2 / /scif rw,nosuid,nodev shared:2 - ext4 /dev/sda2 rw",
+		`41 40 0:5 / /scif/data/my\040app rw,noexec - tmpfs tmpfs rw`,
+		"42 22 8:3 / /scifother rw - ext4 /dev/sda3 rw",
+		"short line",
+	}, "\n")
+
+	mounts, err := remountsUnder(strings.NewReader(mountinfo), "/scif", true)
+	if err != nil {
+		t.Fatalf("Error reading mounts: %v", err)
+	}
+	if len(mounts) != 2 || mounts[0].target != "/scif" || mounts[1].target != "/scif/data/my app" {
+		t.Fatalf("Incorrect mounts under /scif, got %v", mounts)
+	}
+
+	readonly := uintptr(unix.MS_REMOUNT | unix.MS_BIND | unix.MS_RDONLY)
+	if mounts[0].flags != readonly|unix.MS_NOSUID|unix.MS_NODEV {
+		t.Errorf("Incorrect flags for /scif, got %#x", mounts[0].flags)
+	}
+	if mounts[1].flags != readonly|unix.MS_NOEXEC {
+		t.Errorf("Incorrect flags for /scif/data/my app, got %#x", mounts[1].flags)
+	}
+
+	// A writable path keeps its options, without read-only
+	mounts, _ = remountsUnder(strings.NewReader(mountinfo), "/scif/data/my app", false)
+	if len(mounts) != 1 || mounts[0].flags&unix.MS_RDONLY != 0 {
+		t.Errorf("Incorrect writable mounts, got %v", mounts)
+	}
+}
+
+// TestSandboxFallback tests that an app runs without the sandbox if it
+// can't be set up, after the namespaces are created
+func TestSandboxFallback(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The base can't be mounted if it doesn't exist
+	base := Scif.Base
+	defer func() { Scif.Base = base }()
+	Scif.Base = filepath.Join(dir, "missing")
+
+	sandbox := &Sandbox{}
+	if err := probeSandbox(sandbox, &sandboxConfig{Base: Scif.Base}); err == nil {
+		t.Errorf("Expected the probe of a missing base to fail")
+	}
+
+	process, cg, err := ScifClient{}.newProcess(RunSpec{}, "/bin/true", nil, dir, Resources{}, -1, sandbox)
+	if err != nil {
+		t.Fatalf("Error creating process: %v", err)
+	}
+	if cg != nil {
+		cg.remove()
+	}
+	if process.SysProcAttr.Cloneflags != 0 {
+		t.Errorf("Expected no namespaces without the sandbox, got %#x", process.SysProcAttr.Cloneflags)
+	}
+	for _, pair := range process.Env {
+		if strings.HasPrefix(pair, execConfigEnv+"=") {
+			var config execConfig
+			json.Unmarshal([]byte(strings.TrimPrefix(pair, execConfigEnv+"=")), &config)
+			if config.Sandbox != nil {
+				t.Errorf("Expected no sandbox config, got %+v", config.Sandbox)
+			}
+		}
+	}
+	if err := process.Run(); err != nil {
+		t.Errorf("Expected the app to run without the sandbox, got %v", err)
+	}
+}
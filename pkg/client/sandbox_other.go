@@ -0,0 +1,37 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !linux
+// +build !linux
+
+package client
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// errNoNamespaces is returned on platforms without namespaces
+var errNoNamespaces = errors.New("namespaces are only supported on Linux")
+
+// sandboxProcess is not supported on this platform
+func sandboxProcess(process *exec.Cmd, sandbox *Sandbox) error {
+	return errNoNamespaces
+}
+
+// setup is not supported on this platform
+func (config sandboxConfig) setup() error {
+	return errNoNamespaces
+}
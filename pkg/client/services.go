@@ -0,0 +1,755 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/util"
+	"golang.org/x/sys/unix"
+)
+
+// An app with a %appservice section can be run as a service, meaning a long
+// running process (e.g., a web dashboard or a database) that scif starts in
+// the background, restarts when it fails, and stops. For example:
+//
+//	%appservice dashboard
+//	    start python3 -m http.server 8080
+//	    stop-signal SIGINT
+//	    stop-timeout 10s
+//	    ready-port 8080
+//	    ready-timeout 30s
+//	    restart on-failure
+//	%apphealth dashboard
+//	    curl -sf http://localhost:8080/
+//
+// The start command (and the ready command and health check) are run by the
+// app shell, in the app environment. The service is ready when the command
+// succeeds, or the (local) port accepts connections. The health check is a
+// script that exits 0 if the service is healthy, and is run by scif status.
+//
+// Like a detached run, a service is run by a supervisor (scif started again,
+// see reexec.go), which keeps its state in the state folder of the base:
+//
+//	<state>/services/<app>.json
+//	<state>/services/<app>.log
+
+// serviceEnv holds the path of the service file for the supervisor
+const serviceEnv = "SCIF_SERVICE"
+
+// Service statuses, in addition to those of jobs (starting, running, lost)
+const (
+	ServiceStopped = "stopped" // stopped by scif stop, or never started
+	ServiceBackoff = "backoff" // waiting to restart after the service exited
+	ServiceExited  = "exited"  // exited, and not restarted (see the policy)
+)
+
+// Restart policies for a service
+const (
+	restartOnFailure = "on-failure" // restart if it exits with an error
+	restartAlways    = "always"     // restart whenever it exits
+	restartNever     = "never"      // leave it exited
+)
+
+// Service defaults, and the limits for restarts (the time to wait doubles
+// with each failure, and starts over once the service has run for a while)
+const (
+	defaultStopTimeout  = 10 * time.Second
+	defaultReadyTimeout = 30 * time.Second
+	healthTimeout       = 30 * time.Second
+	minBackoff          = time.Second
+	maxBackoff          = time.Minute
+	backoffReset        = time.Minute
+)
+
+// ServiceConfig is how an app is run as a service, from its %appservice and
+// %apphealth sections
+type ServiceConfig struct {
+	Start        string         // shell command that runs the service (in the foreground)
+	StopSignal   syscall.Signal // signal to stop the service, SIGTERM by default
+	StopTimeout  time.Duration  // time to wait for it to stop before SIGKILL
+	ReadyCommand string         // the service is ready when this shell command succeeds
+	ReadyPort    int            // or when this local TCP port accepts connections
+	ReadyTimeout time.Duration  // time to wait for the service to be ready
+	Restart      string         // restart policy (on-failure, always or never)
+	Health       string         // health check script, from %apphealth
+}
+
+// Service is the state of an app run as a service
+type Service struct {
+	App        string    `json:"app"`
+	Status     string    `json:"status"`
+	Ready      bool      `json:"ready"`
+	PID        int       `json:"pid,omitempty"`
+	Supervisor int       `json:"supervisor_pid,omitempty"`
+	Start      time.Time `json:"start"`    // of the current (or last) process
+	Restarts   int       `json:"restarts"` // since scif start
+	ExitCode   *int      `json:"last_exit_code,omitempty"`
+	Signal     string    `json:"last_signal,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Log        string    `json:"log,omitempty"`
+
+	Health *HealthCheck `json:"health,omitempty"` // filled in by scif status
+
+	path string // of the service file
+}
+
+// HealthCheck is the result of running the health check of a service (or
+// its readiness check, if it has no %apphealth)
+type HealthCheck struct {
+	Healthy  bool      `json:"healthy"`
+	Check    string    `json:"check"` // health, ready-command or ready-port
+	ExitCode int       `json:"exit_code"`
+	Output   string    `json:"output,omitempty"`
+	Checked  time.Time `json:"checked"`
+}
+
+// getService returns the service config for an app, or nil if the app has
+// no %appservice section. The sections are read from the loaded config.
+func (client ScifClient) getService(name string) (*ServiceConfig, error) {
+
+	settings := Scif.config[name]
+	if len(settings.service) == 0 {
+		return nil, nil
+	}
+
+	config := &ServiceConfig{StopSignal: syscall.SIGTERM,
+		StopTimeout:  defaultStopTimeout,
+		ReadyTimeout: defaultReadyTimeout,
+		Restart:      restartOnFailure,
+		Health:       strings.Join(settings.health, "\n")}
+
+	for _, line := range settings.service {
+		key, value := parseServiceLine(line)
+		if err := config.set(key, value); err != nil {
+			return nil, fmt.Errorf("%s %%appservice: %s", name, err)
+		}
+	}
+	if config.Start == "" {
+		return nil, fmt.Errorf("%s %%appservice: a start command is required", name)
+	}
+	return config, nil
+}
+
+// parseServiceLine splits a line of %appservice into the key and the value.
+// Unlike other key value sections, a value (a command) can contain "=".
+func parseServiceLine(line string) (string, string) {
+
+	line = strings.TrimSpace(line)
+	end := strings.IndexAny(line, " \t")
+	if end < 0 {
+		end = len(line)
+	}
+	if equals := strings.Index(line[:end], "="); equals >= 0 {
+		end = equals
+	}
+	key := strings.ToLower(line[:end])
+	value := strings.TrimSpace(strings.TrimPrefix(line[end:], "="))
+	return key, value
+}
+
+// set parses the value for a key of %appservice (e.g., ready-port 8080)
+func (config *ServiceConfig) set(key string, value string) (err error) {
+
+	switch key {
+	case "start":
+		config.Start = value
+	case "stop-signal":
+		config.StopSignal, err = parseSignal(value)
+	case "stop-timeout":
+		config.StopTimeout, err = time.ParseDuration(value)
+	case "ready-command":
+		config.ReadyCommand = value
+	case "ready-port":
+		config.ReadyPort, err = strconv.Atoi(value)
+	case "ready-timeout":
+		config.ReadyTimeout, err = time.ParseDuration(value)
+	case "restart":
+		if value != restartOnFailure && value != restartAlways && value != restartNever {
+			err = fmt.Errorf("must be %s, %s or %s", restartOnFailure, restartAlways, restartNever)
+		}
+		config.Restart = value
+	default:
+		return fmt.Errorf("%s is not a valid setting", key)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %s", key, value, err)
+	}
+	return nil
+}
+
+// parseSignal parses a signal by name (SIGINT or INT) or number
+func parseSignal(value string) (syscall.Signal, error) {
+
+	if number, err := strconv.Atoi(value); err == nil && number > 0 {
+		return syscall.Signal(number), nil
+	}
+	name := strings.ToUpper(value)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if signal := unix.SignalNum(name); signal != 0 {
+		return signal, nil
+	}
+	return 0, fmt.Errorf("unknown signal")
+}
+
+// serviceFolder is where the state of services is kept
+func serviceFolder() string {
+	return filepath.Join(stateFolder(), "services")
+}
+
+// readService reads the state of a service. A service without a file is
+// stopped, and one that should be running but has lost its supervisor is
+// lost.
+func readService(name string) (*Service, error) {
+
+	path := filepath.Join(serviceFolder(), name+".json")
+	service := &Service{App: name, Status: ServiceStopped, path: path}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return service, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, service); err != nil {
+		return nil, err
+	}
+
+	if service.supervised() && !processExists(service.Supervisor) {
+		service.Status = JobLost
+		service.Ready = false
+	}
+	return service, nil
+}
+
+// write saves the state of a service to its file
+func (service Service) write() error {
+	return writeState(service.path, service)
+}
+
+// supervised returns true if the service should have a supervisor
+func (service Service) supervised() bool {
+	switch service.Status {
+	case JobStarting, JobRunning, ServiceBackoff:
+		return true
+	}
+	return false
+}
+
+// loadService loads the filesystem, and returns the service config of an
+// installed app
+func loadService(name string) (*ServiceConfig, error) {
+
+	cli := ScifClient{}.Load(Scif.Base)
+	if ok := util.Contains(name, cli.apps()); !ok {
+		return nil, fmt.Errorf("%s is not an installed app", name)
+	}
+	config, err := cli.getService(name)
+	if err == nil && config == nil {
+		err = fmt.Errorf("%s has no %%appservice section", name)
+	}
+	return config, err
+}
+
+// HasService returns true if an installed app has a %appservice section
+func HasService(name string) bool {
+	cli := ScifClient{}.Load(Scif.Base)
+	return util.Contains(name, cli.apps()) && len(Scif.config[name].service) > 0
+}
+
+// StartService starts an app as a service, and waits for it to be ready
+// (or for the ready timeout). It's an error if the service is running.
+func StartService(name string) error {
+
+	config, err := loadService(name)
+	if err != nil {
+		return err
+	}
+
+	service, err := newService(name, true)
+	if err != nil {
+		return err
+	}
+
+	// The supervisor records its own pid (and the state of the service), so
+	// the state isn't written here once it has started
+	pid, err := startSupervisor(serviceEnv+"="+service.path, service.Log)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Starting %s (supervisor pid %d, log %s)", name, pid, service.Log)
+
+	// Wait for the supervisor to report the service is ready
+	deadline := time.Now().Add(config.ReadyTimeout + time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		if service, err = readService(name); err != nil {
+			return err
+		}
+		if service.Ready || !service.supervised() || service.Status == ServiceBackoff {
+			break
+		}
+	}
+
+	switch {
+	case service.Ready:
+		logger.Infof("%s is ready (pid %d)", name, service.PID)
+	case service.Status == JobStarting || service.Status == JobRunning:
+		logger.Warningf("%s is not ready after %s, see scif status %s", name, config.ReadyTimeout, name)
+	default:
+		return fmt.Errorf("%s did not start (%s), see %s", name, service.Status, service.Log)
+	}
+	return nil
+}
+
+// newService checks that a service isn't running, and returns a new state
+// for it (as it starts over), with a log if it's asked for (scif up runs
+// services with the output to its own)
+func newService(name string, log bool) (*Service, error) {
+
+	service, err := readService(name)
+	if err != nil {
+		return nil, err
+	}
+	if service.supervised() {
+		return nil, fmt.Errorf("%s is already %s (pid %d)", name, service.Status, service.PID)
+	}
+	if err := os.MkdirAll(serviceFolder(), 0755); err != nil {
+		return nil, err
+	}
+
+	service = &Service{App: name, Status: JobStarting, path: service.path}
+	if log {
+		service.Log = filepath.Join(serviceFolder(), name+".log")
+	}
+	return service, service.write()
+}
+
+// StopService stops a service: the supervisor sends the service its stop
+// signal, and SIGKILL if it's still running after the timeout (0 is the
+// stop-timeout of the service).
+func StopService(name string, timeout time.Duration) error {
+
+	config, err := loadService(name)
+	if err != nil {
+		return err
+	}
+	service, err := readService(name)
+	if err != nil {
+		return err
+	}
+
+	// A lost service may have left the process running
+	if service.Status == JobLost {
+		if service.PID != 0 && processExists(-service.PID) {
+			killProcess(service.PID)
+		}
+		service.Status, service.PID = ServiceStopped, 0
+		return service.write()
+	}
+	if !service.supervised() {
+		return fmt.Errorf("%s is not running (%s)", name, service.Status)
+	}
+
+	if timeout == 0 {
+		timeout = config.StopTimeout
+	}
+
+	// The supervisor kills the service after its stop-timeout, and we do if
+	// asked for a shorter timeout (or if the supervisor doesn't respond)
+	logger.Infof("Stopping %s (pid %d)", name, service.PID)
+	if err := syscall.Kill(service.Supervisor, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	if !waitForExit(service.Supervisor, timeout+2*time.Second) {
+		logger.Warningf("%s is still running after %s, killing it", name, timeout)
+		if service.PID != 0 {
+			killProcess(service.PID)
+		}
+		syscall.Kill(service.Supervisor, syscall.SIGKILL)
+		waitForExit(service.Supervisor, 5*time.Second)
+
+		service.Status, service.Ready, service.PID = ServiceStopped, false, 0
+		return service.write()
+	}
+	return nil
+}
+
+// RestartService stops a service (if it's running) and starts it again
+func RestartService(name string) error {
+
+	service, err := readService(name)
+	if err != nil {
+		return err
+	}
+	if service.supervised() || service.Status == JobLost {
+		if err := StopService(name, 0); err != nil {
+			return err
+		}
+	}
+	return StartService(name)
+}
+
+// Status prints the state of a service (or all services) as json, with the
+// result of a health check for those that are running. It returns false if
+// a service isn't running and healthy.
+func Status(name string) (bool, error) {
+
+	cli := ScifClient{}.Load(Scif.Base)
+
+	names := []string{name}
+	if name == "" {
+		names = []string{}
+		for _, app := range cli.apps() {
+			if len(Scif.config[app].service) > 0 {
+				names = append(names, app)
+			}
+		}
+	}
+
+	ok := true
+	var services []*Service
+	for _, app := range names {
+		service, err := cli.serviceStatus(app)
+		if err != nil {
+			return false, err
+		}
+		if service.Status != JobRunning || service.Error != "" || (service.Health != nil && !service.Health.Healthy) {
+			ok = false
+		}
+		services = append(services, service)
+	}
+
+	var content []byte
+	var err error
+	if name != "" {
+		content, err = json.MarshalIndent(services[0], "", "    ")
+	} else {
+		content, err = json.MarshalIndent(services, "", "    ")
+	}
+	if err != nil {
+		return false, err
+	}
+	fmt.Println(string(content))
+	return ok, nil
+}
+
+// serviceStatus returns the state of a service, checking its health if it's
+// running
+func (client ScifClient) serviceStatus(name string) (*Service, error) {
+
+	if ok := util.Contains(name, client.apps()); !ok {
+		return nil, fmt.Errorf("%s is not an installed app", name)
+	}
+	config, err := client.getService(name)
+	if err == nil && config == nil {
+		return nil, fmt.Errorf("%s has no %%appservice section", name)
+	}
+
+	service, readErr := readService(name)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	// An invalid %appservice is shown with the service, as it can't be run
+	if err != nil {
+		service.Error = err.Error()
+		return service, nil
+	}
+	if service.Status == JobRunning {
+		service.Health = checkHealth(name, config)
+	}
+	return service, nil
+}
+
+// checkHealth runs the health check of a service, or checks that it's ready
+// if it has no %apphealth
+func checkHealth(name string, config *ServiceConfig) *HealthCheck {
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+
+	check := &HealthCheck{Check: "health"}
+	switch {
+	case config.Health != "":
+		check.ExitCode, check.Output = runCheck(ctx, name, config.Health)
+	case config.ReadyCommand != "":
+		check.Check = "ready-command"
+		check.ExitCode, check.Output = runCheck(ctx, name, config.ReadyCommand)
+	case config.ReadyPort != 0:
+		check.Check = "ready-port"
+		if err := dialPort(config.ReadyPort); err != nil {
+			check.ExitCode, check.Output = 1, err.Error()
+		}
+	default:
+		return nil
+	}
+
+	check.Healthy = check.ExitCode == 0
+	check.Checked = time.Now()
+	return check
+}
+
+// runCheck runs a shell command (or script) for a service in the app
+// environment, and returns the exit status and the output. A check while
+// the service is started (or restarted) waits for it, as loading the app
+// changes the state they share (see stateLock).
+func runCheck(ctx context.Context, name string, command string) (int, string) {
+
+	var output bytes.Buffer
+	result, err := RunApp(ctx, RunSpec{App: name,
+		Command: []string{command},
+		Shell:   true,
+		Stdout:  &output,
+		Stderr:  &output})
+
+	if err != nil {
+		return 1, strings.TrimSpace(output.String() + "\n" + err.Error())
+	}
+	return result.Status(), strings.TrimSpace(output.String())
+}
+
+// dialPort checks that a local TCP port accepts connections
+func dialPort(port int) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", strconv.Itoa(port)), time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// serviceSupervisor runs a service in the supervisor, with a lock for the
+// state (updated by the readiness check as well)
+type serviceSupervisor struct {
+	sync.Mutex
+	service *Service
+	config  *ServiceConfig
+}
+
+// update changes the state of the service, and saves it
+func (supervisor *serviceSupervisor) update(change func(service *Service)) {
+
+	supervisor.Lock()
+	defer supervisor.Unlock()
+
+	change(supervisor.service)
+	if err := supervisor.service.write(); err != nil {
+		logger.Warningf("Cannot update service %s: %s", supervisor.service.App, err)
+	}
+}
+
+// superviseService runs a service (in the supervisor), restarting it with a
+// backoff as its policy says, until it's stopped with a signal. It returns
+// the exit status for the supervisor.
+func superviseService(path string) int {
+
+	name := strings.TrimSuffix(filepath.Base(path), ".json")
+	service, err := readService(name)
+	if err == nil && service.path != path {
+		err = fmt.Errorf("%s is not in the state folder", path)
+	}
+	var config *ServiceConfig
+	if err == nil {
+		config, err = loadService(name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scif: %s\n", err)
+		return 1
+	}
+
+	supervisor := &serviceSupervisor{service: service, config: config}
+	supervisor.update(func(service *Service) { service.Supervisor = os.Getpid() })
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	backoff := minBackoff
+	for {
+		result, stopped, err := supervisor.run(signals)
+
+		supervisor.update(func(service *Service) {
+			service.Ready, service.PID, service.Error = false, 0, ""
+			service.ExitCode, service.Signal = nil, ""
+			if result != nil {
+				service.ExitCode = &result.ExitCode
+				if result.Signal != 0 {
+					service.Signal = result.Signal.String()
+				}
+			}
+			if err != nil {
+				service.Error = err.Error()
+			}
+			service.Status = ServiceExited
+			if stopped {
+				service.Status, service.Supervisor = ServiceStopped, 0
+			}
+		})
+		if stopped {
+			logger.Infof("Stopped %s", name)
+			return 0
+		}
+
+		failed := err != nil || result.Status() != 0
+		if config.Restart == restartNever || (config.Restart == restartOnFailure && !failed) {
+			logger.Infof("%s exited, and is not restarted (restart %s)", name, config.Restart)
+			return 0
+		}
+
+		// A service that ran for a while starts over with a short wait
+		if result != nil && result.Duration() > backoffReset {
+			backoff = minBackoff
+		}
+		logger.Warningf("%s exited, restarting in %s", name, backoff)
+		supervisor.update(func(service *Service) { service.Status = ServiceBackoff })
+
+		select {
+		case <-time.After(backoff):
+		case <-signals:
+			supervisor.update(func(service *Service) { service.Status, service.Supervisor = ServiceStopped, 0 })
+			logger.Infof("Stopped %s", name)
+			return 0
+		}
+
+		supervisor.update(func(service *Service) { service.Restarts++ })
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// run runs the service once, until it exits or the supervisor is asked to
+// stop it (with a signal). It returns the result, and if it was stopped.
+func (supervisor *serviceSupervisor) run(signals chan os.Signal) (*RunResult, bool, error) {
+
+	config := supervisor.config
+	name := supervisor.service.App
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan int, 1)
+	spec := RunSpec{App: name,
+		Command: []string{config.Start},
+		Shell:   true,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+		Started: func(pid int, argv []string) {
+			supervisor.update(func(service *Service) {
+				service.Status, service.PID, service.Start = JobStarting, pid, time.Now()
+			})
+			started <- pid
+		}}
+
+	type exit struct {
+		result *RunResult
+		err    error
+	}
+	exited := make(chan exit, 1)
+	go func() {
+		result, err := RunApp(ctx, spec)
+		exited <- exit{result, err}
+	}()
+
+	// The service is checked for readiness once it has started
+	go func() {
+		select {
+		case <-started:
+			supervisor.waitReady(ctx)
+		case <-ctx.Done():
+		}
+	}()
+
+	select {
+	case done := <-exited:
+		return done.result, false, done.err
+
+	case <-signals:
+		supervisor.Lock()
+		pid := supervisor.service.PID
+		supervisor.Unlock()
+
+		// The service leads its own process group
+		if pid != 0 {
+			logger.Infof("Sending %s to %s (pid %d)", config.StopSignal, name, pid)
+			syscall.Kill(-pid, config.StopSignal)
+		}
+		select {
+		case done := <-exited:
+			return done.result, true, nil
+		case <-time.After(config.StopTimeout):
+			logger.Warningf("%s is still running after %s, killing it", name, config.StopTimeout)
+			cancel()
+		}
+		done := <-exited
+		return done.result, true, nil
+	}
+}
+
+// waitReady checks the service until it's ready, and marks it as running
+// (and ready). If it isn't ready after the timeout it's running, but not
+// ready.
+func (supervisor *serviceSupervisor) waitReady(ctx context.Context) {
+
+	config := supervisor.config
+	name := supervisor.service.App
+	deadline := time.Now().Add(config.ReadyTimeout)
+
+	ready := func() bool {
+		switch {
+		case config.ReadyCommand != "":
+			status, _ := runCheck(ctx, name, config.ReadyCommand)
+			return status == 0
+		case config.ReadyPort != 0:
+			return dialPort(config.ReadyPort) == nil
+		}
+		return true
+	}
+
+	for !ready() {
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			logger.Warningf("%s is not ready after %s", name, config.ReadyTimeout)
+			supervisor.update(func(service *Service) { service.Status = JobRunning })
+			return
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+
+	if ctx.Err() == nil {
+		logger.Infof("%s is ready", name)
+		supervisor.update(func(service *Service) { service.Status, service.Ready = JobRunning, true })
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestParseServiceLine tests that commands in %appservice keep their "="
+func TestParseServiceLine(t *testing.T) {
+
+	lines := map[string][2]string{
+		"start python3 -m http.server --bind=127.0.0.1": {"start", "python3 -m http.server --bind=127.0.0.1"},
+		"ready-port=8080":   {"ready-port", "8080"},
+		"  Stop-Signal INT": {"stop-signal", "INT"},
+		"restart":           {"restart", ""},
+	}
+	for line, expected := range lines {
+		key, value := parseServiceLine(line)
+		if key != expected[0] || value != expected[1] {
+			t.Errorf("%q should be %q, got %q %q", line, expected, key, value)
+		}
+	}
+
+	for value, expected := range map[string]syscall.Signal{"SIGINT": syscall.SIGINT, "hup": syscall.SIGHUP, "9": syscall.SIGKILL} {
+		if signal, err := parseSignal(value); err != nil || signal != expected {
+			t.Errorf("%s should be %s, got %s (%v)", value, expected, signal, err)
+		}
+	}
+	if _, err := parseSignal("NOPE"); err == nil {
+		t.Errorf("NOPE should not be a signal")
+	}
+}
+
+// TestService tests starting and stopping a service, which is supervised by
+// the test binary started again
+func TestService(t *testing.T) {
+
+	// Create faux scif base
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+
+	recipe := filepath.Join(dir, "service.scif")
+	content := "%appservice sleeper\n    start sleep 30\n    stop-timeout 5s\n    restart never\n" +
+		"%apphealth sleeper\n    test -n \"$SCIF_APPNAME\"\n"
+	if err := ioutil.WriteFile(recipe, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing recipe: %v", err)
+	}
+	if err := Install(recipe, []string{}, true); err != nil {
+		t.Fatalf("Error installing temporary SCIF")
+	}
+
+	cli := ScifClient{}.Load(Scif.Base)
+	config, err := cli.getService("sleeper")
+	if err != nil || config.Start != "sleep 30" || config.StopTimeout != 5*time.Second ||
+		config.StopSignal != syscall.SIGTERM || config.Restart != restartNever {
+		t.Fatalf("Incorrect service config, got %+v (%v)", config, err)
+	}
+
+	if err := StartService("sleeper"); err != nil {
+		t.Fatalf("Error starting service: %v", err)
+	}
+	defer StopService("sleeper", time.Second)
+
+	service, err := cli.serviceStatus("sleeper")
+	if err != nil || service.Status != JobRunning || !service.Ready || service.PID == 0 {
+		t.Fatalf("Incorrect service status, got %+v (%v)", service, err)
+	}
+	if service.Health == nil || !service.Health.Healthy {
+		t.Errorf("Service should be healthy, got %+v", service.Health)
+	}
+	if err := StartService("sleeper"); err == nil {
+		t.Errorf("Starting a running service should fail")
+	}
+
+	if err := StopService("sleeper", 0); err != nil {
+		t.Fatalf("Error stopping service: %v", err)
+	}
+	if service, err = readService("sleeper"); err != nil || service.Status != ServiceStopped {
+		t.Errorf("Service should be stopped, got %+v (%v)", service, err)
+	}
+}
+
+// TestServiceChecks tests checking a service while it's (re)started, which
+// both load and activate the app (run it with -race)
+func TestServiceChecks(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+
+	recipe := filepath.Join(dir, "service.scif")
+	content := "%appservice flaky\n    start true\n    ready-command test -n \"$SCIF_APPNAME\"\n"
+	if err := ioutil.WriteFile(recipe, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing recipe: %v", err)
+	}
+	if err := Install(recipe, []string{}, true); err != nil {
+		t.Fatalf("Error installing temporary SCIF")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			RunApp(context.Background(), RunSpec{App: "flaky", Command: []string{"true"}, Shell: true})
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if status, output := runCheck(context.Background(), "flaky", "test -n \"$SCIF_APPNAME\""); status != 0 {
+			t.Errorf("The check should pass, got %d: %s", status, output)
+		}
+	}
+	<-done
+}
@@ -20,6 +20,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/google/shlex"
 	"github.com/sci-f/scif-go/internal/pkg/logger"
 	"github.com/sci-f/scif-go/pkg/util"
 )
@@ -33,46 +34,54 @@ import (
 // or of a filesystem
 func (client ScifClient) Load(path string) *ScifClient {
 
-	// Initialize config and Empty environment
-	Scif.config = make(map[string]AppSettings)
-	Scif.Environment = make(map[string]string)
-
 	// If the recipe is not provided (empty string) set it to be the base.
 	if path == "" {
 		path = Scif.Base
 	}
 
-	// Check if we have a file or a directory
-	if fp, err := os.Stat(path); err == nil {
+	// Exit on error, and without a recipe or directory, development mode
+	if loaded, err := client.load(path); err != nil {
+		logger.Exitf("%s", err)
+	} else if !loaded {
+		logger.Warningf("No recipe or filesystem loaded.")
+	}
+	//client.PrintConfig()
 
-		// Case 1: It's a directory on the filesystem (scif base)
-		if fp.IsDir() {
+	logger.Debugf("Found apps %s", client.apps())
 
-			// Load the filesystem and exit on error
-			if err := client.loadFilesystem(path); err != nil {
-				logger.Exitf("%s", err)
-			}
+	return &client
+}
 
-			// Case 2: It's a path to a recipe
-		} else {
+// load resets the config, and loads a recipe or a filesystem (the base) at
+// a path, without logging. It's false if there is neither at the path.
+func (client ScifClient) load(path string) (bool, error) {
 
-			// Load the recipe and exit on error
-			if err := client.loadRecipe(path); err != nil {
-				logger.Exitf("%s", err)
-			}
-		}
+	// Initialize config and Empty environment
+	Scif.config = make(map[string]AppSettings)
+	Scif.workflows = make(map[string][]string)
+	Scif.Environment = make(map[string]string)
 
-		// Otherwise, not a recipe or directory, development mode
-	} else {
-		logger.Warningf("No recipe or filesystem loaded.")
+	// Check if we have a file or a directory
+	fp, err := os.Stat(path)
+	if err != nil {
+		client.finishLoad()
+		return false, nil
 	}
 
-	client.finishLoad()
-	//client.PrintConfig()
+	// Case 1: It's a directory on the filesystem (scif base)
+	if fp.IsDir() {
+		err = client.loadFilesystem(path)
 
-	logger.Debugf("Found apps %s", client.apps())
+		// Case 2: It's a path to a recipe
+	} else {
+		err = client.loadRecipe(path)
+	}
+	if err != nil {
+		return false, err
+	}
 
-	return &client
+	client.finishLoad()
+	return true, nil
 }
 
 // loadRecipe is called on Load() if the path provided is a recipe file. It
@@ -100,8 +109,8 @@ func (client ScifClient) loadRecipe(path string) error {
 		// Pop the first off the array
 		line, lines = lines[0], lines[1:]
 
-		// Skip comments
-		if strings.HasPrefix(line, "#") {
+		// Skip comments (a shebang is kept for a script section)
+		if strings.HasPrefix(line, "#") && !isShebang(line) {
 			continue
 
 			// A New Section
@@ -110,10 +119,11 @@ func (client ScifClient) loadRecipe(path string) error {
 			// Remove comments
 			line = strings.Split(line, "#")[0]
 
-			// Is there a section name?
+			// Is there a section name? It can be followed by options
+			var options map[string]string
 			parts = strings.Split(line, " ")
 			if len(parts) > 1 {
-				name = strings.Join(parts[1:], " ")
+				name, options = parseSectionHeader(strings.Join(parts[1:], " "))
 				logger.Debugf("Found new section name %s", name)
 			}
 
@@ -123,7 +133,14 @@ func (client ScifClient) loadRecipe(path string) error {
 			logger.Debugf("Found new section type %s", section)
 
 			// Initialize sections for the new app (name) to Scif.config
-			addSettings(name)
+			// A workflow is not an app, and is kept separately, and a named
+			// test case is added to its app (see testcases.go)
+			if section == "apptest" && isTestCase(name) {
+				addTestCase(name, options)
+			} else if section != "workflow" {
+				addSettings(name)
+				setSectionOptions(section, name, options)
+			}
 
 			// If we already have a section, we are adding to it
 		} else if section != "" {
@@ -144,6 +161,83 @@ func addSettings(name string) {
 	getSettings(name)
 }
 
+// parseSectionHeader splits the rest of a section header into the name, and
+// options given as --key value (or --key=value), for example:
+//
+//	%apprun myapp --interpreter python3
+func parseSectionHeader(header string) (string, map[string]string) {
+
+	words, err := shlex.Split(header)
+	if err != nil {
+		logger.Warningf("Cannot parse section header %s: %s", header, err)
+		return strings.TrimSpace(header), nil
+	}
+
+	var name []string
+	options := make(map[string]string)
+	for len(words) > 0 {
+		word := words[0]
+		words = words[1:]
+
+		if !strings.HasPrefix(word, "--") {
+			name = append(name, word)
+			continue
+		}
+
+		key := strings.TrimPrefix(word, "--")
+		value := ""
+		if strings.Contains(key, "=") {
+			parts := strings.SplitN(key, "=", 2)
+			key, value = parts[0], parts[1]
+		} else if len(words) > 0 {
+			value, words = words[0], words[1:]
+		}
+		options[key] = value
+	}
+	return strings.Join(name, " "), options
+}
+
+// isShebang returns true if a line is a shebang (#!), even if indented
+func isShebang(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "#!")
+}
+
+// shebang returns the interpreter from the shebang of a script (the lines of
+// a section), or an empty string if it doesn't have one
+func shebang(lines []string) string {
+	if len(lines) > 0 && isShebang(lines[0]) {
+		return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[0]), "#!"))
+	}
+	return ""
+}
+
+// script returns the lines of a script section (apprun or apptest)
+func (settings AppSettings) script(section string) []string {
+	if section == "apptest" {
+		return settings.test
+	}
+	return settings.runscript
+}
+
+// setSectionOptions adds options from a section header to the app settings.
+// Only the interpreter (for %apprun and %apptest) is known.
+func setSectionOptions(section string, name string, options map[string]string) {
+
+	for key, value := range options {
+		if key != "interpreter" || (section != "apprun" && section != "apptest") {
+			logger.Warningf("--%s is not a valid option for %%%s, skipping", key, section)
+			continue
+		}
+
+		settings := getSettings(name)
+		if settings.interpreter == nil {
+			settings.interpreter = make(map[string]string)
+		}
+		settings.interpreter[section] = value
+		Scif.config[name] = settings
+	}
+}
+
 // getSettings will return appSettings based on an app name, and create if
 // doesn't exist yet.
 func getSettings(name string) AppSettings {
@@ -162,9 +256,6 @@ func getSettings(name string) AppSettings {
 // ReadSection into Scif.config, stop when we hit the next section
 func readSection(lines []string, section string, name string) []string {
 
-	// If the config doesn't contain apps lookup, add it
-	settings := getSettings(name)
-
 	// Current members of the section will be added here
 	var members []string
 	var nextLine string
@@ -187,6 +278,12 @@ func readSection(lines []string, section string, name string) []string {
 		// Otherwise, add the nextLine to members (now remove)
 		lines = lines[1:]
 
+		// A shebang is kept as the first line of a script section
+		if len(members) == 0 && isShebang(nextLine) && (section == "apprun" || section == "apptest") {
+			members = append(members, strings.TrimSpace(nextLine))
+			continue
+		}
+
 		// If it's not a comment, and isn't an empty line
 		if !strings.HasPrefix(nextLine, "#") {
 			if nextLine != "" {
@@ -195,6 +292,23 @@ func readSection(lines []string, section string, name string) []string {
 		}
 	}
 
+	// A workflow section is added to the workflows, not an app config
+	if section == "workflow" {
+		if name != "" {
+			Scif.workflows[name] = append(Scif.workflows[name], members...)
+		}
+		return lines
+	}
+
+	// A named test case has its own script
+	if section == "apptest" && isTestCase(name) {
+		setTestCaseScript(name, members)
+		return lines
+	}
+
+	// If the config doesn't contain apps lookup, add it
+	settings := getSettings(name)
+
 	// Add the list to the config
 	if len(members) > 0 {
 		if section != "" && name != "" {
@@ -213,8 +327,22 @@ func readSection(lines []string, section string, name string) []string {
 				settings.test = members
 			case "appfiles":
 				settings.files = members
+			case "apptestfiles":
+				settings.testfiles = members
 			case "applabels":
 				settings.labels = members
+			case "appresources":
+				settings.resources = members
+			case "appentrypoint":
+				settings.entrypoint = members
+			case "appworkdir":
+				settings.workdir = members
+			case "appservice":
+				settings.service = members
+			case "apphealth":
+				settings.health = members
+			case "appargs":
+				settings.args = members
 			default:
 				logger.Warningf("%s is not a valid section, skipping", section)
 			}
@@ -266,6 +394,18 @@ func (client ScifClient) loadFilesystem(path string) error {
 	logger.Debugf("Found %d apps", len(client.apps()))
 	logger.Debugf("%v", client.apps())
 
+	// Installed workflows are recipes with only %workflow sections
+	workflows, err := filepath.Glob(filepath.Join(path, "workflows", "*.scif"))
+	if err != nil {
+		return err
+	}
+	for _, workflowFile := range workflows {
+		logger.Debugf("Found workflow %v", workflowFile)
+		if err := client.loadRecipe(workflowFile); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -289,18 +429,25 @@ func (client ScifClient) finishLoad() {
 			settings = Scif.config[app]
 			appenv = Scif.config[app].environ
 
-			// If test is defined, add source to first line
-			if len(Scif.config[app].test) > 0 {
+			// If test is defined, add source to first line (for the shell)
+			if len(Scif.config[app].test) > 0 && client.runsInShell(app, "apptest") {
 				apptest = Scif.config[app].test
 				settings.test = append(appenv, apptest...)
 			}
 
 			// If runscript is defined, add source to first line
-			if len(Scif.config[app].runscript) > 0 {
+			if len(Scif.config[app].runscript) > 0 && client.runsInShell(app, "apprun") {
 				apprun = Scif.config[app].runscript
 				settings.runscript = append(appenv, apprun...)
 			}
 
+			// And the same for test cases
+			for i, test := range settings.cases {
+				if len(test.script) > 0 && test.runsInShell() {
+					settings.cases[i].script = append(append([]string{}, appenv...), test.script...)
+				}
+			}
+
 			Scif.config[app] = settings
 		}
 	}
@@ -16,10 +16,10 @@
 package client
 
 import (
+	"context"
+	"fmt"
 	"os"
-	"os/exec"
 
-	"github.com/sci-f/scif-go/internal/pkg/logger"
 	"github.com/sci-f/scif-go/pkg/util"
 )
 
@@ -27,56 +27,62 @@ import (
 // the base. Otherwise, activate and shell to an apps base folder
 func Shell(args []string) (err error) {
 
-	// Running an app means we load from the filesystem first
-	cli := ScifClient{}.Load(Scif.Base)
+	ctx, cancel := InterruptContext()
+	defer cancel()
 
+	spec := RunSpec{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
 	if len(args) > 0 {
+		spec.App = args[0]
+	}
+
+	_, err = ShellApp(ctx, spec)
+	return err
+}
+
+// ShellApp starts a shell with the stdio and options of the spec, as RunApp
+// does for the entrypoint. If the spec has an app, it is active in the shell.
+func ShellApp(ctx context.Context, spec RunSpec) (*RunResult, error) {
+
+	// Running an app means we load from the filesystem first
+	unlock := lockState()
+	defer unlock()
+	cli := ScifClient{}.Load(Scif.Base)
 
-		name := args[0]
+	if spec.App != "" {
 
 		// Ensure that the app exists on the filesystem
-		if ok := util.Contains(name, cli.apps()); !ok {
-			logger.Warningf("%s is not an installed application.", name)
-			return err
+		if ok := util.Contains(spec.App, cli.apps()); !ok {
+			return nil, fmt.Errorf("%s is not an installed application", spec.App)
+		}
+
+		// The shell can restore what the app changes (see shell_rc.go)
+		if shellKind(Scif.ShellCmd) != "" {
+			spec.Env = append(spec.Env, cli.hostValues(spec.App, nil)...)
 		}
 
 		// Activate it's environment
-		cli.activate(name)
+		cli.activate(spec.App)
 
 		// Otherwise, reset
 	} else {
 		cli.deactivate()
 	}
 
-	return cli.shell()
+	return cli.shell(ctx, spec, unlock)
 }
 
-// shell is the helper function to Shell, finishing up and executing the command
-// to start the shell.
-func (client ScifClient) shell() (err error) {
+// shell is the helper function to ShellApp, finishing up and executing the
+// command to start the shell, with an rc for the shell (see shell_rc.go).
+func (client ScifClient) shell(ctx context.Context, spec RunSpec, unlock func()) (*RunResult, error) {
 
-	// If EntryFolder still not set, just enter to base
-	if Scif.EntryFolder == "" {
-		Scif.EntryFolder = Scif.Base
-	}
-
-	// Change directory to the EntryFolder
-	if err := os.Chdir(Scif.EntryFolder); err != nil {
-		logger.Exitf("%s", err)
-	}
+	Scif.EntryPoint = []string{Scif.ShellCmd}
 
-	// Find the executable (the first in the Scif.EntryPoint)
-	executable, err := exec.LookPath(Scif.ShellCmd)
+	folder, err := client.shellRC(&spec)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// Start the Shell
-	process := exec.Command(executable, []string{}...)
-	process.Stdin = os.Stdin
-	process.Stdout = os.Stdout
-	process.Stderr = os.Stderr
-	err = process.Run()
-	return err
-
+	if folder != "" {
+		defer os.RemoveAll(folder)
+	}
+	return client.execute(ctx, spec, unlock)
 }
@@ -0,0 +1,301 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/util"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Images without a shell (e.g., scratch or distroless) can't run scripts with
+// /bin/bash or sh. Scif has a builtin POSIX shell for these, used when
+// SCIF_SHELL=builtin, or when the shell (or sh, for install) isn't found.
+// Like the limits in reexec.go, scif starts itself to run the builtin shell,
+// so it's a process like any other shell.
+
+// builtinShell is the value of SCIF_SHELL that selects the builtin shell
+const builtinShell = "builtin"
+
+// builtinShellEnv is set for scif to run as the builtin shell
+const builtinShellEnv = "SCIF_BUILTIN_SHELL"
+
+// builtinShellVars are set by the builtin shell itself, and are not part of
+// an environment it evaluates
+var builtinShellVars = []string{"HOME", "UID", "PWD", "OLDPWD", "IFS", "OPTIND"}
+
+// useBuiltinShell returns true if a command (and the error from looking it
+// up) should be run by the builtin shell: if it asks for it, or it's a shell
+// that isn't found
+func useBuiltinShell(command string, err error) bool {
+
+	if command == builtinShell {
+		return true
+	}
+	if err == nil {
+		return false
+	}
+
+	name := filepath.Base(command)
+	if command == Scif.ShellCmd || name == "sh" || name == "bash" {
+		logger.Debugf("%s is not found, using the builtin shell", command)
+		return true
+	}
+	return false
+}
+
+// builtinShellSelected returns true if the shell for apps is the builtin
+func (client ScifClient) builtinShellSelected() bool {
+	_, err := exec.LookPath(Scif.ShellCmd)
+	return useBuiltinShell(Scif.ShellCmd, err)
+}
+
+// shellCommand returns a command for a shell (e.g., sh -c for install), which
+// is the builtin shell if it's selected, or the shell isn't found
+func shellCommand(shell string, args ...string) (*exec.Cmd, error) {
+
+	if Scif.ShellCmd == builtinShell {
+		shell = builtinShell
+	}
+
+	path, err := exec.LookPath(shell)
+	if useBuiltinShell(shell, err) {
+		return builtinShellCommand(args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(path, args...), nil
+}
+
+// builtinShellCommand returns a command that runs the builtin shell
+func builtinShellCommand(args ...string) (*exec.Cmd, error) {
+
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	process := exec.Command(self, args...)
+	process.Env = append(os.Environ(), builtinShellEnv+"=1")
+	return process, nil
+}
+
+// shebangInterpreter returns the interpreter for a shebang, which is the
+// builtin shell if the shebang is for sh or bash and it isn't found
+func shebangInterpreter(shebang string) []string {
+
+	fields := strings.Fields(shebang)
+	if len(fields) == 0 {
+		return nil
+	}
+	program := fields[0]
+	if filepath.Base(program) == "env" && len(fields) > 1 {
+		program = fields[1]
+	}
+
+	name := filepath.Base(program)
+	if name != "sh" && name != "bash" {
+		return nil
+	}
+	if _, err := exec.LookPath(program); err != nil {
+		logger.Debugf("%s is not found, using the builtin shell", program)
+		return []string{builtinShell}
+	}
+	return nil
+}
+
+// runBuiltinShell runs the builtin shell with the arguments of sh: a script
+// and its arguments, -c and a command string (then $0 and arguments), or
+// commands from stdin. It returns the exit status.
+func runBuiltinShell(args []string) int {
+
+	// Shells started from this one are found as usual
+	os.Unsetenv(builtinShellEnv)
+
+	var name string
+	var reader io.Reader
+	var params []string
+
+	switch {
+	case len(args) > 0 && args[0] == "-c":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "scif: -c requires an argument")
+			return 2
+		}
+		name, reader = "sh", strings.NewReader(args[1])
+		if len(args) > 3 {
+			params = args[3:]
+		}
+
+	case len(args) > 0:
+		file, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "scif: %s\n", err)
+			return 127
+		}
+		defer file.Close()
+		name, reader, params = args[0], file, args[1:]
+
+	default:
+		name, reader = "sh", os.Stdin
+	}
+
+	runner, err := interp.New(interp.StdIO(os.Stdin, os.Stdout, os.Stderr),
+		interp.Params(append([]string{"--"}, params...)...))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scif: %s\n", err)
+		return 2
+	}
+
+	// A terminal is an interactive shell, with a prompt
+	if reader == os.Stdin && util.IsTerminal(os.Stdin) {
+		return runInteractive(runner)
+	}
+
+	program, err := syntax.NewParser().Parse(reader, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scif: %s\n", err)
+		return 2
+	}
+	return builtinExitStatus(runner.Run(context.Background(), program))
+}
+
+// runInteractive runs commands from the terminal until the shell exits. As
+// for a POSIX shell, the rc in ENV is run first, and PS1 is the prompt.
+func runInteractive(runner *interp.Runner) int {
+
+	if rc := os.Getenv("ENV"); rc != "" {
+		if file, err := os.Open(rc); err == nil {
+			program, err := syntax.NewParser().Parse(file, rc)
+			file.Close()
+			if err == nil {
+				err = runner.Run(context.Background(), program)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "scif: %s: %s\n", rc, err)
+			}
+		}
+	}
+
+	parser := syntax.NewParser()
+	status := 0
+
+	fmt.Fprint(os.Stderr, builtinPrompt(runner, "PS1", "$ "))
+	err := parser.Interactive(os.Stdin, func(stmts []*syntax.Stmt) bool {
+		if parser.Incomplete() {
+			fmt.Fprint(os.Stderr, builtinPrompt(runner, "PS2", "> "))
+			return true
+		}
+		for _, stmt := range stmts {
+			status = builtinExitStatus(runner.Run(context.Background(), stmt))
+			if runner.Exited() {
+				return false
+			}
+		}
+		fmt.Fprint(os.Stderr, builtinPrompt(runner, "PS1", "$ "))
+		return true
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scif: %s\n", err)
+		return 2
+	}
+	return status
+}
+
+// builtinPrompt returns a prompt (PS1 or PS2) of the shell, which can use
+// variables, or the fallback if it isn't set (or can't be expanded)
+func builtinPrompt(runner *interp.Runner, name string, fallback string) string {
+
+	value := runner.Vars[name].String()
+	if value == "" {
+		value = os.Getenv(name)
+	}
+	if value == "" {
+		return fallback
+	}
+
+	word, err := syntax.NewParser().Document(strings.NewReader(value))
+	if err != nil {
+		return fallback
+	}
+	prompt, err := expand.Document(&expand.Config{Env: expand.FuncEnviron(func(name string) string {
+		if variable, ok := runner.Vars[name]; ok {
+			return variable.String()
+		}
+		return os.Getenv(name)
+	})}, word)
+	if err != nil {
+		return fallback
+	}
+	return prompt
+}
+
+// builtinExitStatus returns the exit status for an error from the runner
+func builtinExitStatus(err error) int {
+
+	if err == nil {
+		return 0
+	}
+	if status, ok := interp.IsExitStatus(err); ok {
+		return int(status)
+	}
+	fmt.Fprintf(os.Stderr, "scif: %s\n", err)
+	return 1
+}
+
+// builtinEnvironment evaluates an environment script (environment.sh) with
+// the builtin shell, in an environment (see appEnviron), and returns only the
+// variables that the script sets
+func builtinEnvironment(path string, environ []string) (map[string]string, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	program, err := syntax.NewParser().Parse(file, path)
+	if err != nil {
+		return nil, err
+	}
+
+	runner, err := interp.New(interp.Env(expand.ListEnviron(environ...)),
+		interp.StdIO(nil, os.Stderr, os.Stderr))
+	if err != nil {
+		return nil, err
+	}
+	if err := runner.Run(context.Background(), program); err != nil {
+		return nil, err
+	}
+
+	environment := make(map[string]string)
+	for key, variable := range runner.Vars {
+		if variable.Kind == expand.String && !util.Contains(key, builtinShellVars) {
+			environment[key] = variable.Str
+		}
+	}
+	return environment, nil
+}
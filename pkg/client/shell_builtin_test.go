@@ -0,0 +1,105 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sci-f/scif-go/pkg/util"
+)
+
+// TestBuiltinShell tests running apps with the builtin shell, which is the
+// test binary started again
+func TestBuiltinShell(t *testing.T) {
+
+	// Create faux scif base
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+
+	shell := Scif.ShellCmd
+	Scif.ShellCmd = builtinShell
+	defer func() { Scif.ShellCmd = shell }()
+
+	err = Install("../../hello-world.scif", []string{}, true)
+	if err != nil {
+		t.Errorf("Error installing temporary SCIF")
+	}
+
+	var stdout bytes.Buffer
+	result, err := RunApp(context.Background(), RunSpec{App: "hello-custom",
+		Args:   []string{"pepperoni"},
+		Stdout: &stdout})
+	if err != nil || result.ExitCode != 0 {
+		t.Fatalf("Error running hello-custom: %v (%v)", err, result)
+	}
+	if strings.TrimSpace(stdout.String()) != "Hello pepperoni" {
+		t.Errorf("Incorrect output, got %q", stdout.String())
+	}
+
+	// A shell command has pipes and the exit status of the shell
+	stdout.Reset()
+	result, err = RunApp(context.Background(), RunSpec{App: "hello-world-env",
+		Command: []string{"echo $OMG | tr A-Z a-z; exit 3"},
+		Shell:   true,
+		Stdout:  &stdout})
+	if err != nil || strings.TrimSpace(stdout.String()) != "tacos" || result.ExitCode != 3 {
+		t.Errorf("Incorrect shell output, got %q (%v)", stdout.String(), err)
+	}
+}
+
+// TestBuiltinEnvironment tests evaluating an environment.sh
+func TestBuiltinEnvironment(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "environment.sh")
+	lines := []string{`export NAME="two words"`, "OTHER=${NAME}-x", "TOOL=$SCIF_APPBIN/tool", "# a comment"}
+	if err := util.WriteFile(lines, path); err != nil {
+		t.Fatalf("Error writing environment: %v", err)
+	}
+
+	// The script sees the app environment, but only its variables are returned
+	environment, err := builtinEnvironment(path, []string{"SCIF_APPBIN=/scif/apps/a/bin", "HOME=/home/a"})
+	if err != nil {
+		t.Errorf("Error evaluating environment: %v", err)
+	}
+	if environment["NAME"] != "two words" || environment["OTHER"] != "two words-x" || environment["TOOL"] != "/scif/apps/a/bin/tool" {
+		t.Errorf("Incorrect environment %v", environment)
+	}
+	if len(environment) != 3 {
+		t.Errorf("Expected only the variables of the script, got %v", environment)
+	}
+	if _, ok := environment["PWD"]; ok {
+		t.Errorf("Variables of the shell should not be in the environment")
+	}
+}
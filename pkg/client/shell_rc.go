@@ -0,0 +1,347 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/util"
+)
+
+// An interactive shell (scif shell) gets a generated rc file, which sources
+// the rc of the user, sets a prompt with the active app(s), and defines
+// functions to activate and deactivate apps in the shell:
+//
+//	scif-activate <app>   activate an app (on top of those active)
+//	scif-deactivate       deactivate all apps
+//
+// The functions run scif again (with SCIF_SHELL_EXPORTS, see reexec.go) to
+// print the changes to the environment, which the shell evaluates. The rc
+// is read by bash (--rcfile), zsh (ZDOTDIR), and sh and the builtin shell
+// (ENV), and is removed when the shell exits.
+
+// shellExportsEnv asks scif to print the exports to activate (or deactivate)
+// an app in a shell
+const shellExportsEnv = "SCIF_SHELL_EXPORTS"
+
+// shellAppsEnv holds the apps active in the shell, separated by spaces
+const shellAppsEnv = "SCIF_SHELL_APPS"
+
+// shellHostEnv is the prefix for the paths (PATH, etc.) of the host, before
+// any app was activated, and the values of the host that an active app
+// changed (e.g., LANG), which are restored by scif-deactivate
+const shellHostEnv = "SCIF_SHELL_HOST_"
+
+// scifPrompt is the prompt set by exportEnv
+const scifPrompt = "scif> "
+
+// Kinds of shells that scif writes an rc for
+const (
+	shellBash  = "bash"
+	shellZsh   = "zsh"
+	shellPosix = "sh"
+)
+
+// shellVariable matches names that can be exported by a shell
+var shellVariable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// shellKind returns the kind of a shell for its rc, or an empty string for
+// shells without one (e.g., fish)
+func shellKind(shell string) string {
+
+	if _, err := exec.LookPath(shell); useBuiltinShell(shell, err) {
+		return builtinShell
+	}
+	switch filepath.Base(shell) {
+	case "bash":
+		return shellBash
+	case "zsh":
+		return shellZsh
+	case "sh", "dash", "ash", "ksh", "mksh":
+		return shellPosix
+	}
+	return ""
+}
+
+// shellRC writes the rc for a shell to a temporary folder, and updates the
+// entrypoint and the spec to use it. The folder should be removed when the
+// shell exits, and is empty if the shell has no rc.
+func (client ScifClient) shellRC(spec *RunSpec) (string, error) {
+
+	kind := shellKind(Scif.ShellCmd)
+	if kind == "" {
+		logger.Debugf("No rc for %s, the prompt is %q", Scif.ShellCmd, scifPrompt)
+		return "", nil
+	}
+
+	folder, err := ioutil.TempDir("", "scif-shell-")
+	if err != nil {
+		return "", err
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		os.RemoveAll(folder)
+		return "", err
+	}
+
+	// The shell starts with the app of the spec active, and knows the paths
+	// to restore when it's deactivated
+	spec.Env = append(spec.Env, shellAppsEnv+"="+spec.App)
+	for _, key := range Scif.appendPaths {
+		spec.Env = append(spec.Env, shellHostEnv+key+"="+Scif.hostPaths[key])
+	}
+
+	rc := filepath.Join(folder, "scifrc")
+	switch kind {
+	case shellBash:
+		Scif.EntryPoint = append(Scif.EntryPoint, "--rcfile", rc)
+		err = writeShellRC(rc, kind, self, `if [ -f "$HOME/.bashrc" ]; then . "$HOME/.bashrc"; fi`)
+
+	// zsh reads its rc files from ZDOTDIR, which is restored for the user's
+	case shellZsh:
+		rc = filepath.Join(folder, ".zshrc")
+		spec.Env = append(spec.Env, "ZDOTDIR="+folder, "SCIF_USER_ZDOTDIR="+os.Getenv("ZDOTDIR"))
+		restore := `ZDOTDIR="${SCIF_USER_ZDOTDIR:-$HOME}"; unset SCIF_USER_ZDOTDIR`
+		err = ioutil.WriteFile(filepath.Join(folder, ".zshenv"),
+			[]byte(`if [ -f "${SCIF_USER_ZDOTDIR:-$HOME}/.zshenv" ]; then . "${SCIF_USER_ZDOTDIR:-$HOME}/.zshenv"; fi`+"\n"), 0644)
+		if err == nil {
+			err = writeShellRC(rc, kind, self, restore+"\n"+
+				`if [ -f "$ZDOTDIR/.zshrc" ]; then . "$ZDOTDIR/.zshrc"; fi`+"\n"+"setopt PROMPT_SUBST")
+		}
+
+	// A POSIX shell (and the builtin) reads the rc from ENV, as it does the
+	// user's
+	default:
+		spec.Env = append(spec.Env, "ENV="+rc, "SCIF_USER_ENV="+os.Getenv("ENV"))
+		err = writeShellRC(rc, kind, self, `if [ -n "$SCIF_USER_ENV" ] && [ -f "$SCIF_USER_ENV" ]; then . "$SCIF_USER_ENV"; fi`)
+	}
+	if err != nil {
+		os.RemoveAll(folder)
+		return "", err
+	}
+
+	// With a private /tmp in the sandbox, the rc must be kept
+	if spec.Sandbox != nil && spec.Sandbox.PrivateTmp {
+		sandbox := *spec.Sandbox
+		sandbox.Writable = append(append([]string{}, sandbox.Writable...), folder)
+		spec.Sandbox = &sandbox
+	}
+
+	logger.Debugf("Shell rc for %s is %s", kind, rc)
+	return folder, nil
+}
+
+// writeShellRC writes the rc for a kind of shell, which first sources the
+// user's rc
+func writeShellRC(path string, kind string, self string, userRC string) error {
+
+	exports := func(action string) string {
+		return fmt.Sprintf("%s=%s SCIF_MESSAGELEVEL=-2 %s", shellExportsEnv, action, util.ShellQuote(self))
+	}
+
+	lines := []string{"# Generated by scif for this shell, and removed when it exits",
+		userRC,
+		"",
+		"scif_activate() {",
+		`    if [ $# -ne 1 ]; then echo "usage: scif-activate <app>" >&2; return 2; fi`,
+		`    __scif_exports=$(` + exports("activate") + ` "$1") || return`,
+		`    eval "$__scif_exports"; unset __scif_exports`,
+		"}",
+		"scif_deactivate() {",
+		`    __scif_exports=$(` + exports("deactivate") + `) || return`,
+		`    eval "$__scif_exports"; unset __scif_exports`,
+		"}",
+	}
+
+	// A POSIX shell doesn't allow "-" in function names, but does in aliases
+	if kind == shellPosix {
+		lines = append(lines, "alias scif-activate=scif_activate scif-deactivate=scif_deactivate")
+	} else {
+		lines = append(lines, `scif-activate() { scif_activate "$@"; }`, `scif-deactivate() { scif_deactivate "$@"; }`)
+	}
+
+	// The active apps are shown before the user's prompt, or in ours
+	lines = append(lines, "",
+		`if [ -z "$PS1" ] || [ "$PS1" = "`+scifPrompt+`" ]; then`,
+		`    PS1='scif${`+shellAppsEnv+`:+(${`+shellAppsEnv+`})}> '`,
+		"else",
+		`    PS1='(scif${`+shellAppsEnv+`:+ ${`+shellAppsEnv+`}}) '"$PS1"`,
+		"fi", "")
+
+	return ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+}
+
+// printShellExports prints the changes to the environment of a shell to
+// activate an app (the args) or deactivate all apps, as shell commands. It
+// returns the exit status for scif.
+func printShellExports(action string, args []string) int {
+
+	cli := ScifClient{}.Load(Scif.Base)
+	before := environMap(os.Environ())
+	active := strings.Fields(os.Getenv(shellAppsEnv))
+
+	switch action {
+	case "activate":
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "usage: scif-activate <app>")
+			return 2
+		}
+		if !util.Contains(args[0], cli.apps()) {
+			fmt.Fprintf(os.Stderr, "scif: %s is not an installed app\n", args[0])
+			return 1
+		}
+		for _, pair := range cli.hostValues(args[0], active) {
+			parts := strings.SplitN(pair, "=", 2)
+			os.Setenv(parts[0], parts[1])
+		}
+		cli.activate(args[0])
+		if !util.Contains(args[0], active) {
+			active = append(active, args[0])
+		}
+
+	case "deactivate":
+
+		// The environments of the active apps are unset (or the values of
+		// the host restored), and the paths of the host restored
+		keys := cli.appEnvKeys(active...)
+		cli.deactivate()
+		for key := range keys {
+			if util.Contains(key, Scif.appendPaths[:]) {
+				continue
+			}
+			if value, ok := os.LookupEnv(shellHostEnv + key); ok {
+				os.Setenv(key, value)
+				os.Unsetenv(shellHostEnv + key)
+			} else {
+				os.Unsetenv(key)
+			}
+		}
+		for _, key := range Scif.appendPaths {
+			if value := os.Getenv(shellHostEnv + key); value != "" {
+				os.Setenv(key, value)
+			} else {
+				os.Unsetenv(key)
+			}
+		}
+		active = nil
+
+	default:
+		fmt.Fprintf(os.Stderr, "scif: %s is not a shell action\n", action)
+		return 2
+	}
+
+	after := environMap(os.Environ())
+	after[shellAppsEnv] = strings.Join(active, " ")
+
+	fmt.Print(shellExports(before, after))
+	return 0
+}
+
+// appEnvKeys returns the variables set by the environments (environment.sh)
+// of the apps
+func (client ScifClient) appEnvKeys(names ...string) map[string]bool {
+
+	environment := Scif.Environment
+	defer func() { Scif.Environment = environment }()
+
+	keys := make(map[string]bool)
+	for _, name := range names {
+		Scif.Environment = make(map[string]string)
+		client.loadAppEnv(name)
+		for key := range Scif.Environment {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// hostValues returns the values of the host (as shellHostEnv variables) for
+// the variables that the environment of an app changes, for scif-deactivate
+// to restore. The paths are kept by shellRC, and a variable that an active
+// app sets (or that is kept already) is skipped, as its value isn't the
+// host's.
+func (client ScifClient) hostValues(name string, active []string) []string {
+
+	activeKeys := client.appEnvKeys(active...)
+	var env []string
+	for key := range client.appEnvKeys(name) {
+		if activeKeys[key] || util.Contains(key, Scif.appendPaths[:]) {
+			continue
+		}
+		if _, kept := os.LookupEnv(shellHostEnv + key); kept {
+			continue
+		}
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, shellHostEnv+key+"="+value)
+		}
+	}
+	sort.Strings(env)
+	return env
+}
+
+// shellExports returns the commands to change a shell environment (before)
+// to another (after). The prompt is left to the shell.
+func shellExports(before map[string]string, after map[string]string) string {
+
+	var keys []string
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var commands []string
+	for _, key := range keys {
+		if key == "PS1" || !shellVariable.MatchString(key) {
+			continue
+		}
+		value, ok := after[key]
+		if !ok {
+			commands = append(commands, "unset "+key)
+		} else if previous, was := before[key]; !was || previous != value {
+			commands = append(commands, fmt.Sprintf("export %s=%s", key, util.ShellQuote(value)))
+		}
+	}
+	if len(commands) == 0 {
+		return ""
+	}
+	return strings.Join(commands, "\n") + "\n"
+}
+
+// environMap returns an environment (KEY=VALUE pairs) as a map
+func environMap(env []string) map[string]string {
+
+	environment := make(map[string]string)
+	for _, pair := range env {
+		if parts := strings.SplitN(pair, "=", 2); len(parts) == 2 {
+			environment[parts[0]] = parts[1]
+		}
+	}
+	return environment
+}
@@ -16,9 +16,12 @@
 package client
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -49,8 +52,110 @@ func TestShell(t *testing.T) {
 	cli := ScifClient{}.Load(dir)
 
 	// Test shell without selecting an application
-	err = cli.shell()
+	_, err = cli.shell(context.Background(), RunSpec{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}, func() {})
 	if err != nil {
 		t.Errorf("Error running scif shell.")
 	}
 }
+
+// TestShellExports tests the commands that update a shell for an app
+func TestShellExports(t *testing.T) {
+
+	before := map[string]string{"PATH": "/bin", "OLD": "1", "PS1": "$ ", "SAME": "x"}
+	after := map[string]string{"PATH": "/apps/foo/bin:/bin", "NEW": "it's", "PS1": "> ", "SAME": "x", "SCIF_APPRUN_foo-bar": "y"}
+
+	expected := "export NEW='it'\"'\"'s'\nunset OLD\nexport PATH=/apps/foo/bin:/bin\n"
+	if exports := shellExports(before, after); exports != expected {
+		t.Errorf("Expected exports %q, got %q", expected, exports)
+	}
+	if exports := shellExports(before, before); exports != "" {
+		t.Errorf("Expected no exports, got %q", exports)
+	}
+}
+
+// TestShellRC tests running the generated rc, and the prompt it sets
+func TestShellRC(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rc := filepath.Join(dir, "rc")
+	if err := writeShellRC(rc, shellPosix, "/bin/scif", ""); err != nil {
+		t.Errorf("Error writing rc: %v", err)
+	}
+	cmd := exec.Command("sh", "-c", `. "$1"; eval "echo \"$PS1\""`, "sh", rc)
+	cmd.Env = []string{shellAppsEnv + "=foo bar", "PS1=" + scifPrompt}
+	output, err := cmd.Output()
+	if err != nil {
+		t.Errorf("Error running rc: %v", err)
+	}
+	if prompt := strings.TrimSpace(string(output)); prompt != "scif(foo bar)>" {
+		t.Errorf("Expected the apps in the prompt, got %q", prompt)
+	}
+}
+
+// TestShellDeactivate tests that deactivating an app in a shell restores the
+// values of the host that its environment changed
+func TestShellDeactivate(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	recipe := filepath.Join(dir, "lang.scif")
+	ioutil.WriteFile(recipe, []byte("%appenv lang\n    LANG=C.app\n    export LANG\n    APPONLY=yes\n    export APPONLY\n"), 0644)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+	if err := Install(recipe, []string{}, true); err != nil {
+		t.Errorf("Error installing temporary SCIF: %v", err)
+	}
+
+	lang, hasLang := os.LookupEnv("LANG")
+	defer func() {
+		if hasLang {
+			os.Setenv("LANG", lang)
+		} else {
+			os.Unsetenv("LANG")
+		}
+		os.Unsetenv(shellAppsEnv)
+	}()
+	os.Setenv("LANG", "C.host")
+	os.Unsetenv(shellAppsEnv)
+
+	// The exports are printed (to be evaluated by the shell)
+	exports := func(action string, args ...string) string {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("Error creating pipe: %v", err)
+		}
+		stdout := os.Stdout
+		os.Stdout = writer
+		printShellExports(action, args)
+		os.Stdout = stdout
+		writer.Close()
+		output, _ := ioutil.ReadAll(reader)
+		return string(output)
+	}
+
+	activated := exports("activate", "lang")
+	for _, line := range []string{"export LANG=C.app", "export APPONLY=yes", "export " + shellHostEnv + "LANG=C.host"} {
+		if !strings.Contains(activated, line+"\n") {
+			t.Errorf("Expected %q to activate, got\n%s", line, activated)
+		}
+	}
+
+	os.Setenv(shellAppsEnv, "lang")
+	deactivated := exports("deactivate")
+	for _, line := range []string{"export LANG=C.host", "unset APPONLY", "unset " + shellHostEnv + "LANG"} {
+		if !strings.Contains(deactivated, line+"\n") {
+			t.Errorf("Expected %q to deactivate, got\n%s", line, deactivated)
+		}
+	}
+}
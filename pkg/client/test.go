@@ -16,22 +16,54 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/sci-f/scif-go/internal/pkg/logger"
 	"github.com/sci-f/scif-go/pkg/util"
-	"os"
 )
 
-// Test an app for a scientific filesystem. If a user chooses
-// This option, we know we are loading a Filesystem first.
-func Test(name string, cmd []string) (err error) {
+// Test an app for a scientific filesystem. The test is connected to the
+// terminal of the calling process. If the app has no tests, the result is nil.
+func Test(name string, cmd []string) (*RunResult, error) {
+
+	ctx, cancel := InterruptContext()
+	defer cancel()
+
+	return TestApp(ctx, RunSpec{App: name,
+		Args:   cmd,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr})
+}
+
+// TestApp runs the test for an app, as RunApp does for the entrypoint. If a
+// user chooses This option, we know we are loading a Filesystem first. If the
+// app has no tests, the result is nil.
+func TestApp(ctx context.Context, spec RunSpec) (*RunResult, error) {
+	result, _, err := testApp(ctx, spec, "", false)
+	return result, err
+}
+
+// testApp runs the %apptest of an app, or one of its named test cases (see
+// testcases.go), with a scratch directory (see testfiles.go) that is removed
+// after the test unless keep is true. It also returns the directory.
+func testApp(ctx context.Context, spec RunSpec, test string, keep bool) (*RunResult, string, error) {
 
 	// Running an app means we load from the filesystem first
+	unlock := lockState()
+	defer unlock()
 	cli := ScifClient{}.Load(Scif.Base)
+	name := spec.App
 
 	// Ensure that the app exists on the filesystem
 	if ok := util.Contains(name, cli.apps()); !ok {
-		logger.Warningf("%s is not an installed app.", name)
-		return err
+		return nil, "", fmt.Errorf("%s is not an installed app", name)
 	}
 
 	// Activate the app, meaning we set the active app environment
@@ -40,19 +72,190 @@ func Test(name string, cmd []string) (err error) {
 	// Get a lookup for the folders (not created)
 	lookup := cli.getAppenvLookup(name)
 
-	// Set the entrypoint to be the test script, if it exists
-	if _, err := os.Stat(lookup["apptest"]); os.IsNotExist(err) {
+	// A test case has its own script
+	if test != "" {
+		testCase, ok := getTestCase(name, test)
+		if !ok {
+			return nil, "", fmt.Errorf("%s has no test case %s", name, test)
+		}
+		path := cli.testCasePath(name, test)
+		if _, err := os.Stat(path); err != nil {
+			return nil, "", fmt.Errorf("test case %s of %s is not installed", test, name)
+		}
+		Scif.EntryPoint = append(testCase.command(), path)
+
+		// Set the entrypoint to be the test script, if it exists
+	} else if _, err := os.Stat(lookup["apptest"]); os.IsNotExist(err) {
 		logger.Warningf("No tests defined for %s", name)
-		os.Exit(0)
+		return nil, "", nil
 
 		// Otherwise, the apptest is our entrypoint
 	} else {
-		Scif.EntryPoint = nil
-		Scif.EntryPoint = append(Scif.EntryPoint, Scif.ShellCmd, lookup["apptest"])
+		Scif.EntryPoint = append(cli.interpreter(name, "apptest"), lookup["apptest"])
 	}
 
+	// The test gets its own scratch directory, with the fixtures of the app
+	dir, err := cli.makeTestDir(name)
+	if err != nil {
+		return nil, "", err
+	}
+	if keep {
+		logger.Infof("Keeping the test directory %s", dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+	spec.Env = append(append([]string{}, spec.Env...), "SCIF_TESTDIR="+dir)
+
 	// Add additional args to the entrypoint
 	logger.Debugf("Testing app %s", name)
 
-	return cli.execute(name, cmd)
+	result, err := cli.execute(ctx, spec, unlock)
+	return result, dir, err
+}
+
+// TestOptions are how RunTests runs the tests of apps
+type TestOptions struct {
+	Jobs     int      // the number of tests to run at once (1 by default)
+	FailFast bool     // don't start more tests after one fails
+	Cases    []string // only run the named test cases with these names
+	Keep     bool     // keep the scratch directory of each test
+}
+
+// testTarget is a test to run, the %apptest of an app or a named case
+type testTarget struct {
+	app      string
+	approot  string
+	test     *appTestCase
+	testName string
+}
+
+// RunTests runs the tests of the apps, up to options.Jobs at once, with the
+// stdio and options of the spec (the output is also kept for the report).
+// An app is tested by its %apptest and its named test cases, or only the
+// cases in options.Cases. Each test is run in its own activated environment.
+// The tests that haven't started are skipped if the context is cancelled, or
+// after a failure with options.FailFast. The cases of the report are in the
+// order of the names.
+func RunTests(ctx context.Context, names []string, spec RunSpec, options TestOptions) *TestReport {
+
+	report := &TestReport{Start: time.Now()}
+	jobs := options.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	targets := testTargets(names, options.Cases)
+	cases := make([]TestCase, len(targets))
+	slots := make(chan struct{}, jobs)
+	var failed int32
+	var wait sync.WaitGroup
+
+	for i, target := range targets {
+
+		slots <- struct{}{}
+		if ctx.Err() != nil || (options.FailFast && atomic.LoadInt32(&failed) != 0) {
+			message := "interrupted"
+			if ctx.Err() == nil {
+				message = "not run (fail fast)"
+			}
+			cases[i] = TestCase{App: target.app, Name: target.testName, Status: TestSkipped, Start: time.Now(), Message: message}
+			<-slots
+			continue
+		}
+
+		wait.Add(1)
+		go func(i int, target testTarget) {
+			defer wait.Done()
+			cases[i] = testCase(ctx, target, spec, options.Keep)
+			if cases[i].Status == TestFailed || cases[i].Status == TestError {
+				atomic.StoreInt32(&failed, 1)
+			}
+			<-slots
+		}(i, target)
+	}
+	wait.Wait()
+
+	for _, test := range cases {
+		report.add(test)
+	}
+	report.Duration = time.Since(report.Start).Seconds()
+	return report
+}
+
+// testTargets returns the tests of the apps, the %apptest of each (or the
+// app, which is skipped if it has no tests at all) and its named cases. If
+// cases are given, only the named cases with those names are returned.
+func testTargets(names []string, cases []string) []testTarget {
+
+	cli := ScifClient{}.Load(Scif.Base)
+
+	var targets []testTarget
+	for _, name := range names {
+
+		settings, installed := Scif.config[name]
+		if len(cases) == 0 && (len(settings.test) > 0 || len(settings.cases) == 0) {
+			targets = append(targets, testTarget{app: name})
+		}
+		if !installed {
+			continue
+		}
+
+		approot := cli.getAppenvLookup(name)["approot"]
+		for i := range settings.cases {
+			test := settings.cases[i]
+			if len(cases) == 0 || util.Contains(test.name, cases) {
+				targets = append(targets, testTarget{app: name, approot: approot, test: &test, testName: test.name})
+			}
+		}
+	}
+	return targets
+}
+
+// testCase runs a test of an app, and returns the result as a case. Only
+// one test is started at a time (see stateLock), and the next can start once
+// the process of this one is running. A kept scratch directory is in the
+// case.
+func testCase(ctx context.Context, target testTarget, spec RunSpec, keep bool) TestCase {
+
+	var stdout, stderr bytes.Buffer
+	spec.App = target.app
+	spec.Stdout = teeWriter(spec.Stdout, &stdout)
+	spec.Stderr = teeWriter(spec.Stderr, &stderr)
+
+	test := TestCase{App: target.app, Name: target.testName, Start: time.Now()}
+	result, dir, err := testApp(ctx, spec, target.testName, keep)
+	test.Duration = time.Since(test.Start).Seconds()
+	test.Stdout, test.Stderr = stdout.String(), stderr.String()
+	if keep {
+		test.Dir = dir
+	}
+
+	switch {
+	case err != nil:
+		test.Status, test.Message = TestError, err.Error()
+	case result == nil:
+		test.Status, test.Message = TestSkipped, "no tests defined"
+	default:
+		test.ExitCode, test.status = result.ExitCode, result.Status()
+		test.TimedOut = result.TimedOut()
+		test.Duration = result.Duration().Seconds()
+		if result.Signal != 0 {
+			test.Signal = result.Signal.String()
+		}
+
+		// A named case is checked against what it expects
+		if target.test != nil {
+			test.Message, test.Diff, err = target.test.check(target.approot, result, test.Stdout, test.Stderr)
+		} else {
+			test.Message = failureMessage(result)
+		}
+
+		test.Status = TestPassed
+		if err != nil {
+			test.Status, test.Message = TestError, err.Error()
+		} else if test.Message != "" {
+			test.Status = TestFailed
+		}
+	}
+	return test
 }
@@ -0,0 +1,280 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/util"
+)
+
+// Besides its %apptest, an app can have named test cases, each with its own
+// script, and expectations for the result in the section header:
+//
+//	%apptest align small --stdout '^aligned [0-9]+ reads$'
+//	    align --input small.bam
+//	%apptest align missing-input --exit 2 --stderr 'no such file'
+//	    align --input /does/not/exist
+//	%apptest align summary --stdout-file tests/summary.txt
+//	    align --input small.bam --summary
+//
+// --exit is the expected exit code (0 by default), --stdout and --stderr are
+// regular expressions that the output must match (^ and $ match at line
+// breaks), and --stdout-file and --stderr-file are files (relative to the app
+// root, e.g., from %appfiles) that the output must equal. A case fails with
+// the first expectation it doesn't meet, and an output that isn't equal to
+// its file is shown as a diff. Like %apptest, a case can have an --interpreter (or a shebang). The
+// script of a case is installed to scif/tests/<case>.sh.
+
+// testCaseOptions are the options of a test case header, in the order they
+// are checked
+var testCaseOptions = []string{"exit", "stdout", "stderr", "stdout-file", "stderr-file", "interpreter"}
+
+// testCaseName is a valid name for a test case (it's also a file name)
+var testCaseName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// maxDiffLines is the most lines of output that are compared for a diff
+const maxDiffLines = 2000
+
+// appTestCase is a named test of an app, from %apptest <app> <case>
+type appTestCase struct {
+	name    string
+	script  []string
+	options map[string]string
+}
+
+// isTestCase returns true if the name of an %apptest section has a case
+func isTestCase(name string) bool {
+	return len(strings.Fields(name)) > 1
+}
+
+// splitTestCase splits the name of an %apptest section into the app and the
+// name of the case
+func splitTestCase(name string) (string, string) {
+	fields := strings.Fields(name)
+	return fields[0], strings.Join(fields[1:], " ")
+}
+
+// addTestCase adds a test case (with the options of the header) to its app
+func addTestCase(name string, options map[string]string) {
+
+	app, test := splitTestCase(name)
+	if !testCaseName.MatchString(test) {
+		logger.Warningf("%s is not a valid test case name for %s, skipping", test, app)
+		return
+	}
+	for key := range options {
+		if !util.Contains(key, testCaseOptions) {
+			logger.Warningf("--%s is not a valid option for %%apptest %s %s, skipping", key, app, test)
+			delete(options, key)
+		}
+	}
+
+	// A case that is defined again replaces the first
+	settings := getSettings(app)
+	for i, existing := range settings.cases {
+		if existing.name == test {
+			settings.cases = append(settings.cases[:i], settings.cases[i+1:]...)
+			break
+		}
+	}
+	settings.cases = append(settings.cases, appTestCase{name: test, options: options})
+	Scif.config[app] = settings
+}
+
+// setTestCaseScript sets the script of a test case added by addTestCase
+func setTestCaseScript(name string, script []string) {
+
+	app, test := splitTestCase(name)
+	settings := Scif.config[app]
+	for i := range settings.cases {
+		if settings.cases[i].name == test {
+			settings.cases[i].script = script
+		}
+	}
+}
+
+// header returns the name and options for the section header of the case
+func (test appTestCase) header(app string) string {
+
+	header := app + " " + test.name
+	for _, key := range testCaseOptions {
+		if value, ok := test.options[key]; ok {
+			header += " --" + key + " " + util.ShellQuote(value)
+		}
+	}
+	return header
+}
+
+// command returns the command to run the script of the case, as
+// ScifClient.interpreter does for %apptest
+func (test appTestCase) command() []string {
+	if interpreter := test.options["interpreter"]; interpreter != "" {
+		return util.ParseEntrypoint(interpreter)
+	}
+	if interpreter := shebang(test.script); interpreter != "" {
+		return shebangInterpreter(interpreter)
+	}
+	return []string{Scif.ShellCmd}
+}
+
+// runsInShell returns true if the script of the case is run by the shell
+func (test appTestCase) runsInShell() bool {
+	return test.options["interpreter"] == "" && shebang(test.script) == ""
+}
+
+// testCasePath returns the path of the installed script of a test case
+func (client ScifClient) testCasePath(name string, test string) string {
+	return filepath.Join(client.getAppenvLookup(name)["appmeta"], "tests", test+".sh")
+}
+
+// getTestCase returns a test case of an app, from the loaded config
+func getTestCase(name string, test string) (appTestCase, bool) {
+	for _, existing := range Scif.config[name].cases {
+		if existing.name == test {
+			return existing, true
+		}
+	}
+	return appTestCase{}, false
+}
+
+// check compares the result and output of a test case with what it expects,
+// and returns why it failed (and a diff for an output file), or an empty
+// message if it passed. A wrong expectation (e.g., a bad regular expression)
+// is an error.
+func (test appTestCase) check(approot string, result *RunResult, stdout string, stderr string) (string, string, error) {
+
+	// The exit code comes first, since the output of a crash is no surprise
+	expected := 0
+	if value, ok := test.options["exit"]; ok {
+		var err error
+		if expected, err = strconv.Atoi(value); err != nil {
+			return "", "", fmt.Errorf("--exit %s is not a number", value)
+		}
+	}
+	if result.Limit != "" || result.Signal != 0 || result.ExitCode != expected {
+		message := failureMessage(result)
+		if message == "" {
+			message = "exit code 0"
+		}
+		if expected != 0 {
+			message += fmt.Sprintf(", expected %d", expected)
+		}
+		return message, "", nil
+	}
+
+	outputs := map[string]string{"stdout": stdout, "stderr": stderr}
+	for _, stream := range []string{"stdout", "stderr"} {
+
+		if pattern, ok := test.options[stream]; ok {
+			expression, err := regexp.Compile("(?m)" + pattern)
+			if err != nil {
+				return "", "", fmt.Errorf("--%s: %s", stream, err)
+			}
+			if !expression.MatchString(outputs[stream]) {
+				return fmt.Sprintf("%s doesn't match %s", stream, pattern), "", nil
+			}
+		}
+
+		if path, ok := test.options[stream+"-file"]; ok {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(approot, path)
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return "", "", fmt.Errorf("--%s-file: %s", stream, err)
+			}
+			if string(content) != outputs[stream] {
+				message := fmt.Sprintf("%s isn't equal to %s", stream, test.options[stream+"-file"])
+				return message, lineDiff(string(content), outputs[stream], test.options[stream+"-file"], stream), nil
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// lineDiff returns a diff of the lines of what was expected and the actual
+// output, with "-" for a line that is only expected, and "+" for one that is
+// only in the output. Long outputs are only compared by their first lines.
+func lineDiff(expected string, actual string, expectedName string, actualName string) string {
+
+	before := splitLines(expected)
+	after := splitLines(actual)
+	lines := []string{"--- " + expectedName, "+++ " + actualName}
+
+	truncated := len(before) > maxDiffLines || len(after) > maxDiffLines
+	if len(before) > maxDiffLines {
+		before = before[:maxDiffLines]
+	}
+	if len(after) > maxDiffLines {
+		after = after[:maxDiffLines]
+	}
+
+	// The longest common subsequence of lines, from the end
+	common := make([][]int, len(before)+1)
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			lines = append(lines, "  "+before[i])
+			i, j = i+1, j+1
+		case j < len(after) && (i == len(before) || common[i][j+1] >= common[i+1][j]):
+			lines = append(lines, "+ "+after[j])
+			j++
+		default:
+			lines = append(lines, "- "+before[i])
+			i++
+		}
+	}
+	if truncated {
+		lines = append(lines, fmt.Sprintf("(only the first %d lines are compared)", maxDiffLines))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// splitLines splits text into lines, and a missing newline at the end is
+// shown as a line of its own
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	return append(lines, "\\ no newline at end")
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLineDiff tests the diff of an output and its expected file
+func TestLineDiff(t *testing.T) {
+
+	diff := lineDiff("one\ntwo\nthree\n", "one\n2\nthree", "expected.txt", "stdout")
+	expected := strings.Join([]string{"--- expected.txt", "+++ stdout", "  one", "+ 2", "- two", "  three",
+		"+ \\ no newline at end"}, "\n")
+	if diff != expected {
+		t.Errorf("Incorrect diff\n%s\nwant\n%s", diff, expected)
+	}
+}
+
+// TestTestCases tests running the named test cases of an app
+func TestTestCases(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	golden := filepath.Join(dir, "golden.txt")
+	ioutil.WriteFile(golden, []byte("line one\nline two\n"), 0644)
+	recipe := filepath.Join(dir, "cases.scif")
+	ioutil.WriteFile(recipe, []byte(`%apprun calc
+    echo $(( $1 + $2 ))
+%apptest calc adds --stdout '^4$'
+    echo $(( 2 + 2 ))
+%apptest calc fails --exit 3 --stderr 'oops'
+    echo oops >&2; exit 3
+%apptest calc golden --stdout-file `+golden+`
+    printf 'line one\nline 2\n'
+%apptest calc bad-regex --stdout '['
+    true
+%apptest calc 'bad name'
+    true
+%apptest calc hangs
+    sleep 10
+`), 0644)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+	if err := Install(recipe, []string{}, true); err != nil {
+		t.Errorf("Error installing temporary SCIF: %v", err)
+	}
+
+	report := RunTests(context.Background(), []string{"calc"}, RunSpec{}, TestOptions{Cases: []string{"fails", "golden", "bad-regex"}})
+	if report.Tests != 3 || report.Passed != 1 || report.Failed != 1 || report.Errors != 1 {
+		t.Errorf("Incorrect counts in the report %+v", report)
+	}
+	test := report.Cases[1]
+	if test.Name != "golden" || test.Status != TestFailed || !strings.Contains(test.Diff, "- line two\n+ line 2") &&
+		!strings.Contains(test.Diff, "+ line 2\n- line two") {
+		t.Errorf("Incorrect case %+v", test)
+	}
+
+	// A case that times out fails, and is marked in the reports
+	report = RunTests(context.Background(), []string{"calc"}, RunSpec{Timeout: 100 * time.Millisecond}, TestOptions{Cases: []string{"hangs"}})
+	test = report.Cases[0]
+	if test.Status != TestFailed || !test.TimedOut || test.Message != "timed out" || report.ExitStatus() != ExitTimeout {
+		t.Errorf("Incorrect case for a timeout %+v", test)
+	}
+	var junit bytes.Buffer
+	report.Write(ReportJUnit, &junit)
+	if !strings.Contains(junit.String(), `type="timeout"`) {
+		t.Errorf("The JUnit report doesn't have the timeout\n%s", junit.String())
+	}
+
+	// Without a filter, all cases run (and the app has no default %apptest)
+	report = RunTests(context.Background(), []string{"calc"}, RunSpec{Timeout: time.Second}, TestOptions{})
+	if report.Tests != 5 || report.Cases[0].Name != "adds" || report.Cases[0].Status != TestPassed {
+		t.Errorf("Incorrect report for all cases %+v", report.Cases[0])
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+)
+
+// Each test of an app (its %apptest, or a named case) runs with a scratch
+// directory of its own, exported as SCIF_TESTDIR, so that a test doesn't
+// write into the real data of the app ($SCIF_APPDATA_<app>), and two runs
+// of a test don't collide. The directory is removed when the test is done,
+// unless it's kept (scif test --keep) to look at what a test left behind.
+//
+// Fixtures for the tests are added with %apptestfiles, like %appfiles, a
+// source and an optional destination (relative to the scratch directory) on
+// each line:
+//
+//	%apptestfiles align
+//	    tests/small.bam
+//	    tests/reference reference/
+//
+// The fixtures are copied to scif/testfiles when the app is installed (the
+// sources are relative to where scif install is run), and from there into
+// the scratch directory before each test starts.
+
+// testFilesPath returns the folder with the installed fixtures of an app
+func (client ScifClient) testFilesPath(name string) string {
+	return filepath.Join(client.getAppenvLookup(name)["appmeta"], "testfiles")
+}
+
+// installTestFiles copies the %apptestfiles of an app to scif/testfiles
+func (client ScifClient) installTestFiles(name string) {
+
+	files := Scif.config[name].testfiles
+	if len(files) > 0 {
+		logger.Debugf("+ apptestfiles %s", name)
+		root := client.testFilesPath(name)
+		if err := os.MkdirAll(root, os.ModePerm); err != nil {
+			logger.Exitf("%s", err)
+		}
+		if err := copyFiles(files, root, false); err != nil {
+			logger.Exitf("%s %%apptestfiles: %s", name, err)
+		}
+	}
+}
+
+// makeTestDir creates a scratch directory for a test of an app, with a copy
+// of its fixtures
+func (client ScifClient) makeTestDir(name string) (string, error) {
+
+	dir, err := ioutil.TempDir("", "scif-test-"+name+"-")
+	if err != nil {
+		return "", err
+	}
+
+	fixtures := client.testFilesPath(name)
+	if _, err := os.Stat(fixtures); err == nil {
+		output, err := exec.Command("cp", "-R", fixtures+"/.", dir).CombinedOutput()
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("copying the fixtures of %s: %s", name, strings.TrimSpace(string(output)))
+		}
+	}
+	return dir, nil
+}
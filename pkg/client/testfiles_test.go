@@ -0,0 +1,73 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTestFiles tests copying fixtures into the scratch directory of a test
+func TestTestFiles(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture := filepath.Join(dir, "small.txt")
+	ioutil.WriteFile(fixture, []byte("small\n"), 0644)
+	recipe := filepath.Join(dir, "fixtures.scif")
+	ioutil.WriteFile(recipe, []byte(`%apprun calc
+    echo run
+%apptestfiles calc
+    `+fixture+`
+    `+fixture+` inputs/
+%apptest calc
+    cat $SCIF_TESTDIR/small.txt $SCIF_TESTDIR/inputs/small.txt
+    echo $SCIF_TESTDIR
+`), 0644)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+	if err := Install(recipe, []string{}, true); err != nil {
+		t.Errorf("Error installing temporary SCIF: %v", err)
+	}
+
+	report := RunTests(context.Background(), []string{"calc"}, RunSpec{}, TestOptions{})
+	test := report.Cases[0]
+	if test.Status != TestPassed || !strings.HasPrefix(test.Stdout, "small\nsmall\n") || test.Dir != "" {
+		t.Errorf("Incorrect case %+v", test)
+	}
+	scratch := strings.TrimSpace(strings.TrimPrefix(test.Stdout, "small\nsmall\n"))
+	if _, err := os.Stat(scratch); !os.IsNotExist(err) {
+		t.Errorf("The scratch directory %s wasn't removed", scratch)
+	}
+
+	// A kept directory is in the case
+	report = RunTests(context.Background(), []string{"calc"}, RunSpec{}, TestOptions{Keep: true})
+	test = report.Cases[0]
+	defer os.RemoveAll(test.Dir)
+	if _, err := os.Stat(filepath.Join(test.Dir, "inputs", "small.txt")); err != nil {
+		t.Errorf("The scratch directory wasn't kept: %v", err)
+	}
+}
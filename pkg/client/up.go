@@ -0,0 +1,194 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/util"
+)
+
+// scif up runs apps together in the foreground, typically as the command of
+// a container (with scif as the init, see init.go). Apps with a %appservice
+// section are run by a service supervisor (and restarted as their policy
+// says), and others are run once as a job, with the output of all of them to
+// ours. The first app is the primary app: when it exits the others are
+// stopped, and scif exits with its status. Each leads its own process group,
+// and signals that we receive are forwarded to them.
+
+// upStopGrace is the time given to apps to stop (after the stop-timeout of
+// services) before they are killed
+const upStopGrace = 5 * time.Second
+
+// upApp is an app run by scif up
+type upApp struct {
+	name    string
+	env     []string // what to supervise (see reexec.go)
+	service bool
+	job     string // the path of the job, for an app that isn't a service
+	process *exec.Cmd
+	exited  bool
+}
+
+// upExit is an app that has exited, with its exit status
+type upExit struct {
+	app    *upApp
+	status int
+}
+
+// Up runs apps together until the first (primary) app exits, and returns
+// its exit status.
+func Up(names []string) (int, error) {
+
+	if len(names) == 0 {
+		return 0, fmt.Errorf("no apps to run")
+	}
+
+	cli := ScifClient{}.Load(Scif.Base)
+	timeout := defaultStopTimeout
+
+	// Check all apps before preparing their state (or running any)
+	configs := make(map[string]*ServiceConfig)
+	for _, name := range names {
+		if ok := util.Contains(name, cli.apps()); !ok {
+			return 0, fmt.Errorf("%s is not an installed app", name)
+		}
+		config, err := cli.getService(name)
+		if err != nil {
+			return 0, err
+		}
+		configs[name] = config
+	}
+
+	// The supervisor of a job forwards our signals to the app, as under the
+	// init, and a service is stopped by its supervisor with its stop-signal.
+	// Both apps lead their own group.
+	var apps []*upApp
+	for _, name := range names {
+
+		config := configs[name]
+		if config == nil {
+			job, err := newJob(RunSpec{App: name}, false)
+			if err != nil {
+				return 0, err
+			}
+			apps = append(apps, &upApp{name: name, env: []string{jobEnv + "=" + job.path, initChildEnv + "=1"}, job: job.path})
+			continue
+		}
+
+		service, err := newService(name, false)
+		if err != nil {
+			return 0, err
+		}
+		apps = append(apps, &upApp{name: name, env: []string{serviceEnv + "=" + service.path}, service: true})
+		if config.StopTimeout > timeout {
+			timeout = config.StopTimeout
+		}
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	// Signals are handled before the apps start, so none are missed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, initSignals...)
+	defer signal.Stop(signals)
+
+	exits := make(chan upExit, len(apps))
+	for i, app := range apps {
+
+		process := exec.Command(self)
+		process.Env = append(os.Environ(), logger.GetMessageLevel(),
+			"SCIF_BASE="+Scif.Base, "SCIF_APPS="+Scif.Apps, "SCIF_DATA="+Scif.Data)
+		process.Env = append(process.Env, app.env...)
+		process.Stdout, process.Stderr = os.Stdout, os.Stderr
+		process.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+		if err := process.Start(); err != nil {
+			stopApps(apps[:i], syscall.SIGTERM)
+			return 0, fmt.Errorf("cannot run %s: %s", app.name, err)
+		}
+		logger.Infof("Started %s (pid %d)", app.name, process.Process.Pid)
+
+		app.process = process
+		go func(app *upApp) {
+			app.process.Wait()
+			exits <- upExit{app, waitStatus(app.process.ProcessState.Sys().(syscall.WaitStatus))}
+		}(app)
+	}
+
+	// Wait for the primary app, and then for the others to stop
+	status := 0
+	running := len(apps)
+	var deadline <-chan time.Time
+	for running > 0 {
+		select {
+		case exit := <-exits:
+			exit.app.exited = true
+			running--
+			logger.Infof("%s exited (%d)", exit.app.name, exit.status)
+
+			if exit.app == apps[0] {
+				status = exit.status
+				if running > 0 {
+					logger.Infof("Stopping the other apps, as %s (the primary app) exited", exit.app.name)
+					stopApps(apps, syscall.SIGTERM)
+					deadline = time.After(timeout + upStopGrace)
+				}
+			}
+
+		case sig := <-signals:
+			logger.Debugf("Received %s, forwarding to the apps", sig)
+			stopApps(apps, sig.(syscall.Signal))
+
+		case <-deadline:
+			logger.Warningf("Apps are still running after %s, killing them", timeout+upStopGrace)
+			stopApps(apps, syscall.SIGKILL)
+			deadline = nil
+		}
+	}
+	return status, nil
+}
+
+// stopApps sends a signal to the apps that are running (to the groups of
+// their supervisors). A service or job is killed with its supervisor, as it
+// leads its own group.
+func stopApps(apps []*upApp, sig syscall.Signal) {
+	for _, app := range apps {
+		if app.exited {
+			continue
+		}
+		if app.service && sig == syscall.SIGKILL {
+			if service, err := readService(app.name); err == nil && service.PID != 0 {
+				killProcess(service.PID)
+			}
+		}
+		if app.job != "" && sig == syscall.SIGKILL {
+			if job, err := readJob(app.job); err == nil && job.PID != 0 {
+				killProcess(job.PID)
+			}
+		}
+		syscall.Kill(-app.process.Process.Pid, sig)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestUp tests running an app with a service, which stops when the primary
+// app exits. Both are supervised by the test binary started again.
+func TestUp(t *testing.T) {
+
+	// Create faux scif base
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+
+	recipe := filepath.Join(dir, "up.scif")
+	content := "%apprun main\n    sleep 0.5\n    exit 3\n" +
+		"%appservice sleeper\n    start sleep 30\n    stop-timeout 5s\n"
+	if err := ioutil.WriteFile(recipe, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing recipe: %v", err)
+	}
+	if err := Install(recipe, []string{}, true); err != nil {
+		t.Fatalf("Error installing temporary SCIF")
+	}
+
+	if _, err := Up([]string{"main", "doesnotexist"}); err == nil {
+		t.Errorf("Up with an app that isn't installed should fail")
+	}
+
+	status, err := Up([]string{"main", "sleeper"})
+	if err != nil || status != 3 {
+		t.Fatalf("Up should exit with the primary status 3, got %d (%v)", status, err)
+	}
+
+	service, err := readService("sleeper")
+	if err != nil || service.Status != ServiceStopped {
+		t.Errorf("Service should be stopped, got %+v (%v)", service, err)
+	}
+	jobs, err := ListJobs()
+	if err != nil || len(jobs) != 1 || jobs[0].Status != JobExited || jobs[0].ExitCode != 3 {
+		t.Errorf("Expected an exited job for main, got %v (%v)", jobs, err)
+	}
+}
@@ -0,0 +1,457 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/shlex"
+	"github.com/sci-f/scif-go/internal/pkg/logger"
+	"github.com/sci-f/scif-go/pkg/util"
+)
+
+// A workflow chains apps of a scientific filesystem as steps, and is defined
+// in a %workflow section of a recipe (or a separate file with only %workflow
+// sections). Each line is a directive, the name of a step, and values:
+//
+//	%workflow pipeline
+//	    step index bwa-index ref.fa
+//	    step align bwa-align sample.fq
+//	    needs align index
+//	    inputs index ref.fa
+//	    outputs index ref.fa.bwt
+//	    inputs align ref.fa.bwt $SCIF_APPDATA_reads/sample.fq
+//	    outputs align sample.bam
+//
+// step <step> <app> [args...]   runs an app with optional arguments
+// needs <step> <step>...        the steps that must run before this one
+// inputs <step> <path>...       files the step reads
+// outputs <step> <path>...      files the step writes
+//
+// Relative inputs and outputs are under the $SCIF_APPDATA_<app> of the step.
+// A step is up to date (and skipped) when all its outputs exist, and are
+// newer than all of its inputs.
+
+// Workflow is a loaded workflow, with steps in the order they are defined
+type Workflow struct {
+	Name  string
+	Steps []*WorkflowStep
+}
+
+// WorkflowStep is a single step (one app run) of a workflow
+type WorkflowStep struct {
+	Name    string
+	App     string
+	Args    []string
+	Needs   []string
+	Inputs  []string
+	Outputs []string
+}
+
+// WorkflowOptions select the steps of a workflow to run
+type WorkflowOptions struct {
+	File  string // load the workflow from this file instead of the base
+	From  string // run this step and the steps that depend on it
+	Until string // run this step and the steps it depends on
+	Force bool   // run steps even if they are up to date
+}
+
+// WorkflowStepResult is the outcome of a step for a workflow run
+type WorkflowStepResult struct {
+	Step     string
+	App      string
+	Status   string // one of the workflowStatus values below
+	ExitCode int
+	Duration time.Duration
+}
+
+// Status values for a workflow step
+const (
+	workflowSuccess  = "success"
+	workflowFailed   = "failed"
+	workflowUpToDate = "up-to-date"
+	workflowBlocked  = "blocked"
+	workflowExcluded = "excluded"
+)
+
+// RunWorkflow runs the steps of a workflow in dependency order, and prints a
+// status table when finished. If the name is empty and only one workflow is
+// defined, it is used. Steps that depend on a failed step are blocked, and an
+// error is returned if any step failed.
+func RunWorkflow(name string, options WorkflowOptions) ([]WorkflowStepResult, error) {
+
+	// Running a workflow means we load from the filesystem first
+	cli := ScifClient{}.Load(Scif.Base)
+
+	// A workflow file is used instead of the workflows installed
+	if options.File != "" {
+		Scif.workflows = make(map[string][]string)
+		if err := cli.loadRecipe(options.File); err != nil {
+			return nil, err
+		}
+	}
+
+	workflow, err := cli.getWorkflow(name)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, err := workflow.order()
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := workflow.selectSteps(options.From, options.Until)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure apps are installed, and resolve paths before running anything
+	cli.initEnv(cli.apps())
+	for _, step := range steps {
+		if _, err := os.Stat(filepath.Join(Scif.Apps, step.App)); err != nil {
+			return nil, fmt.Errorf("step %s: %s is not an installed app", step.Name, step.App)
+		}
+		step.Inputs = cli.resolveWorkflowPaths(step.App, step.Inputs)
+		step.Outputs = cli.resolveWorkflowPaths(step.App, step.Outputs)
+	}
+
+	ctx, cancel := InterruptContext()
+	defer cancel()
+
+	var results []WorkflowStepResult
+	status := make(map[string]string)
+	failed := false
+
+	for _, step := range steps {
+
+		result := WorkflowStepResult{Step: step.Name, App: step.App, ExitCode: -1}
+
+		switch {
+		case !selected[step.Name]:
+			result.Status = workflowExcluded
+		case step.isBlocked(status):
+			result.Status = workflowBlocked
+		case !options.Force && step.isUpToDate():
+			result.Status = workflowUpToDate
+		case ctx.Err() != nil:
+			result.Status = workflowBlocked
+		default:
+			logger.Infof("Running workflow %s step %s", workflow.Name, step.Name)
+			run, err := RunApp(ctx, RunSpec{App: step.App,
+				Args:   step.Args,
+				Stdin:  os.Stdin,
+				Stdout: os.Stdout,
+				Stderr: os.Stderr})
+
+			result.Status = workflowFailed
+			if err != nil {
+				logger.Errorf("step %s: %s", step.Name, err)
+			}
+			if run != nil {
+				result.ExitCode = run.Status()
+				result.Duration = run.Duration()
+				if err == nil && run.ExitCode == 0 {
+					result.Status = workflowSuccess
+				}
+			}
+		}
+
+		if result.Status == workflowFailed {
+			failed = true
+		}
+		status[step.Name] = result.Status
+		results = append(results, result)
+	}
+
+	printWorkflowResults(results)
+	if failed {
+		return results, fmt.Errorf("workflow %s failed", workflow.Name)
+	}
+	return results, nil
+}
+
+// getWorkflow returns a parsed workflow by name from those loaded
+func (client ScifClient) getWorkflow(name string) (*Workflow, error) {
+
+	// Without a name, there must be exactly one workflow
+	if name == "" {
+		var names []string
+		for workflowName := range Scif.workflows {
+			names = append(names, workflowName)
+		}
+		if len(names) != 1 {
+			sort.Strings(names)
+			return nil, fmt.Errorf("please specify a workflow to run, found %v", names)
+		}
+		name = names[0]
+	}
+
+	lines, ok := Scif.workflows[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a defined workflow", name)
+	}
+	return parseWorkflow(name, lines)
+}
+
+// parseWorkflow parses the lines of a %workflow section into a Workflow
+func parseWorkflow(name string, lines []string) (*Workflow, error) {
+
+	workflow := &Workflow{Name: name}
+	lookup := make(map[string]*WorkflowStep)
+
+	// Steps are defined first, other directives may come in any order
+	var directives [][]string
+	for _, line := range lines {
+
+		parts, err := shlex.Split(line)
+		if err != nil {
+			return nil, fmt.Errorf("workflow %s: %s", name, err)
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("workflow %s: invalid line %q", name, strings.TrimSpace(line))
+		}
+
+		if parts[0] != "step" {
+			directives = append(directives, parts)
+			continue
+		}
+
+		if _, ok := lookup[parts[1]]; ok {
+			return nil, fmt.Errorf("workflow %s: step %s is defined twice", name, parts[1])
+		}
+		step := &WorkflowStep{Name: parts[1], App: parts[2], Args: parts[3:]}
+		lookup[step.Name] = step
+		workflow.Steps = append(workflow.Steps, step)
+	}
+
+	for _, parts := range directives {
+
+		step, ok := lookup[parts[1]]
+		if !ok {
+			return nil, fmt.Errorf("workflow %s: %s for undefined step %s", name, parts[0], parts[1])
+		}
+
+		switch parts[0] {
+		case "needs":
+			step.Needs = append(step.Needs, parts[2:]...)
+		case "inputs":
+			step.Inputs = append(step.Inputs, parts[2:]...)
+		case "outputs":
+			step.Outputs = append(step.Outputs, parts[2:]...)
+		default:
+			return nil, fmt.Errorf("workflow %s: %s is not a valid directive", name, parts[0])
+		}
+	}
+	return workflow, nil
+}
+
+// getStep returns a step of the workflow by name, or nil if not defined
+func (workflow *Workflow) getStep(name string) *WorkflowStep {
+	for _, step := range workflow.Steps {
+		if step.Name == name {
+			return step
+		}
+	}
+	return nil
+}
+
+// order returns the steps so that each comes after the steps it needs,
+// otherwise keeping the order they are defined. Unknown steps and cycles
+// are errors.
+func (workflow *Workflow) order() ([]*WorkflowStep, error) {
+
+	for _, step := range workflow.Steps {
+		for _, need := range step.Needs {
+			if workflow.getStep(need) == nil {
+				return nil, fmt.Errorf("step %s needs undefined step %s", step.Name, need)
+			}
+		}
+	}
+
+	var ordered []*WorkflowStep
+	done := make(map[string]bool)
+
+	for len(ordered) < len(workflow.Steps) {
+
+		// Take the first step that has all its needs done
+		var next *WorkflowStep
+		for _, step := range workflow.Steps {
+			if !done[step.Name] && step.isReady(done) {
+				next = step
+				break
+			}
+		}
+
+		if next == nil {
+			return nil, fmt.Errorf("workflow %s has a dependency cycle", workflow.Name)
+		}
+		done[next.Name] = true
+		ordered = append(ordered, next)
+	}
+	return ordered, nil
+}
+
+// selectSteps returns the steps selected by from (the step and those that
+// depend on it) and until (the step and those it depends on). Both may be
+// given, and an empty string selects all steps.
+func (workflow *Workflow) selectSteps(from string, until string) (map[string]bool, error) {
+
+	selected := make(map[string]bool)
+	for _, step := range workflow.Steps {
+		selected[step.Name] = true
+	}
+
+	if from != "" {
+		if workflow.getStep(from) == nil {
+			return nil, fmt.Errorf("%s is not a step of workflow %s", from, workflow.Name)
+		}
+		downstream := workflow.related(from, func(step *WorkflowStep, name string) bool {
+			return util.Contains(name, step.Needs)
+		})
+		for name := range selected {
+			selected[name] = downstream[name]
+		}
+	}
+
+	if until != "" {
+		if workflow.getStep(until) == nil {
+			return nil, fmt.Errorf("%s is not a step of workflow %s", until, workflow.Name)
+		}
+		upstream := workflow.related(until, func(step *WorkflowStep, name string) bool {
+			return util.Contains(step.Name, workflow.getStep(name).Needs)
+		})
+		for name := range selected {
+			selected[name] = selected[name] && upstream[name]
+		}
+	}
+	return selected, nil
+}
+
+// related returns a step and all steps transitively linked to it, where
+// linked(step, name) says if step follows from the step called name.
+func (workflow *Workflow) related(name string, linked func(*WorkflowStep, string) bool) map[string]bool {
+
+	found := map[string]bool{name: true}
+	queue := []string{name}
+
+	for len(queue) > 0 {
+		name, queue = queue[0], queue[1:]
+		for _, step := range workflow.Steps {
+			if !found[step.Name] && linked(step, name) {
+				found[step.Name] = true
+				queue = append(queue, step.Name)
+			}
+		}
+	}
+	return found
+}
+
+// isReady determines if all steps needed by a step are done
+func (step *WorkflowStep) isReady(done map[string]bool) bool {
+	for _, need := range step.Needs {
+		if !done[need] {
+			return false
+		}
+	}
+	return true
+}
+
+// isBlocked determines if a step needs a step that failed (or was blocked)
+func (step *WorkflowStep) isBlocked(status map[string]string) bool {
+	for _, need := range step.Needs {
+		if status[need] == workflowFailed || status[need] == workflowBlocked {
+			return true
+		}
+	}
+	return false
+}
+
+// isUpToDate determines if a step declares outputs, and they all exist and
+// are newer than every input. A missing input means the step must run.
+func (step *WorkflowStep) isUpToDate() bool {
+
+	if len(step.Outputs) == 0 {
+		return false
+	}
+
+	var oldestOutput time.Time
+	for i, output := range step.Outputs {
+		info, err := os.Stat(output)
+		if err != nil {
+			return false
+		}
+		if i == 0 || info.ModTime().Before(oldestOutput) {
+			oldestOutput = info.ModTime()
+		}
+	}
+
+	for _, input := range step.Inputs {
+		info, err := os.Stat(input)
+		if err != nil || info.ModTime().After(oldestOutput) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveWorkflowPaths expands variables in paths with the scif environment
+// (e.g., $SCIF_APPDATA_<app>), and puts relative paths under the app data
+func (client ScifClient) resolveWorkflowPaths(name string, paths []string) []string {
+
+	lookup := client.getAppenvLookup(name)
+	var resolved []string
+
+	for _, path := range paths {
+		path = os.Expand(path, func(key string) string {
+			if value, ok := Scif.Environment[key]; ok {
+				return value
+			}
+			return os.Getenv(key)
+		})
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(lookup["appdata"], path)
+		}
+		resolved = append(resolved, path)
+	}
+	return resolved
+}
+
+// printWorkflowResults prints a table with the status of each step
+func printWorkflowResults(results []WorkflowStepResult) {
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "STEP\tAPP\tSTATUS\tEXIT\tDURATION")
+
+	for _, result := range results {
+		exitCode, duration := "-", "-"
+		if result.ExitCode >= 0 {
+			exitCode = fmt.Sprintf("%d", result.ExitCode)
+			duration = result.Duration.Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", result.Step, result.App, result.Status, exitCode, duration)
+	}
+	writer.Flush()
+}
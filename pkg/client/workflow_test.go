@@ -0,0 +1,285 @@
+// Copyright (C) 2019 Vanessa Sochat.
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public
+// License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testWorkflow is a small workflow shared by the tests below
+var testWorkflow = []string{
+	"    step index bwa-index ref.fa",
+	"    step align bwa-align 'sample 1.fq'",
+	"    step report multiqc",
+	"    step lint samtools-lint",
+	"    needs report align",
+	"    needs align index",
+	"    outputs index ref.fa.bwt",
+}
+
+// TestParseWorkflow tests parsing the lines of a %workflow section
+func TestParseWorkflow(t *testing.T) {
+
+	workflow, err := parseWorkflow("pipeline", testWorkflow)
+	if err != nil {
+		t.Fatalf("Error parsing workflow: %v", err)
+	}
+
+	if len(workflow.Steps) != 4 {
+		t.Fatalf("Expected 4 steps, got %d", len(workflow.Steps))
+	}
+
+	align := workflow.getStep("align")
+	if align.App != "bwa-align" || !Equal(align.Args, []string{"sample 1.fq"}) {
+		t.Errorf("Incorrect step, got %s %v", align.App, align.Args)
+	}
+	if !Equal(align.Needs, []string{"index"}) {
+		t.Errorf("Incorrect needs, got %v", align.Needs)
+	}
+	if !Equal(workflow.getStep("index").Outputs, []string{"ref.fa.bwt"}) {
+		t.Errorf("Incorrect outputs, got %v", workflow.getStep("index").Outputs)
+	}
+
+	// Invalid workflows
+	var invalid = []struct {
+		name  string
+		lines []string
+	}{
+		{"duplicate step", []string{"step one app", "step one app"}},
+		{"undefined step", []string{"step one app", "needs two one"}},
+		{"invalid directive", []string{"step one app", "wants one app"}},
+		{"missing app", []string{"step one"}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseWorkflow("invalid", tt.lines); err == nil {
+				t.Errorf("Expected error parsing %v", tt.lines)
+			}
+		})
+	}
+}
+
+// TestOrderWorkflow tests ordering the steps of a workflow by dependencies
+func TestOrderWorkflow(t *testing.T) {
+
+	workflow, _ := parseWorkflow("pipeline", testWorkflow)
+	steps, err := workflow.order()
+	if err != nil {
+		t.Fatalf("Error ordering workflow: %v", err)
+	}
+
+	var names []string
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+
+	expected := []string{"index", "align", "report", "lint"}
+	if !Equal(names, expected) {
+		t.Errorf("Incorrect order, got %v, want %v", names, expected)
+	}
+
+	// A cycle can't be ordered
+	cycle, _ := parseWorkflow("cycle", []string{"step one app", "step two app",
+		"needs one two", "needs two one"})
+	if _, err := cycle.order(); err == nil {
+		t.Errorf("Expected error ordering a workflow with a cycle")
+	}
+}
+
+// TestSelectWorkflowSteps tests selecting steps with from and until
+func TestSelectWorkflowSteps(t *testing.T) {
+
+	workflow, _ := parseWorkflow("pipeline", testWorkflow)
+
+	var selections = []struct {
+		name     string
+		from     string
+		until    string
+		selected []string
+	}{
+		{"all", "", "", []string{"index", "align", "report", "lint"}},
+		{"from", "align", "", []string{"align", "report"}},
+		{"until", "", "align", []string{"index", "align"}},
+		{"from and until", "align", "align", []string{"align"}},
+	}
+
+	for _, tt := range selections {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := workflow.selectSteps(tt.from, tt.until)
+			if err != nil {
+				t.Fatalf("Error selecting steps: %v", err)
+			}
+
+			var names []string
+			for _, step := range workflow.Steps {
+				if selected[step.Name] {
+					names = append(names, step.Name)
+				}
+			}
+			if !Equal(names, tt.selected) {
+				t.Errorf("got %v, want %v", names, tt.selected)
+			}
+		})
+	}
+
+	if _, err := workflow.selectSteps("nope", ""); err == nil {
+		t.Errorf("Expected error selecting an undefined step")
+	}
+}
+
+// TestWorkflowUpToDate tests that a step is up to date when its outputs are
+// newer than its inputs
+func TestWorkflowUpToDate(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "ref.fa")
+	output := filepath.Join(dir, "ref.fa.bwt")
+	step := &WorkflowStep{Name: "index", Inputs: []string{input}, Outputs: []string{output}}
+	if step.isUpToDate() {
+		t.Errorf("Expected a step without its outputs to run")
+	}
+
+	old, now := time.Now().Add(-time.Hour), time.Now()
+	for path, modified := range map[string]time.Time{input: old, output: now} {
+		if err := ioutil.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatalf("Error writing %s: %v", path, err)
+		}
+		os.Chtimes(path, modified, modified)
+	}
+	if !step.isUpToDate() {
+		t.Errorf("Expected a step with newer outputs to be up to date")
+	}
+
+	// A newer (or missing) input means the step runs again
+	os.Chtimes(input, now.Add(time.Minute), now.Add(time.Minute))
+	if step.isUpToDate() {
+		t.Errorf("Expected a step with a newer input to run")
+	}
+	step.Inputs = append(step.Inputs, filepath.Join(dir, "missing.fa"))
+	os.Chtimes(input, old, old)
+	if step.isUpToDate() {
+		t.Errorf("Expected a step with a missing input to run")
+	}
+	if (&WorkflowStep{Name: "lint"}).isUpToDate() {
+		t.Errorf("Expected a step without outputs to run")
+	}
+}
+
+// TestRunWorkflow tests running a workflow, with a step that is up to date
+// (unless forced), and a failed step that blocks those that need it
+func TestRunWorkflow(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scif")
+	if err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	Scif.Base = dir
+	Scif.Apps = filepath.Join(dir, "apps")
+	Scif.Data = filepath.Join(dir, "data")
+
+	recipe := filepath.Join(dir, "pipeline.scif")
+	content := `%apprun maker
+    echo run >> "$SCIF_APPDATA_maker/runs"
+    touch "$SCIF_APPDATA_maker/out.txt"
+%apprun broken
+    exit 3
+%apprun after
+    touch "$SCIF_APPDATA_after/ran"
+`
+	if err := ioutil.WriteFile(recipe, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing recipe: %v", err)
+	}
+	if err := Install(recipe, []string{}, true); err != nil {
+		t.Fatalf("Error installing recipe: %v", err)
+	}
+
+	workflow := filepath.Join(dir, "workflow.scif")
+	content = `%workflow pipeline
+    step make maker
+    step break broken
+    step finish after
+    needs finish break
+    inputs make in.txt
+    outputs make out.txt
+`
+	if err := ioutil.WriteFile(workflow, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing workflow: %v", err)
+	}
+
+	data := filepath.Join(Scif.Data, "maker")
+	for _, app := range []string{"maker", "after"} {
+		os.MkdirAll(filepath.Join(Scif.Data, app), 0755)
+	}
+	input := filepath.Join(data, "in.txt")
+	if err := ioutil.WriteFile(input, []byte("in"), 0644); err != nil {
+		t.Fatalf("Error writing input: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(input, old, old)
+
+	runs := func() int {
+		content, _ := ioutil.ReadFile(filepath.Join(data, "runs"))
+		return strings.Count(string(content), "run")
+	}
+	statuses := func(results []WorkflowStepResult) []string {
+		var values []string
+		for _, result := range results {
+			values = append(values, result.Status)
+		}
+		return values
+	}
+
+	// The failed step blocks the step that needs it, and the workflow fails
+	results, err := RunWorkflow("pipeline", WorkflowOptions{File: workflow})
+	if err == nil {
+		t.Errorf("Expected the workflow to fail")
+	}
+	expected := []string{workflowSuccess, workflowFailed, workflowBlocked}
+	if !Equal(statuses(results), expected) {
+		t.Errorf("Incorrect statuses, got %v, want %v", statuses(results), expected)
+	}
+	if results[1].ExitCode != 3 {
+		t.Errorf("Expected the failed step to exit 3, got %d", results[1].ExitCode)
+	}
+	if _, err := os.Stat(filepath.Join(Scif.Data, "after", "ran")); err == nil {
+		t.Errorf("Expected the blocked step not to run")
+	}
+
+	// The output is newer than the input, so the step is skipped
+	results, _ = RunWorkflow("pipeline", WorkflowOptions{File: workflow})
+	if results[0].Status != workflowUpToDate || runs() != 1 {
+		t.Errorf("Expected the step to be up to date, got %s after %d runs", results[0].Status, runs())
+	}
+
+	// Unless it's forced
+	results, _ = RunWorkflow("pipeline", WorkflowOptions{File: workflow, Force: true})
+	if results[0].Status != workflowSuccess || runs() != 2 {
+		t.Errorf("Expected the forced step to run, got %s after %d runs", results[0].Status, runs())
+	}
+}
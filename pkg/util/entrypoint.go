@@ -22,38 +22,90 @@ import (
 	"github.com/google/shlex"
 )
 
-// ParseEntrypoint will handle special characters in the entrypoint command
-// the input should be a string from the command line
-//     Special characters in the entrypoint should be replaced
-//            [e] in the command or entrypoint: environment vars --> $
-//            [out] in the command or entrypoint: environment vars --> >
-//            [in] in the command or entrypoint: environment vars --> <
-//            [pipe] in the command or entrypoint: environment vars --> |
-func ParseEntrypoint(entrypoint string) []string {
+// entrypointTokens are the (deprecated) tokens that stood in for shell
+// syntax on the command line, and what they mean to the shell
+var entrypointTokens = [][2]string{
+	{"[e]", "$"},
+	{"[out]", ">"},
+	{"[in]", "<"},
+	{"[pipe]", "|"},
+	{"[append]", ">>"},
+}
 
-	entrypoint = strings.Replace(entrypoint, "[e]", "$", -1)
-	entrypoint = strings.Replace(entrypoint, "[out]", ">", -1)
-	entrypoint = strings.Replace(entrypoint, "[in]", "<", -1)
-	entrypoint = strings.Replace(entrypoint, "[pipe]", "|", -1)
-	entrypoint = strings.Replace(entrypoint, "[append]", "|", -1)
-	entrypoint = os.ExpandEnv(entrypoint)
+// ParseEntrypoint splits an entrypoint string (e.g., SCIF_ENTRYPOINT) into
+// a list, with shell-like quoting, and then expands environment variables in
+// each word (so a value with spaces stays one argument). The deprecated
+// tokens (e.g., [e] or [pipe]) are not replaced.
+func ParseEntrypoint(entrypoint string) []string {
 	entrylist, _ := shlex.Split(entrypoint)
+	for i, word := range entrylist {
+		entrylist[i] = os.ExpandEnv(word)
+	}
 	return entrylist
 }
 
-// ParseEntrypointList is a second version intended for a list
+// ParseEntrypointList replaces the tokens in each item of an entrypoint list,
+// and expands environment variables.
+//
+// Deprecated: run a command string with a shell (see exec --shell) instead,
+// or use HasEntrypointTokens and ReplaceEntrypointTokens.
 func ParseEntrypointList(entrypoint []string) []string {
 
 	var newEntrypoint []string
 
 	for _, item := range entrypoint {
-		item = strings.Replace(item, "[e]", "$", -1)
-		item = strings.Replace(item, "[out]", ">", -1)
-		item = strings.Replace(item, "[in]", "<", -1)
-		item = strings.Replace(item, "[pipe]", "|", -1)
-		item = strings.Replace(item, "[append]", "|", -1)
+		for _, token := range entrypointTokens {
+			item = strings.Replace(item, token[0], token[1], -1)
+		}
 		item = os.ExpandEnv(item)
 		newEntrypoint = append(newEntrypoint, item)
 	}
 	return newEntrypoint
 }
+
+// HasEntrypointTokens returns true if any item of an entrypoint list has
+// a deprecated token, such as [e] or [pipe]
+func HasEntrypointTokens(entrypoint []string) bool {
+	for _, item := range entrypoint {
+		for _, token := range entrypointTokens {
+			if strings.Contains(item, token[0]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReplaceEntrypointTokens returns an entrypoint list as a command string for
+// a shell, where the deprecated tokens are replaced with the shell syntax
+//     Special characters in the entrypoint are replaced
+//            [e] in the command or entrypoint: environment vars --> $
+//            [out] in the command or entrypoint: redirect output --> >
+//            [in] in the command or entrypoint: redirect input --> <
+//            [pipe] in the command or entrypoint: pipe --> |
+//            [append] in the command or entrypoint: append output --> >>
+// Items without tokens are quoted, so they are passed as they were.
+func ReplaceEntrypointTokens(entrypoint []string) string {
+
+	var command []string
+	for _, item := range entrypoint {
+		replaced := item
+		for _, token := range entrypointTokens {
+			replaced = strings.Replace(replaced, token[0], token[1], -1)
+		}
+		if replaced == item {
+			replaced = ShellQuote(item)
+		}
+		command = append(command, replaced)
+	}
+	return strings.Join(command, " ")
+}
+
+// ShellQuote quotes a string for a POSIX shell, if it needs quoting
+func ShellQuote(value string) string {
+
+	if value != "" && strings.Trim(value, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+=./:,@%") == "" {
+		return value
+	}
+	return "'" + strings.Replace(value, "'", `'"'"'`, -1) + "'"
+}
@@ -34,11 +34,11 @@ func TestParseEntrypoint(t *testing.T) {
 		parsed   []string
 	}{
 		{"basic test", "echo hello", []string{"echo", "hello"}},
-		{"[e]OMG -> $OMG", "echo [e]OMG", []string{"echo", "TACOS"}},
-		{"[out] -> >", "echo vanilla [out] icecream", []string{"echo", "vanilla", ">", "icecream"}},
-		{"[in] -> <", "blaa [in] bloo", []string{"blaa", "<", "bloo"}},
-		{"[pipe] -> |", "cat man [pipe] grep batman", []string{"cat", "man", "|", "grep", "batman"}},
-		{"[append] -> |", "cat man [append] grep batman", []string{"cat", "man", "|", "grep", "batman"}},
+		{"quoted", "echo 'hello world'", []string{"echo", "hello world"}},
+		{"$OMG is expanded", "echo $OMG", []string{"echo", "TACOS"}},
+		{"expanded after splitting", "echo '$OMG and more' ${OMG}", []string{"echo", "TACOS and more", "TACOS"}},
+		{"[e]OMG is not replaced", "echo [e]OMG", []string{"echo", "[e]OMG"}},
+		{"[pipe] is not replaced", "cat man [pipe] grep batman", []string{"cat", "man", "[pipe]", "grep", "batman"}},
 	}
 
 	for _, tt := range entryPoints {
@@ -51,7 +51,7 @@ func TestParseEntrypoint(t *testing.T) {
 	}
 }
 
-// TestParseEntrypointList to test parsing an entrypoint list
+// TestParseEntrypointList to test parsing an entrypoint list (deprecated)
 func TestParseEntrypointList(t *testing.T) {
 
 	os.Setenv("OMG", "TACOS")
@@ -66,7 +66,7 @@ func TestParseEntrypointList(t *testing.T) {
 		{"[out]", []string{"[out]"}, []string{">"}},
 		{"[in]", []string{"[in]"}, []string{"<"}},
 		{"[pipe]", []string{"[pipe]"}, []string{"|"}},
-		{"[append]", []string{"[append]"}, []string{"|"}},
+		{"[append]", []string{"[append]"}, []string{">>"}},
 	}
 
 	for _, tt := range entryPoints {
@@ -78,3 +78,34 @@ func TestParseEntrypointList(t *testing.T) {
 		})
 	}
 }
+
+// TestReplaceEntrypointTokens to test replacing the deprecated tokens
+func TestReplaceEntrypointTokens(t *testing.T) {
+
+	var entryPoints = []struct {
+		name     string
+		original []string
+		tokens   bool
+		command  string
+	}{
+		{"test basic", []string{"echo", "hello"}, false, "echo hello"},
+		{"[e]OMG", []string{"echo", "[e]OMG"}, true, "echo $OMG"},
+		{"[out]", []string{"echo", "[out]", "file"}, true, "echo > file"},
+		{"[in]", []string{"cat", "[in]", "file"}, true, "cat < file"},
+		{"[pipe]", []string{"cat", "man", "[pipe]", "grep", "batman"}, true, "cat man | grep batman"},
+		{"[append]", []string{"echo", "[append]", "file"}, true, "echo >> file"},
+		{"quoted", []string{"echo", "hello world", "it's"}, false, `echo 'hello world' 'it'"'"'s'`},
+	}
+
+	for _, tt := range entryPoints {
+		t.Run(tt.name, func(t *testing.T) {
+			if HasEntrypointTokens(tt.original) != tt.tokens {
+				t.Errorf("%v has tokens should be %v", tt.original, tt.tokens)
+			}
+			command := ReplaceEntrypointTokens(tt.original)
+			if command != tt.command {
+				t.Errorf("got %s, want %s", command, tt.command)
+			}
+		})
+	}
+}